@@ -1,21 +1,80 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"os"
+	"strings"
 
 	"gonett/internal/topology"
 )
 
 func cmdBuild() {
-	topo := topology.NewTopology()
-	topo.AddHost("h1")
-	topo.AddHost("h2")
-	topo.AddSwitch("s1")
-	topo.AddLinkWithIPs("h1", "s1", "10.0.0.1/24", "")
-	topo.AddLinkWithIPs("h2", "s1", "10.0.0.2/24", "")
+	var opts topology.Options
+	var file string
+
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-f", "--file":
+			if i+1 >= len(args) {
+				buildUsage()
+			}
+			i++
+			file = args[i]
+		case "--auto-mac":
+			opts.AutoSetMACs = true
+		case "--static-arp":
+			opts.StaticARP = true
+		default:
+			buildUsage()
+		}
+	}
+
+	topo := sampleTopology()
+	if file != "" {
+		var err error
+		if topo, err = loadTopology(file); err != nil {
+			log.Fatalf("Failed to load topology: %v", err)
+		}
+	}
+
+	// Let the daemon build it when it is running
+	if client := daemonClient(); client != nil {
+		data, err := topo.Marshal()
+		if err != nil {
+			log.Fatalf("Failed to encode topology: %v", err)
+		}
+
+		fmt.Printf("Building lab '%s' through gonettd...\n", topo.LabName())
+		result, err := client.Build(data, opts.AutoSetMACs, opts.StaticARP)
+		if err != nil {
+			log.Fatalf("Failed to build topology: %v", err)
+		}
+
+		fmt.Printf("  Nodes: %s\n", strings.Join(result.Nodes, ", "))
+		fmt.Printf("\n✓ Topology built successfully in %.2fs!\n", result.Seconds)
+		return
+	}
+
+	defer lockStore()()
+
+	// Refuse what Build would only find out half way, leaving nodes behind
+	containers, err := newContainerManager().ListContainers()
+	if err != nil {
+		log.Fatalf("Failed to list containers: %v", err)
+	}
+	for _, c := range containers {
+		if c.Lab == topo.LabName() {
+			log.Fatalf("Failed to build topology: lab '%s' already exists", topo.LabName())
+		}
+	}
+	if err := topology.Preflight(topo, containers); err != nil {
+		log.Fatalf("Failed to build topology: check topology: %v", err)
+	}
 
 	// Build it
-	builder, err := topology.NewBuilder()
+	builder, err := topology.NewBuilderWithOptions(opts)
 	if err != nil {
 		log.Fatalf("Failed to create builder: %v", err)
 	}
@@ -24,3 +83,19 @@ func cmdBuild() {
 		log.Fatalf("Failed to build topology: %v", err)
 	}
 }
+
+// sampleTopology is built when no topology file is given: two hosts on a switch
+func sampleTopology() *topology.Topology {
+	topo := topology.NewTopology()
+	topo.AddHost("h1")
+	topo.AddHost("h2")
+	topo.AddSwitch("s1")
+	topo.AddLinkWithIPs("h1", "s1", "10.0.0.1/24", "")
+	topo.AddLinkWithIPs("h2", "s1", "10.0.0.2/24", "")
+	return topo
+}
+
+func buildUsage() {
+	fmt.Println("Usage: gonett build [-f <file>] [--auto-mac] [--static-arp]")
+	os.Exit(1)
+}
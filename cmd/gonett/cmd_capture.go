@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gonett/internal/capture"
+	"gonett/internal/container/domain"
+	"gonett/internal/container/manager"
+)
+
+func cmdCapture() {
+	var opts capture.Options
+	var targets []string
+	output := ""
+
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-w", "-f", "-s", "-c", "-d":
+			if i+1 >= len(args) {
+				captureUsage()
+			}
+			flag, value := args[i], args[i+1]
+			i++
+			if flag == "-w" {
+				output = value
+				continue
+			}
+			if err := setCaptureOption(&opts, flag, value); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		default:
+			if strings.HasPrefix(args[i], "-") {
+				captureUsage()
+			}
+			targets = append(targets, args[i])
+		}
+	}
+	if len(targets) == 0 || output == "" {
+		captureUsage()
+	}
+
+	cm := newContainerManager()
+
+	var ifaces []capture.Interface
+	for _, target := range targets {
+		found, err := captureInterfaces(cm, target)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		ifaces = append(ifaces, found...)
+	}
+
+	// Progress goes to stderr so the capture can be piped with -w -
+	var w io.Writer = os.Stdout
+	if output != "-" {
+		f, err := os.Create(output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	for _, iface := range ifaces {
+		fmt.Fprintf(os.Stderr, "Capturing on %s\n", iface.Description)
+	}
+
+	stop := make(chan struct{})
+	stopOnSignal(func() { close(stop) })
+
+	stats, err := capture.Capture(ifaces, w, opts, stop)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "✓ %d packets captured, %d received by filter, %d dropped by kernel\n",
+		stats.Captured, stats.Received, stats.Dropped)
+}
+
+// setCaptureOption parses the value of one capture flag into opts
+func setCaptureOption(opts *capture.Options, flag, value string) error {
+	switch flag {
+	case "-f":
+		opts.Filter = value
+	case "-s":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid snaplen %q", value)
+		}
+		opts.Snaplen = n
+	case "-c":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid packet count %q", value)
+		}
+		opts.Count = n
+	case "-d":
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil || seconds <= 0 {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		opts.Duration = time.Duration(seconds * float64(time.Second))
+	}
+	return nil
+}
+
+// captureInterfaces resolves a capture target: <node> for all of its
+// interfaces, <node>:<iface> for one, or <a>-<b> for a's side of every link
+// between a and b
+func captureInterfaces(cm *manager.ContainerManager, target string) ([]capture.Interface, error) {
+	if node, iface, ok := strings.Cut(target, ":"); ok {
+		c, err := findContainer(cm, node)
+		if err != nil {
+			return nil, err
+		}
+		return []capture.Interface{captureInterface(c, iface)}, nil
+	}
+
+	if c, err := findContainer(cm, target); err == nil {
+		names, err := capture.Interfaces(c.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("%s has no interfaces", c.Name)
+		}
+		var ifaces []capture.Interface
+		for _, name := range names {
+			ifaces = append(ifaces, captureInterface(c, name))
+		}
+		return ifaces, nil
+	}
+
+	// Node names may contain dashes, so try every split
+	for i := strings.Index(target, "-"); i > 0; i = nextDash(target, i) {
+		a, errA := findContainer(cm, target[:i])
+		b, errB := findContainer(cm, target[i+1:])
+		if errA != nil || errB != nil {
+			continue
+		}
+
+		var ifaces []capture.Interface
+		for _, p := range containerPorts(a) {
+			if strings.HasPrefix(p.Peer, vethEndLabel(b.Namespace, "")) {
+				ifaces = append(ifaces, captureInterface(a, p.Interface))
+			}
+		}
+		if len(ifaces) == 0 {
+			return nil, fmt.Errorf("no link between %s and %s", a.Name, b.Name)
+		}
+		return ifaces, nil
+	}
+
+	return nil, fmt.Errorf("container '%s' not found", target)
+}
+
+// nextDash returns the index of the next dash after i, or -1
+func nextDash(s string, i int) int {
+	j := strings.Index(s[i+1:], "-")
+	if j < 0 {
+		return -1
+	}
+	return i + 1 + j
+}
+
+// captureInterface describes one interface of a container, naming the far
+// end when it is a veth
+func captureInterface(c *domain.Container, ifName string) capture.Interface {
+	description := c.Name + ":" + ifName
+	for _, p := range containerPorts(c) {
+		if p.Interface == ifName {
+			description += " (to " + p.Peer + ")"
+		}
+	}
+	return capture.Interface{Namespace: c.Namespace, Name: ifName, Description: description}
+}
+
+func captureUsage() {
+	fmt.Println("Usage: gonett capture <node>[:iface] | <a>-<b> ... -w <file.pcapng|-> [-f <filter>] [-s <snaplen>] [-c <count>] [-d <seconds>]")
+	os.Exit(1)
+}
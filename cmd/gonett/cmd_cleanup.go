@@ -6,9 +6,18 @@ import (
 
 	"gonett/internal/container/manager"
 	"gonett/internal/container/repository"
+	"gonett/internal/daemon"
 )
 
 func cmdCleanup() {
+	// Let the daemon remove the containers when it is running
+	if client := daemonClient(); client != nil {
+		cleanupThroughDaemon(client)
+		return
+	}
+
+	defer lockStore()()
+
 	// Initialize repositories
 	repos, err := repository.InitializeRepositories()
 	if err != nil {
@@ -51,3 +60,25 @@ func cmdCleanup() {
 
 	fmt.Println("\n✓ Cleanup complete!")
 }
+
+func cleanupThroughDaemon(client *daemon.Client) {
+	result, err := client.Cleanup()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	if len(result.Removed) == 0 && len(result.Errors) == 0 {
+		fmt.Println("No containers to delete")
+		return
+	}
+
+	for _, name := range result.Removed {
+		fmt.Printf("  ✓ Deleted %s\n", name)
+	}
+	for _, msg := range result.Errors {
+		fmt.Printf("Error deleting container: %s\n", msg)
+	}
+
+	fmt.Println("\n✓ Cleanup complete!")
+}
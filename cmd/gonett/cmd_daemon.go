@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"gonett/internal/daemon"
+)
+
+// cmdDaemon runs gonettd, serving the API on a Unix socket until
+// interrupted. It runs as "gonett daemon" or through a gonettd link to the
+// gonett binary, which keeps the hidden service commands available to it.
+func cmdDaemon(args []string) {
+	socket := daemon.SocketPath()
+	var apiListen, token string
+	var watchDrift, heal bool
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--socket", "-s":
+			if i+1 >= len(args) {
+				daemonUsage()
+			}
+			i++
+			socket = args[i]
+		case "--api":
+			if i+1 >= len(args) {
+				daemonUsage()
+			}
+			i++
+			apiListen = args[i]
+		case "--token":
+			if i+1 >= len(args) {
+				daemonUsage()
+			}
+			i++
+			token = args[i]
+		case "--watch":
+			watchDrift = true
+		case "--heal":
+			watchDrift, heal = true, true
+		default:
+			daemonUsage()
+		}
+	}
+
+	server, err := daemon.NewServer()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	listener, err := daemon.Listen(socket)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	httpServer := &http.Server{Handler: server}
+
+	// Serve the REST API over TCP as well when asked to
+	var apiServer *http.Server
+	if apiListen != "" {
+		if token, err = apiToken(token); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		apiServer = &http.Server{Addr: apiListen, Handler: server.APIHandler(token)}
+		go func() {
+			if err := apiServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		}()
+		fmt.Printf("✓ Serving the API on http://%s/api/v1\n", apiListen)
+	}
+
+	// Watch the labs for drift from their records when asked to
+	stopWatch := make(chan struct{})
+	if watchDrift {
+		go func() {
+			if err := server.Watch(heal, stopWatch); err != nil {
+				fmt.Printf("Error: watch: %v\n", err)
+			}
+		}()
+		fmt.Println("✓ Watching labs for drift")
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		fmt.Println("\nShutting down...")
+		close(stopWatch)
+		if apiServer != nil {
+			apiServer.Shutdown(context.Background())
+		}
+		httpServer.Shutdown(context.Background())
+	}()
+
+	fmt.Printf("✓ gonettd listening on %s\n", socket)
+	if err := httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func daemonUsage() {
+	fmt.Println("Usage: gonettd [--socket <path>] [--api <addr>] [--token <token>] [--watch] [--heal]")
+	os.Exit(1)
+}
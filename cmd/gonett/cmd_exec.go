@@ -1,14 +1,12 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"log"
 	"os"
 	"strings"
 
-	"gonett/internal/container/domain"
-	"gonett/internal/container/manager"
-	"gonett/internal/container/repository"
+	"gonett/internal/daemon"
 )
 
 func cmdExec() {
@@ -20,37 +18,27 @@ func cmdExec() {
 	target := os.Args[2]
 	command := os.Args[3:]
 
-	// Initialize repositories
-	repos, err := repository.InitializeRepositories()
-	if err != nil {
-		log.Fatalf("Failed to initialize repositories: %v", err)
-	}
-
-	// Create container manager
-	cm := manager.NewContainerManager(
-		repos.ContainerRepo,
-		repos.NamespaceRepo,
-		repos.BridgeRepo,
-		repos.VethRepo,
-	)
+	// Stream the command through the daemon when it is running
+	if client := daemonClient(); client != nil {
+		fmt.Printf("Executing: %s\n", strings.Join(command, " "))
 
-	// Get all containers
-	containers, err := cm.ListContainers()
-	if err != nil {
-		fmt.Printf("Error: %v\n", err)
+		err := client.Exec(target, command, os.Stdin, os.Stdout, os.Stderr)
+		var exitErr *daemon.ExitError
+		if errors.As(err, &exitErr) {
+			err = fmt.Errorf("exec command: %w", err)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
 		return
 	}
 
-	// Find container by ID or name
-	var container *domain.Container
-	for _, c := range containers {
-		if strings.HasPrefix(c.ID, target) || c.Name == target {
-			container = c
-			break
-		}
-	}
+	cm := newContainerManager()
 
-	if container == nil {
+	// Find container by ID or name
+	container, err := findContainer(cm, target)
+	if err != nil {
 		fmt.Printf("Container '%s' not found\n", target)
 		os.Exit(1)
 	}
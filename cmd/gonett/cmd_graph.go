@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gonett/internal/graph"
+)
+
+func cmdGraph() {
+	lab, format, output := "", "", "-"
+
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--format", "--lab", "-o":
+			if i+1 >= len(args) {
+				graphUsage()
+			}
+			flag, value := args[i], args[i+1]
+			i++
+			switch flag {
+			case "--format":
+				format = value
+			case "--lab":
+				lab = value
+			case "-o":
+				output = value
+			}
+		default:
+			graphUsage()
+		}
+	}
+	if format == "" {
+		switch filepath.Ext(output) {
+		case ".mmd", ".mermaid":
+			format = graph.FormatMermaid
+		case ".json":
+			format = graph.FormatJSON
+		default:
+			format = graph.FormatDOT
+		}
+	}
+
+	containers, err := selectContainers(newContainerManager(), nil, lab)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(containers) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: no containers found")
+		os.Exit(1)
+	}
+
+	var w io.Writer = os.Stdout
+	if output != "-" {
+		f, err := os.Create(output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := graph.Write(w, graph.Build(containers), strings.ToLower(format)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if output != "-" {
+		fmt.Fprintf(os.Stderr, "✓ Graph written to %s\n", output)
+	}
+}
+
+func graphUsage() {
+	fmt.Println("Usage: gonett graph [--lab <name>] [--format dot|mermaid|json] [-o <file>]")
+	os.Exit(1)
+}
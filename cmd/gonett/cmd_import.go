@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gonett/internal/topology"
+)
+
+// Formats gonett import reads
+const (
+	formatGraphML      = "graphml"
+	formatContainerlab = "containerlab"
+)
+
+// cmdImport converts a topology from another format into gonett YAML, to
+// edit before building it with build -f
+func cmdImport() {
+	var opts topology.GraphMLOptions
+	file, output, format := "", "-", ""
+
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--no-hosts":
+			opts.NoHosts = true
+		case "--no-delay":
+			opts.NoDelay = true
+		case "-o", "--format", "--mode", "--hosts", "--name":
+			if i+1 >= len(args) {
+				importUsage()
+			}
+			flag, value := args[i], args[i+1]
+			i++
+			switch flag {
+			case "-o":
+				output = value
+			case "--format":
+				format = value
+			case "--mode":
+				opts.Mode = value
+			case "--hosts":
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 1 {
+					fmt.Fprintf(os.Stderr, "Error: invalid host count %q\n", value)
+					os.Exit(1)
+				}
+				opts.Hosts = n
+			case "--name":
+				opts.Name = value
+			}
+		default:
+			if strings.HasPrefix(args[i], "-") || file != "" {
+				importUsage()
+			}
+			file = args[i]
+		}
+	}
+	if file == "" {
+		importUsage()
+	}
+	if format == "" {
+		var err error
+		if format, err = detectFormat(file); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var topo *topology.Topology
+	var labels map[string]string
+	var err error
+	switch format {
+	case formatGraphML:
+		topo, labels, err = topology.LoadGraphML(file, opts)
+	case formatContainerlab:
+		var warnings []string
+		topo, warnings, err = topology.LoadContainerlab(file)
+		printWarnings(warnings)
+		if err == nil && opts.Name != "" {
+			topo.Name = opts.Name
+		}
+	default:
+		err = fmt.Errorf("unknown format %q (want graphml or containerlab)", format)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	data, err := topo.Marshal()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Keep the graph's node labels as comments
+	var header strings.Builder
+	fmt.Fprintf(&header, "# Imported from %s\n", filepath.Base(file))
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return nodeLess(names[i], names[j]) })
+	for _, name := range names {
+		fmt.Fprintf(&header, "#   %s: %s\n", name, labels[name])
+	}
+	data = append([]byte(header.String()), data...)
+
+	writeOutput(output, data, fmt.Sprintf("Imported %d nodes and %d links", len(topo.Nodes), len(topo.Links)))
+}
+
+// cmdExport converts a gonett topology file into a containerlab topology
+func cmdExport() {
+	file, output, image := "", "-", ""
+
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-o", "--image", "--format":
+			if i+1 >= len(args) {
+				exportUsage()
+			}
+			flag, value := args[i], args[i+1]
+			i++
+			switch flag {
+			case "-o":
+				output = value
+			case "--image":
+				image = value
+			case "--format":
+				if value != formatContainerlab {
+					fmt.Fprintf(os.Stderr, "Error: unknown format %q (want containerlab)\n", value)
+					os.Exit(1)
+				}
+			}
+		default:
+			if strings.HasPrefix(args[i], "-") || file != "" {
+				exportUsage()
+			}
+			file = args[i]
+		}
+	}
+	if file == "" {
+		exportUsage()
+	}
+
+	topo, err := loadTopology(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	data, warnings, err := topo.ExportContainerlab(image)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	printWarnings(warnings)
+
+	writeOutput(output, data, fmt.Sprintf("Exported lab '%s'", topo.LabName()))
+}
+
+// loadTopology reads a topology file in any format gonett understands:
+// gonett YAML, GraphML or containerlab YAML
+func loadTopology(file string) (*topology.Topology, error) {
+	format, err := detectFormat(file)
+	if err != nil {
+		return topology.LoadFile(file)
+	}
+
+	switch format {
+	case formatGraphML:
+		topo, _, err := topology.LoadGraphML(file, topology.GraphMLOptions{})
+		return topo, err
+	case formatContainerlab:
+		topo, warnings, err := topology.LoadContainerlab(file)
+		printWarnings(warnings)
+		return topo, err
+	}
+	return topology.LoadFile(file)
+}
+
+// detectFormat tells GraphML files by their extension and containerlab
+// files by their extension or their topology key
+func detectFormat(file string) (string, error) {
+	name := strings.ToLower(file)
+	switch {
+	case strings.HasSuffix(name, ".graphml"), strings.HasSuffix(name, ".xml"):
+		return formatGraphML, nil
+	case strings.HasSuffix(name, ".clab.yml"), strings.HasSuffix(name, ".clab.yaml"):
+		return formatContainerlab, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	if topology.IsContainerlab(data) {
+		return formatContainerlab, nil
+	}
+	return "", fmt.Errorf("%s: unknown topology format (want graphml or containerlab)", file)
+}
+
+func printWarnings(warnings []string) {
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+}
+
+// writeOutput writes converted data to a file, or to stdout for "-"
+func writeOutput(output string, data []byte, done string) {
+	if output == "-" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(output, data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✓ %s into %s\n", done, output)
+}
+
+// nodeLess orders names like r2 before r10
+func nodeLess(a, b string) bool {
+	prefixA := strings.TrimRight(a, "0123456789")
+	prefixB := strings.TrimRight(b, "0123456789")
+	if prefixA != prefixB {
+		return prefixA < prefixB
+	}
+	numA, _ := strconv.Atoi(a[len(prefixA):])
+	numB, _ := strconv.Atoi(b[len(prefixB):])
+	return numA < numB
+}
+
+func importUsage() {
+	fmt.Println("Usage: gonett import <file> [-o <file>] [--format graphml|containerlab] [--name <lab>]")
+	fmt.Println("                     [--mode router|switch] [--hosts <n>] [--no-hosts] [--no-delay]")
+	os.Exit(1)
+}
+
+func exportUsage() {
+	fmt.Println("Usage: gonett export <file> [-o <file>] [--format containerlab] [--image <image>]")
+	os.Exit(1)
+}
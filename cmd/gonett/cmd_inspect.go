@@ -0,0 +1,334 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gonett/internal/container/domain"
+)
+
+// port is one interface of a container as seen from that container
+type port struct {
+	Number    int
+	Interface string
+	Peer      string
+	MAC       string
+	MTU       int
+	Addresses []string
+	Neighbors []domain.Neighbor
+}
+
+func cmdInspect() {
+	if len(os.Args) < 3 {
+		fmt.Println("Usage: gonett inspect <container-id|name>")
+		os.Exit(1)
+	}
+
+	cm := newContainerManager()
+
+	container, err := findContainer(cm, os.Args[2])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	namespace := "-"
+	if container.Namespace != nil {
+		namespace = fmt.Sprintf("%s (%s)", container.Namespace.Name, container.Namespace.Path)
+	}
+
+	fmt.Printf("Name:       %s\n", container.Name)
+	fmt.Printf("ID:         %s\n", container.ID)
+	fmt.Printf("Type:       %s\n", valueOr(container.Type, "-"))
+	fmt.Printf("Lab:        %s\n", valueOr(container.Lab, "-"))
+	fmt.Printf("Namespace:  %s\n", namespace)
+	fmt.Printf("Created:    %s\n", container.CreatedAt)
+
+	if container.NAT != nil {
+		fmt.Println("\nNAT:")
+		fmt.Printf("  Interface:  %s (root namespace)\n", container.NAT.Interface)
+		fmt.Printf("  Address:    %s\n", container.NAT.Address)
+		fmt.Printf("  Subnet:     %s (masqueraded)\n", container.NAT.Subnet)
+	}
+
+	if len(container.Sysctls) > 0 {
+		keys := make([]string, 0, len(container.Sysctls))
+		for key := range container.Sysctls {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		fmt.Println("\nSysctls:")
+		fmt.Printf("  %-44s  %-16s  %s\n", "KEY", "CONFIGURED", "LIVE")
+		for _, key := range keys {
+			want := container.Sysctls[key]
+			live, err := domain.GetSysctl(container.Namespace, key)
+			if err != nil {
+				live = "error: " + err.Error()
+			} else if live = strings.Join(strings.Fields(live), " "); live != strings.Join(strings.Fields(want), " ") {
+				live += "  (drift)"
+			}
+			fmt.Printf("  %-44s  %-16s  %s\n", key, want, live)
+		}
+	}
+
+	if len(container.Services) > 0 {
+		fmt.Println("\nServices:")
+		fmt.Printf("  %-10s  %-8s  %-8s  %s\n", "NAME", "PID", "STATE", "LOG")
+		for _, svc := range container.Services {
+			state := "stopped"
+			if svc.Running() {
+				state = "running"
+			}
+			fmt.Printf("  %-10s  %-8d  %-8s  %s\n", svc.Name, svc.PID, state, svc.Log)
+		}
+	}
+
+	if container.Resolver != nil {
+		fmt.Println("\nDNS:")
+		fmt.Printf("  Nameservers:  %s\n", strings.Join(container.Resolver.Nameservers, ", "))
+		fmt.Printf("  Search:       %s\n", valueOr(strings.Join(container.Resolver.Search, " "), "-"))
+	}
+
+	if len(container.Leases) > 0 {
+		fmt.Println("\nDHCP leases:")
+		fmt.Printf("  %-16s  %-20s  %-16s  %-16s  %-8s  %s\n", "INTERFACE", "ADDRESS", "ROUTER", "SERVER", "LEASE", "OBTAINED")
+		for _, l := range container.Leases {
+			fmt.Printf("  %-16s  %-20s  %-16s  %-16s  %-8s  %s\n",
+				l.Interface, l.Address, valueOr(l.Router, "-"), l.Server, fmt.Sprintf("%ds", l.LeaseTime), l.ObtainedAt)
+		}
+	}
+
+	if len(container.Routes) > 0 {
+		fmt.Println("\nRoutes:")
+		for _, r := range container.Routes {
+			fmt.Printf("  %s\n", r)
+		}
+	}
+
+	if len(container.Bridges) > 0 {
+		fmt.Println("\nBridges:")
+		for _, bridge := range container.Bridges {
+			fmt.Printf("  %s  %s\n", bridge.Name, bridgeFeatures(bridge.Options))
+			for _, p := range bridge.Ports {
+				vlan := "-"
+				if p.VLAN != nil {
+					vlan = p.VLAN.String()
+				}
+				fmt.Printf("    %-16s  %s\n", p.Interface, vlan)
+			}
+			for _, m := range bridge.Mirrors {
+				fmt.Printf("    mirror %s  %s  %s -> %s%s\n", m.Name, m.Direction, strings.Join(m.Sources, ","), m.Monitor, mirrorState(&bridge, m))
+			}
+		}
+	}
+
+	if len(container.Externals) > 0 {
+		fmt.Println("\nExternal interfaces:")
+		fmt.Printf("  %-16s  %-8s  %-16s  %s\n", "INTERFACE", "MODE", "PARENT", "ORIGIN")
+		for _, e := range container.Externals {
+			fmt.Printf("  %-16s  %-8s  %-16s  %s\n", e.Name, e.Mode, e.Parent, valueOr(e.OriginNamespace, "root"))
+		}
+	}
+
+	ports := containerPorts(container)
+	if len(ports) > 0 {
+		fmt.Println("\nPorts:")
+		fmt.Printf("  %-6s  %-16s  %-28s  %-17s  %-6s  %s\n", "PORT", "INTERFACE", "PEER", "MAC", "MTU", "ADDRESSES")
+		for _, p := range ports {
+			number := "-"
+			if p.Number > 0 {
+				number = fmt.Sprintf("%d", p.Number)
+			}
+			addrs := "-"
+			if len(p.Addresses) > 0 {
+				addrs = strings.Join(p.Addresses, ", ")
+			}
+			fmt.Printf("  %-6s  %-16s  %-28s  %-17s  %-6s  %s\n",
+				number, p.Interface, p.Peer, valueOr(p.MAC, "-"), liveMTU(p.Interface, container.Namespace, p.MTU), addrs)
+		}
+	}
+
+	neighbors := containerNeighbors(container, ports)
+	if len(neighbors) > 0 {
+		fmt.Println("\nStatic neighbors:")
+		fmt.Printf("  %-16s  %-28s  %s\n", "INTERFACE", "ADDRESS", "MAC")
+		for _, n := range neighbors {
+			fmt.Printf("  %-16s  %-28s  %s\n", n.Interface, n.IP, n.MAC)
+		}
+	}
+
+	if len(container.Bonds) > 0 {
+		fmt.Println("\nBonds:")
+		for i := range container.Bonds {
+			bond := &container.Bonds[i]
+			addrs := "-"
+			if len(bond.Addrs) > 0 {
+				addrs = strings.Join(bond.Addrs, ", ")
+			}
+			fmt.Printf("  %s  port %d  mode %s  mac %s  mtu %s  peer %s  addresses %s\n",
+				bond.Name, bond.Port, bond.Mode, valueOr(bond.MAC, "-"), liveMTU(bond.Name, bond.Namespace, bond.MTU),
+				valueOr(bond.Peer, "-"), addrs)
+
+			states, err := bond.MemberStates()
+			if err != nil {
+				fmt.Printf("    Warning: failed to read member state: %v\n", err)
+				continue
+			}
+			fmt.Printf("    %-16s  %-10s  %-8s  %-6s  %s\n", "MEMBER", "OPER", "STATE", "MII", "FAILURES")
+			for _, m := range states {
+				fmt.Printf("    %-16s  %-10s  %-8s  %-6s  %d\n", m.Name, m.OperState, m.State, m.MiiStatus, m.Failures)
+			}
+		}
+	}
+
+	if len(container.Tunnels) > 0 {
+		fmt.Println("\nTunnels:")
+		fmt.Printf("  %-16s  %-6s  %-32s  %-8s  %-6s  %-20s  %s\n", "INTERFACE", "KIND", "UNDERLAY", "ID", "MTU", "PEER", "ADDRESSES")
+		for _, t := range container.Tunnels {
+			id := "-"
+			if t.VNI > 0 {
+				id = fmt.Sprintf("vni %d", t.VNI)
+			} else if t.Key > 0 {
+				id = fmt.Sprintf("key %d", t.Key)
+			}
+			addrs := "-"
+			if len(t.Addrs) > 0 {
+				addrs = strings.Join(t.Addrs, ", ")
+			}
+			fmt.Printf("  %-16s  %-6s  %-32s  %-8s  %-6d  %-20s  %s\n",
+				t.Name, t.Kind, t.Local+" -> "+t.Remote, id, t.MTU, valueOr(t.Peer, "-"), addrs)
+		}
+	}
+
+	if len(container.VLANs) > 0 {
+		fmt.Println("\nVLAN interfaces:")
+		fmt.Printf("  %-16s  %-16s  %-6s  %s\n", "INTERFACE", "PARENT", "VLAN", "ADDRESSES")
+		for _, v := range container.VLANs {
+			addrs := "-"
+			if len(v.Addrs) > 0 {
+				addrs = strings.Join(v.Addrs, ", ")
+			}
+			fmt.Printf("  %-16s  %-16s  %-6d  %s\n", v.Name, v.Parent, v.VLANID, addrs)
+		}
+	}
+}
+
+// containerPorts returns the container's veth ends ordered by port number
+func containerPorts(c *domain.Container) []port {
+	var ports []port
+	for _, v := range c.Veths {
+		if domain.SameNamespace(v.NamespaceA, c.Namespace) {
+			ports = append(ports, port{
+				Number:    v.PortA,
+				Interface: v.Name,
+				Peer:      vethEndLabel(v.NamespaceB, v.PeerName),
+				MAC:       v.MACA,
+				MTU:       v.MTUA,
+				Addresses: v.AddrsA,
+				Neighbors: v.NeighborsA,
+			})
+		}
+		if domain.SameNamespace(v.NamespaceB, c.Namespace) {
+			ports = append(ports, port{
+				Number:    v.PortB,
+				Interface: v.PeerName,
+				Peer:      vethEndLabel(v.NamespaceA, v.Name),
+				MAC:       v.MACB,
+				MTU:       v.MTUB,
+				Addresses: v.AddrsB,
+				Neighbors: v.NeighborsB,
+			})
+		}
+	}
+
+	sort.SliceStable(ports, func(i, j int) bool {
+		if ports[i].Number != ports[j].Number {
+			return ports[i].Number < ports[j].Number
+		}
+		return ports[i].Interface < ports[j].Interface
+	})
+
+	return ports
+}
+
+// liveMTU reads an interface's current MTU and flags it when it differs
+// from the configured one
+func liveMTU(ifName string, ns *domain.Namespace, configured int) string {
+	mtu, err := domain.InterfaceMTU(ifName, ns)
+	if err != nil {
+		return "?"
+	}
+	if configured > 0 && mtu != configured {
+		return fmt.Sprintf("%d (want %d)", mtu, configured)
+	}
+	return fmt.Sprintf("%d", mtu)
+}
+
+// interfaceNeighbor is a static neighbor entry together with its interface
+type interfaceNeighbor struct {
+	Interface string
+	domain.Neighbor
+}
+
+// containerNeighbors returns the static neighbor entries installed on the
+// container's ports, bonds and VLAN sub-interfaces
+func containerNeighbors(c *domain.Container, ports []port) []interfaceNeighbor {
+	var neighbors []interfaceNeighbor
+	add := func(ifName string, entries []domain.Neighbor) {
+		for _, n := range entries {
+			neighbors = append(neighbors, interfaceNeighbor{Interface: ifName, Neighbor: n})
+		}
+	}
+
+	for _, p := range ports {
+		add(p.Interface, p.Neighbors)
+	}
+	for _, b := range c.Bonds {
+		add(b.Name, b.Neighbors)
+	}
+	for _, v := range c.VLANs {
+		add(v.Name, v.Neighbors)
+	}
+
+	return neighbors
+}
+
+// bridgeFeatures summarizes the switch features of a bridge
+func bridgeFeatures(opts domain.BridgeOptions) string {
+	features := []string{"stp " + onOff(opts.STP), "vlan_filtering " + onOff(opts.VLANFiltering)}
+	if opts.ForwardDelay > 0 {
+		features = append(features, fmt.Sprintf("forward_delay %ds", opts.ForwardDelay))
+	}
+	if opts.AgeingTime > 0 {
+		features = append(features, fmt.Sprintf("ageing %ds", opts.AgeingTime))
+	}
+	if opts.IGMPSnooping != nil {
+		features = append(features, "igmp_snooping "+onOff(*opts.IGMPSnooping))
+	}
+	return "(" + strings.Join(features, ", ") + ")"
+}
+
+func onOff(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+	return "off"
+}
+
+// vethEndLabel formats a veth end as "<namespace>:<interface>"
+func vethEndLabel(ns *domain.Namespace, ifName string) string {
+	if ns == nil {
+		return "root:" + ifName
+	}
+	return ns.Name + ":" + ifName
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gonett/internal/perf"
+)
+
+func cmdIperf() {
+	var opts perf.Options
+	var names []string
+	ipv6, asJSON := false, false
+
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-u", "--udp":
+			opts.UDP = true
+		case "-6":
+			ipv6 = true
+		case "--json":
+			asJSON = true
+		case "-t", "-P", "-b", "-p":
+			if i+1 >= len(args) {
+				iperfUsage()
+			}
+			flag, value := args[i], args[i+1]
+			i++
+			if err := setIperfOption(&opts, flag, value); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		default:
+			if strings.HasPrefix(args[i], "-") {
+				iperfUsage()
+			}
+			names = append(names, args[i])
+		}
+	}
+	if len(names) != 2 {
+		iperfUsage()
+	}
+
+	cm := newContainerManager()
+
+	client, err := findContainer(cm, names[0])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	server, err := findContainer(cm, names[1])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	target := pingTarget(server, ipv6)
+	if target == nil {
+		fmt.Printf("Error: %s has no address to test against\n", server.Name)
+		os.Exit(1)
+	}
+
+	protocol := "TCP"
+	if opts.UDP {
+		protocol = "UDP"
+	}
+	if !asJSON {
+		fmt.Printf("*** Iperf: testing %s bandwidth between %s and %s (%s)\n", protocol, client.Name, server.Name, target)
+	}
+
+	result, err := perf.Run(server.Namespace, client.Namespace, target, opts)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if asJSON {
+		out, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+
+	for _, s := range result.Streams {
+		printIperfLine(fmt.Sprintf("[%3d]", s.Stream), s.Seconds, s.BytesReceived, s.BitsPerSecond)
+		printIperfLoss(result.Protocol, s.Retransmits, s.Lost, s.Packets, s.JitterMs)
+	}
+	if len(result.Streams) > 1 {
+		printIperfLine("[SUM]", result.Seconds, result.BytesReceived, result.BitsPerSecond)
+		printIperfLoss(result.Protocol, result.Retransmits, result.Lost, result.Packets, result.JitterMs)
+	}
+	fmt.Printf("*** Results: %s\n", formatRate(result.BitsPerSecond))
+}
+
+// setIperfOption parses the value of one iperf flag into opts
+func setIperfOption(opts *perf.Options, flag, value string) error {
+	switch flag {
+	case "-t":
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil || seconds <= 0 {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		opts.Duration = time.Duration(seconds * float64(time.Second))
+	case "-P":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid stream count %q", value)
+		}
+		opts.Streams = n
+	case "-b":
+		rate, err := parseRate(value)
+		if err != nil {
+			return err
+		}
+		opts.Rate = rate
+	case "-p":
+		port, err := strconv.Atoi(value)
+		if err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("invalid port %q", value)
+		}
+		opts.Port = port
+	}
+	return nil
+}
+
+// parseRate parses a bit rate with an optional K, M or G suffix (powers of 1000)
+func parseRate(rate string) (int64, error) {
+	if rate == "" {
+		return 0, fmt.Errorf("empty rate")
+	}
+
+	s := rate
+	multiplier := 1.0
+	switch strings.ToUpper(s[len(s)-1:]) {
+	case "K":
+		multiplier = 1e3
+	case "M":
+		multiplier = 1e6
+	case "G":
+		multiplier = 1e9
+	}
+	if multiplier != 1 {
+		s = s[:len(s)-1]
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid rate %q", rate)
+	}
+	return int64(value * multiplier), nil
+}
+
+// formatRate renders a bit rate the way iperf does
+func formatRate(bps float64) string {
+	switch {
+	case bps >= 1e9:
+		return fmt.Sprintf("%.2f Gbits/sec", bps/1e9)
+	case bps >= 1e6:
+		return fmt.Sprintf("%.2f Mbits/sec", bps/1e6)
+	default:
+		return fmt.Sprintf("%.2f Kbits/sec", bps/1e3)
+	}
+}
+
+// formatBytes renders a transfer size in binary units
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.2f GBytes", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.2f MBytes", float64(n)/(1<<20))
+	default:
+		return fmt.Sprintf("%.2f KBytes", float64(n)/(1<<10))
+	}
+}
+
+func printIperfLine(label string, seconds float64, bytes int64, bps float64) {
+	fmt.Printf("%s 0.0-%.1f sec  %s  %s", label, seconds, formatBytes(bytes), formatRate(bps))
+}
+
+func printIperfLoss(protocol string, retransmits uint32, lost, packets int64, jitterMs float64) {
+	if protocol == "udp" {
+		loss := 0.0
+		if packets > 0 {
+			loss = float64(lost) * 100 / float64(packets)
+		}
+		fmt.Printf("  %.3f ms  %d/%d (%.2g%%)\n", jitterMs, lost, packets, loss)
+		return
+	}
+	fmt.Printf("  retransmits %d\n", retransmits)
+}
+
+func iperfUsage() {
+	fmt.Println("Usage: gonett iperf <client> <server> [-u] [-6] [-t <seconds>] [-P <streams>] [-b <rate>] [-p <port>] [--json]")
+	os.Exit(1)
+}
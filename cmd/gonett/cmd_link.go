@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"gonett/internal/daemon"
+	"gonett/internal/topology"
+)
+
+func cmdLink() {
+	if len(os.Args) < 3 {
+		linkUsage()
+	}
+
+	switch os.Args[2] {
+	case "add":
+		cmdLinkAdd(os.Args[3:])
+	case "rm", "remove":
+		cmdLinkRemove(os.Args[3:])
+	case "up", "down":
+		cmdLinkState(os.Args[3:], os.Args[2] == "up")
+	default:
+		linkUsage()
+	}
+}
+
+func cmdLinkAdd(args []string) {
+	if len(args) < 2 {
+		linkUsage()
+	}
+	req := daemon.LinkRequest{NodeA: args[0], NodeB: args[1]}
+
+	for i := 2; i < len(args); i++ {
+		if i+1 >= len(args) {
+			linkUsage()
+		}
+		value := args[i+1]
+		switch args[i] {
+		case "--ip-a":
+			req.IPA = value
+		case "--ip-b":
+			req.IPB = value
+		case "--ip6-a":
+			req.IP6A = value
+		case "--ip6-b":
+			req.IP6B = value
+		case "--mtu":
+			mtu, err := strconv.Atoi(value)
+			if err != nil || mtu <= 0 {
+				fmt.Printf("Error: invalid MTU %q\n", value)
+				os.Exit(1)
+			}
+			req.MTU = mtu
+		default:
+			linkUsage()
+		}
+		i++
+	}
+
+	var link *daemon.LinkRequest
+	var err error
+	if client := daemonClient(); client != nil {
+		link, err = client.AddLink(req)
+	} else {
+		link, err = addLinkLocally(req)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("✓ Link added: %s:%s <--> %s:%s\n", link.NodeA, link.IfNameA, link.NodeB, link.IfNameB)
+}
+
+// addLinkLocally adds a link without the daemon
+func addLinkLocally(req daemon.LinkRequest) (*daemon.LinkRequest, error) {
+	defer lockStore()()
+
+	builder, err := topology.NewBuilderWithOptions(topology.Options{})
+	if err != nil {
+		return nil, err
+	}
+
+	link, err := builder.AddLink(topology.Link{
+		NodeA: req.NodeA,
+		NodeB: req.NodeB,
+		IPA:   req.IPA,
+		IPB:   req.IPB,
+		IP6A:  req.IP6A,
+		IP6B:  req.IP6B,
+		MTU:   req.MTU,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req.IfNameA, req.IfNameB = link.IfNameA, link.IfNameB
+	req.PortA, req.PortB = link.PortA, link.PortB
+	return &req, nil
+}
+
+func cmdLinkRemove(args []string) {
+	if len(args) != 2 {
+		linkUsage()
+	}
+	target, ifName := args[0], args[1]
+
+	var err error
+	if client := daemonClient(); client != nil {
+		err = client.RemoveLink(target, ifName)
+	} else {
+		unlock := lockStore()
+		cm := newContainerManager()
+		container, findErr := findContainer(cm, target)
+		if err = findErr; err == nil {
+			err = cm.RemoveLink(container, ifName)
+		}
+		unlock()
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("✓ Link %s removed from %s\n", ifName, target)
+}
+
+func cmdLinkState(args []string, up bool) {
+	if len(args) != 2 {
+		linkUsage()
+	}
+	target, ifName := args[0], args[1]
+
+	var err error
+	if client := daemonClient(); client != nil {
+		err = client.SetLinkState(target, ifName, up)
+	} else {
+		unlock := lockStore()
+		cm := newContainerManager()
+		container, findErr := findContainer(cm, target)
+		if err = findErr; err == nil {
+			err = cm.SetLinkState(container, ifName, up)
+		}
+		unlock()
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	state := "down"
+	if up {
+		state = "up"
+	}
+	fmt.Printf("✓ %s on %s is %s\n", ifName, target, state)
+}
+
+func linkUsage() {
+	fmt.Println("Usage:")
+	fmt.Println("  gonett link add <node-a> <node-b> [--ip-a <cidr>] [--ip-b <cidr>] [--ip6-a <cidr>] [--ip6-b <cidr>] [--mtu <n>]")
+	fmt.Println("  gonett link rm <node> <iface>")
+	fmt.Println("  gonett link up|down <node> <iface>")
+	os.Exit(1)
+}
@@ -2,29 +2,20 @@ package main
 
 import (
 	"fmt"
-	"log"
 
-	"gonett/internal/container/manager"
-	"gonett/internal/container/repository"
+	"gonett/internal/container/domain"
 )
 
 func cmdList() {
-	// Initialize repositories
-	repos, err := repository.InitializeRepositories()
-	if err != nil {
-		log.Fatalf("Failed to initialize repositories: %v", err)
-	}
-
-	// Create container manager
-	cm := manager.NewContainerManager(
-		repos.ContainerRepo,
-		repos.NamespaceRepo,
-		repos.BridgeRepo,
-		repos.VethRepo,
-	)
+	var containers []*domain.Container
+	var err error
 
 	// Get all containers
-	containers, err := cm.ListContainers()
+	if client := daemonClient(); client != nil {
+		containers, err = client.Containers()
+	} else {
+		containers, err = newContainerManager().ListContainers()
+	}
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		return
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gonett/internal/container/domain"
+)
+
+func cmdMirror() {
+	if len(os.Args) < 3 {
+		mirrorUsage()
+	}
+
+	switch os.Args[2] {
+	case "add":
+		cmdMirrorAdd(os.Args[3:])
+	case "rm", "remove":
+		cmdMirrorRemove(os.Args[3:])
+	case "ls", "list":
+		cmdMirrorList(os.Args[3:])
+	default:
+		mirrorUsage()
+	}
+}
+
+func cmdMirrorAdd(args []string) {
+	if len(args) < 2 {
+		mirrorUsage()
+	}
+	target := args[0]
+	mirror := domain.Mirror{Name: args[1]}
+
+	for i := 2; i < len(args); i++ {
+		if i+1 >= len(args) {
+			mirrorUsage()
+		}
+		switch args[i] {
+		case "--src":
+			mirror.Sources = append(mirror.Sources, strings.Split(args[i+1], ",")...)
+		case "--dst":
+			mirror.Monitor = args[i+1]
+		case "--direction":
+			mirror.Direction = args[i+1]
+		default:
+			mirrorUsage()
+		}
+		i++
+	}
+	if len(mirror.Sources) == 0 || mirror.Monitor == "" {
+		mirrorUsage()
+	}
+
+	// Mirrors are changed directly even while gonettd runs
+	defer lockStore()()
+
+	cm := newContainerManager()
+
+	container, err := findContainer(cm, target)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := cm.AddMirror(container, mirror); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("✓ Mirror '%s' on %s: %s -> %s\n", mirror.Name, container.Name, strings.Join(mirror.Sources, ","), mirror.Monitor)
+}
+
+func cmdMirrorRemove(args []string) {
+	if len(args) != 2 {
+		mirrorUsage()
+	}
+
+	defer lockStore()()
+
+	cm := newContainerManager()
+
+	container, err := findContainer(cm, args[0])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := cm.RemoveMirror(container, args[1]); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("✓ Mirror '%s' removed from %s\n", args[1], container.Name)
+}
+
+func cmdMirrorList(args []string) {
+	if len(args) > 1 {
+		mirrorUsage()
+	}
+
+	cm := newContainerManager()
+
+	var containers []*domain.Container
+	if len(args) == 1 {
+		container, err := findContainer(cm, args[0])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		containers = append(containers, container)
+	} else {
+		all, err := cm.ListContainers()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		containers = all
+		sort.Slice(containers, func(i, j int) bool { return containers[i].Name < containers[j].Name })
+	}
+
+	fmt.Printf("%-12s  %-12s  %-16s  %-9s  %-16s  %s\n", "SWITCH", "MIRROR", "BRIDGE", "DIRECTION", "MONITOR", "SOURCES")
+	for _, c := range containers {
+		for _, bridge := range c.Bridges {
+			for _, m := range bridge.Mirrors {
+				fmt.Printf("%-12s  %-12s  %-16s  %-9s  %-16s  %s%s\n",
+					c.Name, m.Name, bridge.Name, m.Direction, m.Monitor, strings.Join(m.Sources, ","), mirrorState(&bridge, m))
+			}
+		}
+	}
+}
+
+// mirrorState flags a mirror whose filters are missing from the kernel
+func mirrorState(bridge *domain.Bridge, m domain.Mirror) string {
+	if bridge.MirrorActive(m) {
+		return ""
+	}
+	return "  (inactive)"
+}
+
+func mirrorUsage() {
+	fmt.Println("Usage:")
+	fmt.Println("  gonett mirror add <switch> <name> --src <port>[,<port>...] --dst <port> [--direction ingress|egress|both]")
+	fmt.Println("  gonett mirror rm <switch> <name>")
+	fmt.Println("  gonett mirror ls [<switch>]")
+	os.Exit(1)
+}
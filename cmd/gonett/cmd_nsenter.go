@@ -3,9 +3,13 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"runtime"
 	"syscall"
 
+	"gonett/internal/container/domain"
+
 	"golang.org/x/sys/unix"
 )
 
@@ -36,6 +40,12 @@ func cmdNsenter() {
 		os.Exit(1)
 	}
 
+	// Use the namespace's resolv.conf and other /etc/netns files
+	if err := domain.BindEtc(filepath.Join(domain.NetnsEtcDir, filepath.Base(nsPath))); err != nil {
+		fmt.Printf("Error mounting namespace files: %v\n", err)
+		os.Exit(1)
+	}
+
 	// Set up environment
 	ps1 := fmt.Sprintf("gonett@%s:\\w $ ", containerName)
 	os.Setenv("PS1", ps1)
@@ -52,3 +62,31 @@ func cmdNsenter() {
 		os.Exit(1)
 	}
 }
+
+// cmdNsexec runs a command for gonett exec after bind mounting the
+// namespace's /etc/netns files. The parent already placed this process in
+// the container's network namespace and a private mount namespace.
+func cmdNsexec() {
+	if len(os.Args) < 4 {
+		fmt.Println("Internal error: missing arguments for nsexec")
+		os.Exit(1)
+	}
+
+	etcDir, command := os.Args[2], os.Args[3:]
+
+	if err := domain.BindEtc(etcDir); err != nil {
+		fmt.Printf("Error mounting namespace files: %v\n", err)
+		os.Exit(1)
+	}
+
+	path, err := exec.LookPath(command[0])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(127)
+	}
+
+	if err := syscall.Exec(path, command, os.Environ()); err != nil {
+		fmt.Printf("Error executing %s: %v\n", command[0], err)
+		os.Exit(1)
+	}
+}
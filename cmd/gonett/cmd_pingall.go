@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"time"
+
+	"gonett/internal/container/domain"
+	"gonett/internal/ping"
+)
+
+// pingTimeout bounds each echo request sent by pingall
+const pingTimeout = time.Second
+
+func cmdPingAll() {
+	ipv6 := false
+	for _, arg := range os.Args[2:] {
+		switch arg {
+		case "-6":
+			ipv6 = true
+		case "-4":
+			ipv6 = false
+		default:
+			fmt.Println("Usage: gonett pingall [-4|-6]")
+			os.Exit(1)
+		}
+	}
+
+	cm := newContainerManager()
+
+	containers, err := cm.ListContainers()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var hosts []*domain.Container
+	for _, c := range containers {
+		if c.Type == "host" && c.Namespace != nil {
+			hosts = append(hosts, c)
+		}
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Name < hosts[j].Name })
+
+	family := "IPv4"
+	if ipv6 {
+		family = "IPv6"
+	}
+	fmt.Printf("*** Ping: testing %s reachability\n", family)
+
+	sent, received := 0, 0
+	for _, src := range hosts {
+		fmt.Printf("%s -> ", src.Name)
+		for _, dst := range hosts {
+			if dst == src {
+				continue
+			}
+
+			target := pingTarget(dst, ipv6)
+			if target == nil {
+				fmt.Print("- ")
+				continue
+			}
+
+			sent++
+			if _, err := ping.Echo(src.Namespace, net.IPAddr{IP: target}, pingTimeout); err != nil {
+				fmt.Print("X ")
+				continue
+			}
+			received++
+			fmt.Printf("%s ", dst.Name)
+		}
+		fmt.Println()
+	}
+
+	dropped := 0
+	if sent > 0 {
+		dropped = (sent - received) * 100 / sent
+	}
+	fmt.Printf("*** Results: %d%% dropped (%d/%d received)\n", dropped, received, sent)
+}
+
+// pingTarget returns the first global address of the requested family
+// recorded on a container. Link-local addresses are skipped: they are only
+// meaningful together with the sender's outgoing interface.
+func pingTarget(c *domain.Container, ipv6 bool) net.IP {
+	for _, addr := range c.Addresses() {
+		ip, _, err := net.ParseCIDR(addr)
+		if err != nil || (ip.To4() == nil) != ipv6 || ip.IsLinkLocalUnicast() {
+			continue
+		}
+		return ip
+	}
+	return nil
+}
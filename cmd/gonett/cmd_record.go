@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gonett/internal/stats"
+)
+
+// defaultRecordInterval is the sampling interval of gonett record
+const defaultRecordInterval = time.Second
+
+func cmdRecord() {
+	opts := stats.RecordOptions{Interval: defaultRecordInterval}
+	var targets []string
+	lab, output := "", ""
+
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--interval", "-i", "-o", "--format", "-d", "--lab":
+			if i+1 >= len(args) {
+				recordUsage()
+			}
+			flag, value := args[i], args[i+1]
+			i++
+			var err error
+			switch flag {
+			case "--interval", "-i":
+				opts.Interval, err = parseDuration(value)
+			case "-d":
+				opts.Duration, err = parseDuration(value)
+			case "-o":
+				output = value
+			case "--format":
+				opts.Format = value
+			case "--lab":
+				lab = value
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		default:
+			if strings.HasPrefix(args[i], "-") {
+				recordUsage()
+			}
+			targets = append(targets, args[i])
+		}
+	}
+	if output == "" {
+		recordUsage()
+	}
+	if opts.Format == "" {
+		switch filepath.Ext(output) {
+		case ".jsonl", ".ndjson":
+			opts.Format = stats.FormatJSONL
+		default:
+			opts.Format = stats.FormatCSV
+		}
+	}
+
+	// node:iface targets narrow a node down to the named interfaces
+	var nodes []string
+	wanted := make(map[string]bool)
+	for _, target := range targets {
+		node, iface, ok := strings.Cut(target, ":")
+		nodes = append(nodes, node)
+		if ok {
+			wanted[node+":"+iface] = true
+		}
+	}
+	opts.Select = func(iface stats.Interface) bool {
+		if !hasInterfaceFilter(wanted, iface.Node) {
+			return true
+		}
+		return wanted[iface.Node+":"+iface.Interface]
+	}
+
+	containers, err := selectContainers(newContainerManager(), nodes, lab)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var w io.Writer = os.Stdout
+	if output != "-" {
+		f, err := os.Create(output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	fmt.Fprintf(os.Stderr, "Recording every %s to %s (Ctrl-C to stop)\n", opts.Interval, output)
+
+	opts.Warn = func(w string) { printWarnings([]string{w}) }
+
+	stop := make(chan struct{})
+	stopOnSignal(func() { close(stop) })
+
+	rounds, err := stats.Record(containers, w, opts, stop)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "✓ %d samples recorded\n", rounds)
+}
+
+// hasInterfaceFilter reports whether any node:iface target names the node
+func hasInterfaceFilter(wanted map[string]bool, node string) bool {
+	for key := range wanted {
+		if strings.HasPrefix(key, node+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDuration accepts Go durations ("100ms") and plain seconds ("2.5")
+func parseDuration(value string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return d, nil
+}
+
+func recordUsage() {
+	fmt.Println("Usage: gonett record [<node>[:iface]...] [--lab <name>] -o <file|-> [--interval <d>] [-d <duration>] [--format csv|jsonl]")
+	os.Exit(1)
+}
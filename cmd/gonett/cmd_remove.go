@@ -2,13 +2,7 @@ package main
 
 import (
 	"fmt"
-	"log"
 	"os"
-	"strings"
-
-	"gonett/internal/container/domain"
-	"gonett/internal/container/manager"
-	"gonett/internal/container/repository"
 )
 
 func cmdRemove() {
@@ -19,37 +13,24 @@ func cmdRemove() {
 
 	target := os.Args[2]
 
-	// Initialize repositories
-	repos, err := repository.InitializeRepositories()
-	if err != nil {
-		log.Fatalf("Failed to initialize repositories: %v", err)
+	if client := daemonClient(); client != nil {
+		container, err := client.Remove(target)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Deleted container '%s' (ID: %s)\n", container.Name, container.ID[:12])
+		fmt.Println("✓ Deleted")
+		return
 	}
 
-	// Create container manager
-	cm := manager.NewContainerManager(
-		repos.ContainerRepo,
-		repos.NamespaceRepo,
-		repos.BridgeRepo,
-		repos.VethRepo,
-	)
+	defer lockStore()()
 
-	// Get all containers
-	containers, err := cm.ListContainers()
-	if err != nil {
-		fmt.Printf("Error: %v\n", err)
-		return
-	}
+	cm := newContainerManager()
 
 	// Find container by ID or name
-	var container *domain.Container
-	for _, c := range containers {
-		if strings.HasPrefix(c.ID, target) || c.Name == target {
-			container = c
-			break
-		}
-	}
-
-	if container == nil {
+	container, err := findContainer(cm, target)
+	if err != nil {
 		fmt.Printf("Container '%s' not found\n", target)
 		os.Exit(1)
 	}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gonett/internal/topology"
+)
+
+// cmdSave writes a running lab back to a topology file that build -f
+// rebuilds
+func cmdSave() {
+	lab, output := "", "-"
+
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-o":
+			if i+1 >= len(args) {
+				saveUsage()
+			}
+			output = args[i+1]
+			i++
+		default:
+			if strings.HasPrefix(args[i], "-") || lab != "" {
+				saveUsage()
+			}
+			lab = args[i]
+		}
+	}
+	if lab == "" {
+		saveUsage()
+	}
+
+	containers, err := selectContainers(newContainerManager(), nil, lab)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	topo, warnings, err := topology.FromContainers(lab, containers)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	printWarnings(warnings)
+
+	data, err := topo.Marshal()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	header := fmt.Sprintf("# Saved from lab %s on %s\n", lab, time.Now().Format(time.RFC3339))
+	data = append([]byte(header), data...)
+
+	writeOutput(output, data, fmt.Sprintf("Saved lab '%s'", lab))
+}
+
+func saveUsage() {
+	fmt.Println("Usage: gonett save <lab> [-o <file>]")
+	os.Exit(1)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"gonett/internal/daemon"
+)
+
+// defaultAPIListen is the address serve-api listens on
+const defaultAPIListen = "127.0.0.1:9600"
+
+func cmdServeAPI() {
+	listen := defaultAPIListen
+	var token string
+
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--listen", "-l":
+			if i+1 >= len(args) {
+				serveAPIUsage()
+			}
+			i++
+			listen = args[i]
+		case "--token":
+			if i+1 >= len(args) {
+				serveAPIUsage()
+			}
+			i++
+			token = args[i]
+		default:
+			serveAPIUsage()
+		}
+	}
+
+	// A second server would not share the running daemon's lock
+	if socket := daemon.SocketPath(); daemonRunning(socket) {
+		fmt.Printf("Error: gonettd is running on %s, serve the API from it with gonettd --api %s\n", socket, listen)
+		os.Exit(1)
+	}
+
+	server, err := daemon.NewServer()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	token, err = apiToken(token)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("✓ Serving the API on http://%s/api/v1 (spec at /api/v1/openapi.json)\n", listen)
+	if err := http.ListenAndServe(listen, server.APIHandler(token)); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// daemonRunning reports whether gonettd answers on the socket
+func daemonRunning(socket string) bool {
+	_, err := daemon.Dial(socket)
+	return err == nil
+}
+
+// apiToken returns the token given on the command line, the one in
+// GONETT_API_TOKEN, or a new random one it prints
+func apiToken(token string) (string, error) {
+	if token == "" {
+		token = os.Getenv("GONETT_API_TOKEN")
+	}
+	if token != "" {
+		return token, nil
+	}
+
+	token, err := daemon.NewToken()
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("  API token: %s\n", token)
+	return token, nil
+}
+
+func serveAPIUsage() {
+	fmt.Println("Usage: gonett serve-api [--listen <addr>] [--token <token>]")
+	os.Exit(1)
+}
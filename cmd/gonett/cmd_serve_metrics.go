@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"gonett/internal/metrics"
+)
+
+// defaultMetricsListen is the address serve-metrics listens on
+const defaultMetricsListen = ":9500"
+
+func cmdServeMetrics() {
+	listen := defaultMetricsListen
+
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--listen", "-l":
+			if i+1 >= len(args) {
+				serveMetricsUsage()
+			}
+			i++
+			listen = args[i]
+		default:
+			serveMetricsUsage()
+		}
+	}
+
+	cm := newContainerManager()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler(cm.ListContainers))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, "gonett metrics are served at /metrics")
+	})
+
+	fmt.Printf("✓ Serving metrics on %s/metrics\n", listen)
+	if err := http.ListenAndServe(listen, mux); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func serveMetricsUsage() {
+	fmt.Println("Usage: gonett serve-metrics [--listen <addr>]")
+	os.Exit(1)
+}
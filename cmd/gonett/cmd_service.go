@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"gonett/internal/container/repository"
+	"gonett/internal/dhcp"
+	"gonett/internal/dns"
+)
+
+// cmdService runs a background service started by the builder through
+// Container.StartService. The process already lives in the container's
+// namespace; it runs until it receives SIGTERM.
+func cmdService() {
+	if len(os.Args) < 4 {
+		log.Fatal("internal error: missing arguments for service")
+	}
+
+	name, config := os.Args[2], os.Args[3]
+
+	switch name {
+	case "dhcpd":
+		var cfg dhcp.ServerConfig
+		if err := json.Unmarshal([]byte(config), &cfg); err != nil {
+			log.Fatalf("decode dhcp server config: %v", err)
+		}
+
+		server, err := dhcp.NewServer(cfg)
+		if err != nil {
+			log.Fatalf("dhcp server: %v", err)
+		}
+
+		stopOnSignal(func() { server.Close() })
+		if err := server.Serve(); err != nil {
+			log.Fatalf("dhcp server: %v", err)
+		}
+	case "dns":
+		var cfg dns.ServerConfig
+		if err := json.Unmarshal([]byte(config), &cfg); err != nil {
+			log.Fatalf("decode dns server config: %v", err)
+		}
+
+		server, err := dns.NewServer(cfg, labRecords(cfg.Lab))
+		if err != nil {
+			log.Fatalf("dns server: %v", err)
+		}
+
+		stopOnSignal(func() { server.Close() })
+		if err := server.Serve(); err != nil {
+			log.Fatalf("dns server: %v", err)
+		}
+	default:
+		log.Fatalf("unknown service %q", name)
+	}
+}
+
+// labRecords reads the addresses of a lab's nodes from the repository, so
+// the DNS server follows nodes and leases added after it started
+func labRecords(lab string) dns.Records {
+	return func() (map[string][]net.IP, error) {
+		repos, err := repository.InitializeRepositories()
+		if err != nil {
+			return nil, err
+		}
+		containers, err := repos.ContainerRepo.List()
+		if err != nil {
+			return nil, err
+		}
+
+		records := make(map[string][]net.IP)
+		for _, c := range containers {
+			if c.Lab != lab {
+				continue
+			}
+			for _, addr := range c.Addresses() {
+				if ip, _, err := net.ParseCIDR(addr); err == nil {
+					records[c.Name] = append(records[c.Name], ip)
+				}
+			}
+		}
+		return records, nil
+	}
+}
+
+// stopOnSignal calls stop when the process receives SIGTERM or SIGINT
+func stopOnSignal(stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		<-signals
+		stop()
+	}()
+}
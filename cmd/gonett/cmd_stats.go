@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gonett/internal/container/domain"
+	"gonett/internal/container/manager"
+	"gonett/internal/stats"
+)
+
+// defaultTopInterval is how often gonett top refreshes
+const defaultTopInterval = time.Second
+
+func cmdStats() {
+	var nodes []string
+	lab, asJSON := "", false
+
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--json":
+			asJSON = true
+		case "--lab":
+			if i+1 >= len(args) {
+				statsUsage()
+			}
+			i++
+			lab = args[i]
+		default:
+			if strings.HasPrefix(args[i], "-") {
+				statsUsage()
+			}
+			nodes = append(nodes, args[i])
+		}
+	}
+
+	containers, err := selectContainers(newContainerManager(), nodes, lab)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	snap := stats.Collect(containers)
+
+	if asJSON {
+		out, _ := json.MarshalIndent(snap, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+
+	printWarnings(snap.Warnings())
+	fmt.Printf("%-10s  %-16s  %12s  %10s  %7s  %7s  %12s  %10s  %7s  %7s\n",
+		"NODE", "INTERFACE", "RX BYTES", "RX PKTS", "RX DROP", "RX ERR", "TX BYTES", "TX PKTS", "TX DROP", "TX ERR")
+	for _, iface := range snap.Interfaces {
+		fmt.Printf("%-10s  %-16s  %12d  %10d  %7d  %7d  %12d  %10d  %7d  %7d\n",
+			iface.Node, iface.Interface,
+			iface.RxBytes, iface.RxPackets, iface.RxDropped, iface.RxErrors,
+			iface.TxBytes, iface.TxPackets, iface.TxDropped, iface.TxErrors)
+		for _, q := range iface.Qdiscs {
+			// noqueue never holds packets; listing it on every veth is noise
+			if q.Kind == "noqueue" {
+				continue
+			}
+			fmt.Printf("%-10s    qdisc %s %s parent %s  sent %d bytes %d pkts  dropped %d  overlimits %d  requeues %d  backlog %db %dp\n",
+				"", q.Kind, q.Handle, q.Parent, q.Bytes, q.Packets, q.Drops, q.Overlimits, q.Requeues, q.Backlog, q.Qlen)
+		}
+	}
+}
+
+func cmdTop() {
+	var nodes []string
+	lab := ""
+	interval := defaultTopInterval
+
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--lab", "-n":
+			if i+1 >= len(args) {
+				topUsage()
+			}
+			flag, value := args[i], args[i+1]
+			i++
+			if flag == "--lab" {
+				lab = value
+				continue
+			}
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds <= 0 {
+				fmt.Printf("Error: invalid interval %q\n", value)
+				os.Exit(1)
+			}
+			interval = time.Duration(seconds * float64(time.Second))
+		default:
+			if strings.HasPrefix(args[i], "-") {
+				topUsage()
+			}
+			nodes = append(nodes, args[i])
+		}
+	}
+
+	cm := newContainerManager()
+
+	var prev *stats.Snapshot
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		// Re-list every round so nodes added or removed show up
+		containers, err := selectContainers(cm, nodes, lab)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		snap := stats.Collect(containers)
+
+		if prev != nil {
+			printTop(snap, snap.Rates(prev), interval)
+		}
+		prev = snap
+	}
+}
+
+// printTop redraws the screen with interfaces sorted by throughput
+func printTop(snap *stats.Snapshot, rates []stats.Rate, interval time.Duration) {
+	fmt.Print("\033[H\033[2J")
+	fmt.Printf("gonett top - %s, every %s, %d interfaces (Ctrl-C to quit)\n\n", snap.Time.Format("15:04:05"), interval, len(rates))
+	fmt.Printf("%-10s  %-16s  %16s  %16s  %10s  %10s  %7s  %9s\n",
+		"NODE", "INTERFACE", "RX", "TX", "RX PPS", "TX PPS", "DROPS", "BACKLOG")
+	for _, r := range rates {
+		fmt.Printf("%-10s  %-16s  %16s  %16s  %10.0f  %10.0f  %7d  %9s\n",
+			r.Node, r.Interface, formatRate(r.RxBps), formatRate(r.TxBps), r.RxPps, r.TxPps, r.Drops, fmt.Sprintf("%db", r.Backlog))
+	}
+	if warnings := snap.Warnings(); len(warnings) > 0 {
+		fmt.Println()
+		for _, w := range warnings {
+			fmt.Printf("Warning: %s\n", w)
+		}
+	}
+}
+
+// selectContainers returns the named containers, or every container
+// (optionally only those of one lab) when no names are given
+func selectContainers(cm *manager.ContainerManager, names []string, lab string) ([]*domain.Container, error) {
+	if len(names) > 0 {
+		var containers []*domain.Container
+		for _, name := range names {
+			c, err := findContainer(cm, name)
+			if err != nil {
+				return nil, err
+			}
+			containers = append(containers, c)
+		}
+		return containers, nil
+	}
+
+	all, err := cm.ListContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	var containers []*domain.Container
+	for _, c := range all {
+		if lab == "" || c.Lab == lab {
+			containers = append(containers, c)
+		}
+	}
+	sort.Slice(containers, func(i, j int) bool { return containers[i].Name < containers[j].Name })
+	return containers, nil
+}
+
+func statsUsage() {
+	fmt.Println("Usage: gonett stats [<node>...] [--lab <name>] [--json]")
+	os.Exit(1)
+}
+
+func topUsage() {
+	fmt.Println("Usage: gonett top [<node>...] [--lab <name>] [-n <seconds>]")
+	os.Exit(1)
+}
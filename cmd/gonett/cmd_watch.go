@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gonett/internal/container/domain"
+	"gonett/internal/container/repository"
+	"gonett/internal/watch"
+)
+
+func cmdWatch() {
+	opts := watch.Options{Out: os.Stdout}
+	var nodes []string
+	lab := ""
+
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--heal":
+			opts.Heal = true
+		case "-v", "--verbose":
+			opts.Verbose = true
+		case "--interval", "-i", "--lab":
+			if i+1 >= len(args) {
+				watchUsage()
+			}
+			flag, value := args[i], args[i+1]
+			i++
+			switch flag {
+			case "--interval", "-i":
+				d, err := parseDuration(value)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				opts.Interval = d
+			case "--lab":
+				lab = value
+			}
+		default:
+			if strings.HasPrefix(args[i], "-") {
+				watchUsage()
+			}
+			nodes = append(nodes, args[i])
+		}
+	}
+
+	cm := newContainerManager()
+
+	// Resolve named nodes once; their records are re-read on every check
+	containers, err := selectContainers(cm, nodes, lab)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(containers) == 0 {
+		fmt.Println("No containers to watch")
+		return
+	}
+	watched := make(map[string]bool)
+	for _, c := range containers {
+		watched[c.ID] = true
+	}
+	opts.Load = cm.ListContainers
+	opts.Lock = &repository.StoreLock{}
+	opts.Select = func(c *domain.Container) bool {
+		if len(nodes) > 0 {
+			return watched[c.ID]
+		}
+		return lab == "" || c.Lab == lab
+	}
+
+	mode := "logging"
+	if opts.Heal {
+		mode = "healing"
+	}
+	fmt.Printf("Watching %d node(s), %s drift (Ctrl-C to stop)\n", len(containers), mode)
+
+	stop := make(chan struct{})
+	stopOnSignal(func() { close(stop) })
+
+	if err := watch.Watch(opts, stop); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func watchUsage() {
+	fmt.Println("Usage: gonett watch [<node>...] [--lab <name>] [--heal] [--interval <d>] [-v]")
+	os.Exit(1)
+}
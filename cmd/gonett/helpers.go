@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"gonett/internal/container/domain"
+	"gonett/internal/container/manager"
+	"gonett/internal/container/repository"
+	"gonett/internal/daemon"
+)
+
+// newContainerManager initializes the repositories and returns a container manager
+func newContainerManager() *manager.ContainerManager {
+	repos, err := repository.InitializeRepositories()
+	if err != nil {
+		log.Fatalf("Failed to initialize repositories: %v", err)
+	}
+
+	return manager.NewContainerManager(
+		repos.ContainerRepo,
+		repos.NamespaceRepo,
+		repos.BridgeRepo,
+		repos.VethRepo,
+	)
+}
+
+// findContainer looks up a container by ID prefix or name
+func findContainer(cm *manager.ContainerManager, target string) (*domain.Container, error) {
+	containers, err := cm.ListContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range containers {
+		if strings.HasPrefix(c.ID, target) || c.Name == target {
+			return c, nil
+		}
+	}
+
+	return nil, fmt.Errorf("container '%s' not found", target)
+}
+
+// lockStore takes the store lock for a command changing the repositories
+// without gonettd, so it never interleaves with the daemon or another
+// command. Exiting the process releases it too.
+func lockStore() func() {
+	lock := &repository.StoreLock{}
+	lock.Lock()
+	return lock.Unlock
+}
+
+// daemonClient returns a client for gonettd when it is running, so commands
+// it serves go through it. Setting GONETT_NO_DAEMON works on the
+// repositories directly.
+func daemonClient() *daemon.Client {
+	if os.Getenv("GONETT_NO_DAEMON") != "" {
+		return nil
+	}
+
+	client, err := daemon.Dial(daemon.SocketPath())
+	if err != nil {
+		return nil
+	}
+	return client
+}
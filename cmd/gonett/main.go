@@ -3,15 +3,21 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+
+	"gonett/internal/container/domain"
 )
 
 func main() {
-	if len(os.Args) < 2 {
+	if len(os.Args) < 2 && filepath.Base(os.Args[0]) != "gonettd" {
 		printUsage()
 		os.Exit(1)
 	}
 
-	command := os.Args[1]
+	var command string
+	if len(os.Args) >= 2 {
+		command = os.Args[1]
+	}
 
 	// Handle internal nsenter command (used by attach)
 	if command == "__gonett_nsenter__" {
@@ -19,17 +25,69 @@ func main() {
 		return
 	}
 
+	// Handle internal nsexec command (used by exec with /etc/netns files)
+	if command == domain.NsexecCommand {
+		cmdNsexec()
+		return
+	}
+
+	// Handle internal service command (background services started by build)
+	if command == domain.ServiceCommand {
+		cmdService()
+		return
+	}
+
+	// Run as the daemon when invoked through a gonettd link
+	if filepath.Base(os.Args[0]) == "gonettd" {
+		cmdDaemon(os.Args[1:])
+		return
+	}
+
 	switch command {
 	case "ls", "list":
 		cmdList()
 	case "rm", "remove":
 		cmdRemove()
+	case "inspect":
+		cmdInspect()
 	case "attach":
 		cmdAttach()
 	case "exec":
 		cmdExec()
 	case "build":
 		cmdBuild()
+	case "pingall":
+		cmdPingAll()
+	case "iperf":
+		cmdIperf()
+	case "capture":
+		cmdCapture()
+	case "mirror":
+		cmdMirror()
+	case "stats":
+		cmdStats()
+	case "top":
+		cmdTop()
+	case "record":
+		cmdRecord()
+	case "serve-metrics":
+		cmdServeMetrics()
+	case "serve-api":
+		cmdServeAPI()
+	case "link":
+		cmdLink()
+	case "watch":
+		cmdWatch()
+	case "graph":
+		cmdGraph()
+	case "import":
+		cmdImport()
+	case "export":
+		cmdExport()
+	case "save":
+		cmdSave()
+	case "daemon":
+		cmdDaemon(os.Args[2:])
 	case "cleanup":
 		cmdCleanup()
 	case "help", "--help", "-h":
@@ -47,16 +105,59 @@ func printUsage() {
 	fmt.Println("Usage:")
 	fmt.Println("  gonett ls                    List all containers")
 	fmt.Println("  gonett rm <id>               Remove a container")
+	fmt.Println("  gonett inspect <id>          Show container details and port map")
 	fmt.Println("  gonett attach <id>           Attach to container shell")
 	fmt.Println("  gonett exec <id> <command>   Execute command in container")
-	fmt.Println("  gonett build                 Build topology from main.go")
+	fmt.Println("  gonett build [-f <file>] [--auto-mac] [--static-arp]")
+	fmt.Println("                               Build a topology file (YAML, GraphML or containerlab) or the sample topology")
+	fmt.Println("  gonett pingall [-6]          Test reachability between all hosts")
+	fmt.Println("  gonett iperf <client> <server> [-u] [-t <s>] [-P <n>] [-b <rate>] [--json]")
+	fmt.Println("                               Measure bandwidth between two nodes")
+	fmt.Println("  gonett capture <node>[:iface] | <a>-<b> -w <file> [-f <filter>] [-s <snaplen>] [-c <n>] [-d <s>]")
+	fmt.Println("                               Capture packets to a pcapng file")
+	fmt.Println("  gonett mirror add|rm|ls      Manage port mirrors on switches")
+	fmt.Println("  gonett stats [<node>...] [--lab <name>] [--json]")
+	fmt.Println("                               Show interface and qdisc counters")
+	fmt.Println("  gonett top [<node>...] [--lab <name>] [-n <seconds>]")
+	fmt.Println("                               Live interface rates sorted by throughput")
+	fmt.Println("  gonett record [<node>[:iface]...] -o <file> [--interval <d>] [-d <duration>]")
+	fmt.Println("                               Record interface counters to CSV or JSON Lines")
+	fmt.Println("  gonett serve-metrics [--listen :9500]")
+	fmt.Println("                               Serve lab metrics in Prometheus format")
+	fmt.Println("  gonett serve-api [--listen 127.0.0.1:9600] [--token <token>]")
+	fmt.Println("                               Serve the REST API with token authentication")
+	fmt.Println("  gonett link add <a> <b> [--ip-a <cidr>] [--ip-b <cidr>] [--mtu <n>]")
+	fmt.Println("  gonett link rm|up|down <node> <iface>")
+	fmt.Println("                               Change links of a running lab")
+	fmt.Println("  gonett watch [<node>...] [--lab <name>] [--heal] [--interval <d>] [-v]")
+	fmt.Println("                               Log drift from the recorded topology and optionally heal it")
+	fmt.Println("  gonett graph [--lab <name>] [--format dot|mermaid|json] [-o <file>]")
+	fmt.Println("                               Draw the running labs")
+	fmt.Println("  gonett import <file> [-o <file>] [--mode router|switch] [--hosts <n>]")
+	fmt.Println("                               Convert a GraphML (Topology Zoo) or containerlab file to a topology file")
+	fmt.Println("  gonett export <file> [-o <file>] [--image <image>]")
+	fmt.Println("                               Convert a topology file to containerlab YAML")
+	fmt.Println("  gonett save <lab> [-o <file>]")
+	fmt.Println("                               Write a running lab back to a topology file")
+	fmt.Println("  gonett daemon [--socket <path>] [--api <addr>] [--watch] [--heal]")
+	fmt.Println("                               Run gonettd; ls, rm, exec, build, link and cleanup use it")
 	fmt.Println("  gonett cleanup               Remove all containers")
 	fmt.Println("  gonett help                  Show this help message")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  gonett ls")
+	fmt.Println("  gonett build -f lab.yaml")
 	fmt.Println("  gonett attach h1")
 	fmt.Println("  gonett attach b819")
 	fmt.Println("  gonett exec h1 ip addr show")
+	fmt.Println("  gonett inspect s1")
+	fmt.Println("  gonett iperf h1 h2 -u -b 10M")
+	fmt.Println("  gonett record h1:h1-eth1 s1 --interval 100ms -d 10s -o run.csv")
+	fmt.Println("  gonett mirror add s1 span --src s1-eth1 --dst s1-eth3")
+	fmt.Println("  gonett capture h1-s1 -w h1.pcapng -f \"icmp or arp\"")
+	fmt.Println("  gonett link add h1 s1 --ip-a 10.0.1.1/24")
+	fmt.Println("  gonett watch --lab demo --heal")
+	fmt.Println("  gonett graph --lab demo | dot -Tsvg > demo.svg")
+	fmt.Println("  gonett save demo -o demo.yaml")
 	fmt.Println("  gonett rm h1")
 }
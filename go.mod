@@ -9,3 +9,5 @@ require (
 	github.com/vishvananda/netns v0.0.5
 	golang.org/x/sys v0.39.0
 )
+
+require gopkg.in/yaml.v3 v3.0.1
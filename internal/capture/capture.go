@@ -0,0 +1,319 @@
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+	"unsafe"
+
+	"gonett/internal/container/domain"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// DefaultSnaplen captures whole packets, like tcpdump
+const DefaultSnaplen = 262144
+
+// receiveBuffer absorbs bursts while the writer catches up
+const receiveBuffer = 8 << 20
+
+// pollInterval bounds how long a reader blocks before checking for stop
+const pollInterval = 100 * time.Millisecond
+
+// Interface is one interface to capture on
+type Interface struct {
+	Namespace   *domain.Namespace // Nil for the root namespace
+	Name        string
+	Description string
+}
+
+// Options configures a capture. Zero Count and Duration capture until stop
+// is closed.
+type Options struct {
+	Filter   string
+	Snaplen  int
+	Count    int
+	Duration time.Duration
+}
+
+// Stats summarizes a finished capture
+type Stats struct {
+	Captured int    // Packets written to the file
+	Received uint32 // Packets the kernel passed the filter
+	Dropped  uint32 // Packets the kernel dropped for lack of buffer space
+}
+
+// socket is an AF_PACKET socket bound to one interface
+type socket struct {
+	fd       int
+	id       uint32
+	linkType int
+}
+
+// packet is one received frame waiting to be written
+type packet struct {
+	iface    uint32
+	ts       time.Time
+	data     []byte
+	origLen  int
+	outbound bool
+}
+
+// Interfaces lists the interfaces of a namespace worth capturing on:
+// everything except loopback and bridge devices, whose traffic already
+// shows up on the bridge ports
+func Interfaces(ns *domain.Namespace) ([]string, error) {
+	var names []string
+	err := ns.Run(func() error {
+		links, err := netlink.LinkList()
+		if err != nil {
+			return err
+		}
+		for _, link := range links {
+			if link.Type() == "bridge" || link.Attrs().Flags&net.FlagLoopback != 0 {
+				continue
+			}
+			names = append(names, link.Attrs().Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list interfaces: %w", err)
+	}
+	return names, nil
+}
+
+// Capture records packets from all interfaces into a single pcapng stream
+// until the count or duration is reached or stop is closed
+func Capture(ifaces []Interface, w io.Writer, opts Options, stop <-chan struct{}) (*Stats, error) {
+	if opts.Snaplen <= 0 {
+		opts.Snaplen = DefaultSnaplen
+	}
+
+	var sockets []*socket
+	defer func() {
+		for _, s := range sockets {
+			unix.Close(s.fd)
+		}
+	}()
+	for _, iface := range ifaces {
+		s, err := openSocket(iface, opts)
+		if err != nil {
+			return nil, err
+		}
+		sockets = append(sockets, s)
+	}
+
+	pw, err := NewPcapngWriter(w)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write capture header: %w", err)
+	}
+	for i, s := range sockets {
+		s.id, err = pw.AddInterface(ifaces[i].Name, ifaces[i].Description, uint16(s.linkType), uint32(opts.Snaplen))
+		if err != nil {
+			return nil, fmt.Errorf("failed to write interface description: %w", err)
+		}
+	}
+
+	done := make(chan struct{})
+	packets := make(chan packet, 1024)
+	errs := make(chan error, len(sockets))
+	var wg sync.WaitGroup
+	for _, s := range sockets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.read(opts.Snaplen, packets, done); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(packets)
+	}()
+
+	var timeout <-chan time.Time
+	if opts.Duration > 0 {
+		timeout = time.After(opts.Duration)
+	}
+
+	stats := &Stats{}
+	var writeErr error
+	finish := sync.OnceFunc(func() { close(done) })
+loop:
+	for {
+		select {
+		case p, ok := <-packets:
+			if !ok {
+				break loop
+			}
+			if writeErr != nil || (opts.Count > 0 && stats.Captured >= opts.Count) {
+				continue
+			}
+			if writeErr = pw.WritePacket(p.iface, p.ts, p.data, p.origLen, p.outbound); writeErr != nil {
+				finish()
+				continue
+			}
+			stats.Captured++
+			if opts.Count > 0 && stats.Captured >= opts.Count {
+				finish()
+			}
+		case <-timeout:
+			finish()
+		case <-stop:
+			finish()
+			stop = nil
+		}
+	}
+
+	for _, s := range sockets {
+		if kstats, err := unix.GetsockoptTpacketStats(s.fd, unix.SOL_PACKET, unix.PACKET_STATISTICS); err == nil {
+			stats.Received += kstats.Packets
+			stats.Dropped += kstats.Drops
+		}
+	}
+
+	if writeErr != nil {
+		return stats, fmt.Errorf("failed to write packet: %w", writeErr)
+	}
+	select {
+	case err := <-errs:
+		return stats, err
+	default:
+	}
+	return stats, nil
+}
+
+// openSocket opens a packet socket inside the interface's namespace with
+// the filter attached before it is bound, so no unfiltered packet is queued
+func openSocket(iface Interface, opts Options) (*socket, error) {
+	s := &socket{fd: -1}
+	err := iface.Namespace.Run(func() error {
+		link, err := netlink.LinkByName(iface.Name)
+		if err != nil {
+			return err
+		}
+
+		// Interfaces without an Ethernet header deliver bare IP packets
+		sockType := unix.SOCK_DGRAM
+		s.linkType = LinkTypeRaw
+		if encap := link.Attrs().EncapType; encap == "ether" || encap == "loopback" {
+			sockType = unix.SOCK_RAW
+			s.linkType = LinkTypeEthernet
+		}
+
+		filter, err := CompileFilter(opts.Filter, s.linkType, uint32(opts.Snaplen))
+		if err != nil {
+			return err
+		}
+
+		s.fd, err = unix.Socket(unix.AF_PACKET, sockType|unix.SOCK_CLOEXEC, 0)
+		if err != nil {
+			return err
+		}
+
+		prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+		if err := unix.SetsockoptSockFprog(s.fd, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER, &prog); err != nil {
+			return fmt.Errorf("attach filter: %w", err)
+		}
+		if err := unix.SetsockoptInt(s.fd, unix.SOL_SOCKET, unix.SO_RCVBUF, receiveBuffer); err != nil {
+			return err
+		}
+		if err := unix.SetsockoptInt(s.fd, unix.SOL_PACKET, unix.PACKET_AUXDATA, 1); err != nil {
+			return err
+		}
+		if err := unix.SetsockoptInt(s.fd, unix.SOL_SOCKET, unix.SO_TIMESTAMPNS, 1); err != nil {
+			return err
+		}
+		tv := unix.NsecToTimeval(pollInterval.Nanoseconds())
+		if err := unix.SetsockoptTimeval(s.fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+			return err
+		}
+
+		return unix.Bind(s.fd, &unix.SockaddrLinklayer{
+			Protocol: htons(unix.ETH_P_ALL),
+			Ifindex:  link.Attrs().Index,
+		})
+	})
+	if err != nil {
+		if s.fd >= 0 {
+			unix.Close(s.fd)
+		}
+		return nil, fmt.Errorf("failed to open capture on %s: %w", iface.Name, err)
+	}
+	return s, nil
+}
+
+// read receives packets until done is closed
+func (s *socket) read(snaplen int, out chan<- packet, done <-chan struct{}) error {
+	buf := make([]byte, snaplen)
+	oob := make([]byte, unix.CmsgSpace(int(unsafe.Sizeof(unix.TpacketAuxdata{})))+unix.CmsgSpace(int(unsafe.Sizeof(unix.Timespec{}))))
+
+	for {
+		select {
+		case <-done:
+			return nil
+		default:
+		}
+
+		n, oobn, _, from, err := unix.Recvmsg(s.fd, buf, oob, 0)
+		if err != nil {
+			if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+				continue
+			}
+			return fmt.Errorf("failed to receive packet: %w", err)
+		}
+
+		p := packet{iface: s.id, ts: time.Now(), origLen: n}
+		if ll, ok := from.(*unix.SockaddrLinklayer); ok {
+			p.outbound = ll.Pkttype == unix.PACKET_OUTGOING
+		}
+
+		var aux *unix.TpacketAuxdata
+		if msgs, err := unix.ParseSocketControlMessage(oob[:oobn]); err == nil {
+			for _, m := range msgs {
+				switch {
+				case m.Header.Level == unix.SOL_SOCKET && m.Header.Type == unix.SCM_TIMESTAMPNS:
+					ts := (*unix.Timespec)(unsafe.Pointer(&m.Data[0]))
+					p.ts = time.Unix(ts.Unix())
+				case m.Header.Level == unix.SOL_PACKET && m.Header.Type == unix.PACKET_AUXDATA:
+					aux = (*unix.TpacketAuxdata)(unsafe.Pointer(&m.Data[0]))
+				}
+			}
+		}
+
+		data := buf[:n]
+		if aux != nil {
+			p.origLen = int(aux.Len)
+			// The kernel strips offloaded 802.1Q tags; put them back
+			if aux.Status&unix.TP_STATUS_VLAN_VALID != 0 && s.linkType == LinkTypeEthernet && n >= 12 {
+				tpid := uint16(0x8100)
+				if aux.Status&unix.TP_STATUS_VLAN_TPID_VALID != 0 {
+					tpid = aux.Vlan_tpid
+				}
+				tagged := make([]byte, 0, n+4)
+				tagged = append(tagged, data[:12]...)
+				tagged = append(tagged, byte(tpid>>8), byte(tpid), byte(aux.Vlan_tci>>8), byte(aux.Vlan_tci))
+				data = append(tagged, data[12:]...)
+				p.origLen += 4
+			}
+		}
+		p.data = append([]byte(nil), data...)
+
+		select {
+		case out <- p:
+		case <-done:
+			return nil
+		}
+	}
+}
+
+// htons converts a 16-bit value to network byte order
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
@@ -0,0 +1,666 @@
+package capture
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Link-layer header types used in the capture file
+const (
+	LinkTypeEthernet = 1
+	LinkTypeRaw      = 101 // Bare IPv4 or IPv6 packets
+)
+
+// Ancillary data offsets (SKF_AD_*) for loads the kernel answers from
+// socket buffer metadata instead of packet bytes
+const (
+	adOff            = 0xfffff000 // -0x1000 as an unsigned offset
+	adPktType        = adOff + 4
+	adVLANTag        = adOff + 44
+	adVLANTagPresent = adOff + 48
+)
+
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeARP  = 0x0806
+	etherTypeIPv6 = 0x86dd
+
+	protoICMP   = 1
+	protoTCP    = 6
+	protoUDP    = 17
+	protoICMPv6 = 58
+)
+
+// CompileFilter compiles a pcap-style filter expression into a classic BPF
+// program that accepts up to snaplen bytes of matching packets. The
+// supported subset covers protocols (ether, ip, ip6, arp, tcp, udp, icmp,
+// icmp6), host/net/port with optional src/dst qualifiers, vlan [id],
+// inbound/outbound and the and/or/not operators with parentheses.
+func CompileFilter(expr string, linkType int, snaplen uint32) ([]unix.SockFilter, error) {
+	c := &compiler{linkType: linkType}
+	if linkType == LinkTypeEthernet {
+		c.nh = 14
+	}
+
+	accept, reject := c.newLabel(), c.newLabel()
+	if strings.TrimSpace(expr) != "" {
+		p := &parser{tokens: tokenize(expr), linkType: linkType}
+		tree, err := p.parse()
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter %q: %w", expr, err)
+		}
+		tree.gen(c, accept, reject)
+	}
+
+	c.place(accept)
+	c.emit(unix.BPF_RET|unix.BPF_K, snaplen)
+	c.place(reject)
+	c.emit(unix.BPF_RET|unix.BPF_K, 0)
+
+	return c.assemble()
+}
+
+// maxInsns is the longest program the kernel accepts (BPF_MAXINSNS)
+const maxInsns = 4096
+
+// label is a symbolic jump target resolved by assemble
+type label int
+
+const noLabel label = -1
+
+type instruction struct {
+	code   uint16
+	jt, jf label
+	k      uint32
+}
+
+// compiler emits instructions whose conditional jumps refer to labels.
+// Labels are always placed after the jumps that use them, which keeps every
+// jump forward as classic BPF requires.
+type compiler struct {
+	linkType int
+	nh       uint32 // Offset of the network header
+	insns    []instruction
+	labels   []int
+}
+
+func (c *compiler) newLabel() label {
+	c.labels = append(c.labels, -1)
+	return label(len(c.labels) - 1)
+}
+
+func (c *compiler) place(l label) {
+	c.labels[l] = len(c.insns)
+}
+
+func (c *compiler) emit(code uint16, k uint32) {
+	c.insns = append(c.insns, instruction{code: code, jt: noLabel, jf: noLabel, k: k})
+}
+
+func (c *compiler) jump(code uint16, k uint32, t, f label) {
+	c.insns = append(c.insns, instruction{code: code, jt: t, jf: f, k: k})
+}
+
+// assemble resolves labels into jump offsets. Conditional jumps reach at
+// most 255 instructions ahead, so a farther target goes through an
+// unconditional jump placed right after the conditional one. Placing one
+// moves the code behind it, so the layout is repeated until every jump
+// fits.
+func (c *compiler) assemble() ([]unix.SockFilter, error) {
+	longT := make([]bool, len(c.insns))
+	longF := make([]bool, len(c.insns))
+
+	for {
+		pos := make([]int, len(c.insns))
+		n := 0
+		for pc := range c.insns {
+			pos[pc] = n
+			n++
+			if longT[pc] {
+				n++
+			}
+			if longF[pc] {
+				n++
+			}
+		}
+		if n > maxInsns {
+			return nil, fmt.Errorf("filter is too long")
+		}
+		target := func(l label) int { return pos[c.labels[l]] }
+
+		changed := false
+		for pc, in := range c.insns {
+			if in.jt == noLabel {
+				continue
+			}
+			if !longT[pc] && target(in.jt)-pos[pc]-1 > 255 {
+				longT[pc], changed = true, true
+			}
+			if !longF[pc] && target(in.jf)-pos[pc]-1 > 255 {
+				longF[pc], changed = true, true
+			}
+		}
+		if changed {
+			continue
+		}
+
+		prog := make([]unix.SockFilter, 0, n)
+		for pc, in := range c.insns {
+			prog = append(prog, unix.SockFilter{Code: in.code, K: in.k})
+			if in.jt == noLabel {
+				continue
+			}
+			cond := len(prog) - 1
+			for i, branch := range []struct {
+				to   label
+				long bool
+			}{{in.jt, longT[pc]}, {in.jf, longF[pc]}} {
+				off := target(branch.to) - pos[pc] - 1
+				if branch.long {
+					off = len(prog) - cond - 1
+					prog = append(prog, unix.SockFilter{
+						Code: unix.BPF_JMP | unix.BPF_JA,
+						K:    uint32(target(branch.to) - len(prog) - 1),
+					})
+				}
+				if i == 0 {
+					prog[cond].Jt = uint8(off)
+				} else {
+					prog[cond].Jf = uint8(off)
+				}
+			}
+		}
+		return prog, nil
+	}
+}
+
+// node is a filter expression that jumps to t when it matches and to f
+// otherwise
+type node interface {
+	gen(c *compiler, t, f label)
+}
+
+type andNode struct{ left, right node }
+
+func (n andNode) gen(c *compiler, t, f label) {
+	next := c.newLabel()
+	n.left.gen(c, next, f)
+	c.place(next)
+	n.right.gen(c, t, f)
+}
+
+type orNode struct{ left, right node }
+
+func (n orNode) gen(c *compiler, t, f label) {
+	next := c.newLabel()
+	n.left.gen(c, t, next)
+	c.place(next)
+	n.right.gen(c, t, f)
+}
+
+type notNode struct{ x node }
+
+func (n notNode) gen(c *compiler, t, f label) {
+	n.x.gen(c, f, t)
+}
+
+// load selects the value a test compares
+type load struct {
+	size   uint16 // BPF_W, BPF_H or BPF_B
+	offset uint32 // Relative to the network header unless absolute
+	abs    bool   // Offset is absolute (link header or ancillary data)
+	ind    bool   // Offset is relative to the IPv4 transport header
+}
+
+// test compares a loaded value, optionally masked, against a constant. A
+// set test matches when any of the value's bits are set.
+type test struct {
+	load
+	mask  uint32
+	value uint32
+	set   bool
+}
+
+func (n test) gen(c *compiler, t, f label) {
+	offset := n.offset
+	if !n.abs {
+		offset += c.nh
+	}
+
+	mode := uint16(unix.BPF_ABS)
+	if n.ind {
+		// X = length of the IPv4 header
+		c.emit(unix.BPF_LDX|unix.BPF_B|unix.BPF_MSH, c.nh)
+		mode = unix.BPF_IND
+	}
+	c.emit(unix.BPF_LD|n.size|mode, offset)
+
+	if n.set {
+		c.jump(unix.BPF_JMP|unix.BPF_JSET|unix.BPF_K, n.mask, t, f)
+		return
+	}
+	if n.mask != 0 {
+		c.emit(unix.BPF_ALU|unix.BPF_AND|unix.BPF_K, n.mask)
+	}
+	c.jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, n.value, t, f)
+}
+
+// always matches every packet, e.g. an address against ::/0
+type always struct{}
+
+func (always) gen(c *compiler, t, f label) {
+	// Any accumulator value is >= 0
+	c.jump(unix.BPF_JMP|unix.BPF_JGE|unix.BPF_K, 0, t, f)
+}
+
+func and(nodes ...node) node {
+	n := nodes[0]
+	for _, next := range nodes[1:] {
+		n = andNode{n, next}
+	}
+	return n
+}
+
+func or(nodes ...node) node {
+	n := nodes[0]
+	for _, next := range nodes[1:] {
+		n = orNode{n, next}
+	}
+	return n
+}
+
+// parser turns tokens into a node tree
+type parser struct {
+	tokens   []string
+	pos      int
+	linkType int
+}
+
+func tokenize(expr string) []string {
+	var tokens []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+
+	for i := 0; i < len(expr); i++ {
+		ch := expr[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			flush()
+		case ch == '(' || ch == ')' || ch == '!':
+			flush()
+			tokens = append(tokens, string(ch))
+		case (ch == '&' || ch == '|') && i+1 < len(expr) && expr[i+1] == ch:
+			flush()
+			tokens = append(tokens, expr[i:i+2])
+			i++
+		default:
+			word.WriteByte(ch)
+		}
+	}
+	flush()
+	return tokens
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	tok := p.peek()
+	if tok != "" {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) parse() (node, error) {
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok != "" {
+		return nil, fmt.Errorf("unexpected %q", tok)
+	}
+	return n, nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" || p.peek() == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "and" || p.peek() == "&&" {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	switch p.peek() {
+	case "not", "!":
+		p.next()
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{x}, nil
+	case "(":
+		p.next()
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return x, nil
+	case "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return p.parsePrimitive()
+}
+
+// parsePrimitive parses [proto] [src|dst] [host|net|port] value, a bare
+// protocol, vlan [id], inbound or outbound
+func (p *parser) parsePrimitive() (node, error) {
+	proto := ""
+	switch p.peek() {
+	case "ether", "ip", "ip6", "arp", "tcp", "udp", "icmp", "icmp6":
+		proto = p.next()
+	case "vlan":
+		p.next()
+		return p.vlan()
+	case "inbound", "outbound":
+		return p.direction(p.next())
+	}
+
+	dir := ""
+	if tok := p.peek(); tok == "src" || tok == "dst" {
+		dir = p.next()
+	}
+
+	kind := ""
+	switch p.peek() {
+	case "host", "net", "port":
+		kind = p.next()
+	}
+
+	if dir == "" && kind == "" {
+		if proto == "" {
+			return nil, fmt.Errorf("unknown primitive %q", p.peek())
+		}
+		return p.protocol(proto)
+	}
+
+	value := p.next()
+	if value == "" || value == ")" {
+		return nil, fmt.Errorf("missing value after %q", strings.Join(strings.Fields(proto+" "+dir+" "+kind), " "))
+	}
+	if kind == "" {
+		kind = "host"
+		if _, _, err := net.ParseCIDR(value); err == nil {
+			kind = "net"
+		} else if _, err := strconv.Atoi(value); err == nil {
+			kind = "port"
+		}
+	}
+
+	switch kind {
+	case "host":
+		return p.host(proto, dir, value)
+	case "net":
+		return p.net(proto, dir, value)
+	default:
+		return p.port(proto, dir, value)
+	}
+}
+
+// ethertype matches the network protocol. Without a link header only IPv4
+// and IPv6 can be told apart, by the IP version.
+func (p *parser) ethertype(etherType uint32) node {
+	if p.linkType == LinkTypeEthernet {
+		return test{load: load{size: unix.BPF_H, offset: 12, abs: true}, value: etherType}
+	}
+
+	switch etherType {
+	case etherTypeIPv4:
+		return test{load: load{size: unix.BPF_B}, mask: 0xf0, value: 0x40}
+	case etherTypeIPv6:
+		return test{load: load{size: unix.BPF_B}, mask: 0xf0, value: 0x60}
+	}
+	// Nothing else appears on an interface without a link header
+	return notNode{always{}}
+}
+
+func (p *parser) protocol(proto string) (node, error) {
+	switch proto {
+	case "ip":
+		return p.ethertype(etherTypeIPv4), nil
+	case "ip6":
+		return p.ethertype(etherTypeIPv6), nil
+	case "arp":
+		return p.ethertype(etherTypeARP), nil
+	case "tcp":
+		return or(p.ipv4Proto(protoTCP), p.ipv6Next(protoTCP)), nil
+	case "udp":
+		return or(p.ipv4Proto(protoUDP), p.ipv6Next(protoUDP)), nil
+	case "icmp":
+		return p.ipv4Proto(protoICMP), nil
+	case "icmp6":
+		return p.ipv6Next(protoICMPv6), nil
+	}
+	return nil, fmt.Errorf("%q needs host, net or port", proto)
+}
+
+// ipv4Proto matches an IPv4 protocol number
+func (p *parser) ipv4Proto(proto uint32) node {
+	return and(p.ethertype(etherTypeIPv4), test{load: load{size: unix.BPF_B, offset: 9}, value: proto})
+}
+
+// ipv6Next matches the first IPv6 next header
+func (p *parser) ipv6Next(proto uint32) node {
+	return and(p.ethertype(etherTypeIPv6), test{load: load{size: unix.BPF_B, offset: 6}, value: proto})
+}
+
+// directed combines the source and destination tests as the qualifier asks
+func directed(dir string, src, dst node) node {
+	switch dir {
+	case "src":
+		return src
+	case "dst":
+		return dst
+	}
+	return or(src, dst)
+}
+
+func (p *parser) host(proto, dir, value string) (node, error) {
+	if proto == "ether" {
+		mac, err := net.ParseMAC(value)
+		if err != nil || len(mac) != 6 {
+			return nil, fmt.Errorf("invalid MAC address %q", value)
+		}
+		if p.linkType != LinkTypeEthernet {
+			return notNode{always{}}, nil
+		}
+		return directed(dir, macTest(6, mac), macTest(0, mac)), nil
+	}
+
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid host %q", value)
+	}
+	bits := 128
+	if ip.To4() != nil {
+		bits = 32
+	}
+	return p.address(proto, dir, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+}
+
+func (p *parser) net(proto, dir, value string) (node, error) {
+	_, ipnet, err := net.ParseCIDR(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid network %q", value)
+	}
+	return p.address(proto, dir, ipnet)
+}
+
+// address matches IPv4 (and, without a protocol qualifier, ARP) or IPv6
+// source and destination addresses against a network
+func (p *parser) address(proto, dir string, ipnet *net.IPNet) (node, error) {
+	if v4 := ipnet.IP.To4(); v4 != nil {
+		mask := binary.BigEndian.Uint32(ipnet.Mask[len(ipnet.Mask)-4:])
+		value := binary.BigEndian.Uint32(v4) & mask
+		word := func(offset uint32) node {
+			return test{load: load{size: unix.BPF_W, offset: offset}, mask: maskOrZero(mask), value: value}
+		}
+
+		var alternatives []node
+		if proto == "" || proto == "ip" {
+			alternatives = append(alternatives, and(p.ethertype(etherTypeIPv4), directed(dir, word(12), word(16))))
+		}
+		if proto == "" || proto == "arp" {
+			alternatives = append(alternatives, and(p.ethertype(etherTypeARP), directed(dir, word(14), word(24))))
+		}
+		if len(alternatives) == 0 {
+			return nil, fmt.Errorf("%s does not carry IPv4 addresses", proto)
+		}
+		return or(alternatives...), nil
+	}
+
+	if proto != "" && proto != "ip6" {
+		return nil, fmt.Errorf("%s does not carry IPv6 addresses", proto)
+	}
+	return and(p.ethertype(etherTypeIPv6), directed(dir, ipv6Test(8, ipnet), ipv6Test(24, ipnet))), nil
+}
+
+// maskOrZero drops a full mask so the test skips the AND instruction
+func maskOrZero(mask uint32) uint32 {
+	if mask == 0xffffffff {
+		return 0
+	}
+	return mask
+}
+
+// ipv6Test compares an IPv6 address at offset word by word
+func ipv6Test(offset uint32, ipnet *net.IPNet) node {
+	var words []node
+	for i := 0; i < 4; i++ {
+		mask := binary.BigEndian.Uint32(ipnet.Mask[i*4:])
+		if mask == 0 {
+			break
+		}
+		value := binary.BigEndian.Uint32(ipnet.IP[i*4:]) & mask
+		words = append(words, test{load: load{size: unix.BPF_W, offset: offset + uint32(i*4)}, mask: maskOrZero(mask), value: value})
+	}
+	if len(words) == 0 {
+		return always{}
+	}
+	return and(words...)
+}
+
+// macTest compares a MAC address at an absolute offset
+func macTest(offset uint32, mac net.HardwareAddr) node {
+	return and(
+		test{load: load{size: unix.BPF_W, offset: offset, abs: true}, value: binary.BigEndian.Uint32(mac)},
+		test{load: load{size: unix.BPF_H, offset: offset + 4, abs: true}, value: uint32(binary.BigEndian.Uint16(mac[4:]))},
+	)
+}
+
+func (p *parser) port(proto, dir, value string) (node, error) {
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 0 || number > 65535 {
+		return nil, fmt.Errorf("invalid port %q", value)
+	}
+	port := uint32(number)
+
+	var protos []uint32
+	switch proto {
+	case "":
+		protos = []uint32{protoTCP, protoUDP}
+	case "tcp":
+		protos = []uint32{protoTCP}
+	case "udp":
+		protos = []uint32{protoUDP}
+	default:
+		return nil, fmt.Errorf("%s has no ports", proto)
+	}
+
+	protoTest := func(offset uint32) node {
+		var tests []node
+		for _, n := range protos {
+			tests = append(tests, test{load: load{size: unix.BPF_B, offset: offset}, value: n})
+		}
+		return or(tests...)
+	}
+
+	// IPv4: skip non-first fragments, then index past the options
+	fragment := test{load: load{size: unix.BPF_H, offset: 6}, mask: 0x1fff, set: true}
+	v4 := and(p.ethertype(etherTypeIPv4), protoTest(9), notNode{fragment}, directed(dir,
+		test{load: load{size: unix.BPF_H, offset: 0, ind: true}, value: port},
+		test{load: load{size: unix.BPF_H, offset: 2, ind: true}, value: port},
+	))
+
+	// IPv6: only transport headers directly after the fixed header
+	v6 := and(p.ethertype(etherTypeIPv6), protoTest(6), directed(dir,
+		test{load: load{size: unix.BPF_H, offset: 40}, value: port},
+		test{load: load{size: unix.BPF_H, offset: 42}, value: port},
+	))
+
+	return or(v4, v6), nil
+}
+
+func (p *parser) vlan() (node, error) {
+	present := notNode{test{load: load{size: unix.BPF_W, offset: adVLANTagPresent, abs: true}, value: 0}}
+
+	id, err := strconv.Atoi(p.peek())
+	if err != nil {
+		return present, nil
+	}
+	p.next()
+	if id < 1 || id > 4094 {
+		return nil, fmt.Errorf("invalid VLAN ID %d", id)
+	}
+	return and(present, test{load: load{size: unix.BPF_W, offset: adVLANTag, abs: true}, mask: 0xfff, value: uint32(id)}), nil
+}
+
+func (p *parser) direction(dir string) (node, error) {
+	outgoing := test{load: load{size: unix.BPF_W, offset: adPktType, abs: true}, value: unix.PACKET_OUTGOING}
+	if dir == "outbound" {
+		return outgoing, nil
+	}
+	return notNode{outgoing}, nil
+}
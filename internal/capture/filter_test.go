@@ -0,0 +1,439 @@
+package capture
+
+import (
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+const testSnaplen = 262144
+
+// testPacket is a frame as a packet socket sees it, with the metadata the
+// kernel answers ancillary loads from. VLAN tags are stripped into vlanTCI,
+// as the kernel does before the filter runs.
+type testPacket struct {
+	data     []byte
+	pktType  uint32
+	tagged   bool
+	vlanTCI  uint32
+	linkType int
+}
+
+// run interprets a classic BPF program the way the kernel does for the
+// instructions CompileFilter emits. Loads past the end of the packet
+// reject it.
+func run(t *testing.T, prog []unix.SockFilter, p testPacket) uint32 {
+	t.Helper()
+
+	var a, x uint32
+	load := func(offset uint32, size uint16) (uint32, bool) {
+		switch offset {
+		case adPktType:
+			return p.pktType, true
+		case adVLANTag:
+			return p.vlanTCI, true
+		case adVLANTagPresent:
+			if p.tagged {
+				return 1, true
+			}
+			return 0, true
+		}
+		n := map[uint16]uint32{unix.BPF_W: 4, unix.BPF_H: 2, unix.BPF_B: 1}[size]
+		if uint64(offset)+uint64(n) > uint64(len(p.data)) {
+			return 0, false
+		}
+		b := p.data[offset:]
+		switch size {
+		case unix.BPF_W:
+			return binary.BigEndian.Uint32(b), true
+		case unix.BPF_H:
+			return uint32(binary.BigEndian.Uint16(b)), true
+		}
+		return uint32(b[0]), true
+	}
+
+	for pc := 0; pc < len(prog); pc++ {
+		in := prog[pc]
+		switch in.Code {
+		case unix.BPF_RET | unix.BPF_K:
+			return in.K
+		case unix.BPF_LDX | unix.BPF_B | unix.BPF_MSH:
+			if int(in.K) >= len(p.data) {
+				return 0
+			}
+			x = 4 * uint32(p.data[in.K]&0x0f)
+		case unix.BPF_ALU | unix.BPF_AND | unix.BPF_K:
+			a &= in.K
+		case unix.BPF_JMP | unix.BPF_JA:
+			pc += int(in.K)
+		case unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K,
+			unix.BPF_JMP | unix.BPF_JSET | unix.BPF_K,
+			unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K:
+			var match bool
+			switch in.Code & 0xf0 {
+			case unix.BPF_JEQ:
+				match = a == in.K
+			case unix.BPF_JSET:
+				match = a&in.K != 0
+			case unix.BPF_JGE:
+				match = a >= in.K
+			}
+			if match {
+				pc += int(in.Jt)
+			} else {
+				pc += int(in.Jf)
+			}
+		default:
+			if in.Code&0x07 != unix.BPF_LD {
+				t.Fatalf("pc %d: unexpected instruction %#x", pc, in.Code)
+			}
+			offset := in.K
+			switch in.Code & 0xe0 {
+			case unix.BPF_ABS:
+			case unix.BPF_IND:
+				offset += x
+			default:
+				t.Fatalf("pc %d: unexpected load mode %#x", pc, in.Code)
+			}
+			v, ok := load(offset, in.Code&0x18)
+			if !ok {
+				return 0
+			}
+			a = v
+		}
+	}
+	t.Fatalf("program ran off its end")
+	return 0
+}
+
+var (
+	macA = net.HardwareAddr{0x02, 0, 0, 0, 0, 0x01}
+	macB = net.HardwareAddr{0x02, 0, 0, 0, 0, 0x02}
+)
+
+func ether(etherType uint16, payload []byte) []byte {
+	b := make([]byte, 14, 14+len(payload))
+	copy(b[0:], macB) // Destination
+	copy(b[6:], macA) // Source
+	binary.BigEndian.PutUint16(b[12:], etherType)
+	return append(b, payload...)
+}
+
+// ports is the start of a TCP or UDP header
+func ports(src, dst uint16) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint16(b[0:], src)
+	binary.BigEndian.PutUint16(b[2:], dst)
+	return b
+}
+
+// ipv4 builds an IPv4 header with optWords words of options and a fragment
+// offset in 8-byte units
+func ipv4(src, dst string, proto byte, optWords int, fragment uint16, payload []byte) []byte {
+	hlen := 20 + 4*optWords
+	b := make([]byte, hlen, hlen+len(payload))
+	b[0] = 0x40 | byte(hlen/4)
+	binary.BigEndian.PutUint16(b[2:], uint16(hlen+len(payload)))
+	binary.BigEndian.PutUint16(b[6:], fragment)
+	b[8] = 64
+	b[9] = proto
+	copy(b[12:], net.ParseIP(src).To4())
+	copy(b[16:], net.ParseIP(dst).To4())
+	return append(b, payload...)
+}
+
+func ipv6(src, dst string, next byte, payload []byte) []byte {
+	b := make([]byte, 40, 40+len(payload))
+	b[0] = 0x60
+	binary.BigEndian.PutUint16(b[4:], uint16(len(payload)))
+	b[6] = next
+	b[7] = 64
+	copy(b[8:], net.ParseIP(src).To16())
+	copy(b[24:], net.ParseIP(dst).To16())
+	return append(b, payload...)
+}
+
+func arp(sender, target string) []byte {
+	b := make([]byte, 28)
+	binary.BigEndian.PutUint16(b[0:], 1)
+	binary.BigEndian.PutUint16(b[2:], etherTypeIPv4)
+	b[4], b[5] = 6, 4
+	binary.BigEndian.PutUint16(b[6:], 1)
+	copy(b[8:], macA)
+	copy(b[14:], net.ParseIP(sender).To4())
+	copy(b[24:], net.ParseIP(target).To4())
+	return b
+}
+
+// Frames shared by the test cases
+var (
+	tcp4     = ether(etherTypeIPv4, ipv4("10.0.0.1", "10.0.1.2", protoTCP, 0, 0, ports(40000, 80)))
+	udp4     = ether(etherTypeIPv4, ipv4("10.0.1.2", "10.0.0.1", protoUDP, 0, 0, ports(80, 53)))
+	dns4     = ether(etherTypeIPv4, ipv4("10.0.0.1", "10.0.1.2", protoUDP, 0, 0, ports(40000, 53)))
+	opts4    = ether(etherTypeIPv4, ipv4("10.0.0.1", "10.0.1.2", protoUDP, 3, 0, ports(40000, 53)))
+	frag4    = ether(etherTypeIPv4, ipv4("10.0.0.1", "10.0.1.2", protoUDP, 0, 185, ports(40000, 53)))
+	icmp4    = ether(etherTypeIPv4, ipv4("10.0.0.1", "10.0.1.2", protoICMP, 0, 0, make([]byte, 8)))
+	tcp6     = ether(etherTypeIPv6, ipv6("fd00::1", "fd00:0:0:1::2", protoTCP, ports(40000, 443)))
+	icmp6    = ether(etherTypeIPv6, ipv6("fd00::1", "fd00:0:0:1::2", protoICMPv6, make([]byte, 8)))
+	arp4     = ether(etherTypeARP, arp("10.0.0.1", "10.0.0.254"))
+	raw4     = ipv4("10.0.0.1", "10.0.1.2", protoTCP, 0, 0, ports(40000, 80))
+	raw6     = ipv6("fd00::1", "fd00:0:0:1::2", protoUDP, ports(40000, 53))
+	truncTCP = tcp4[:14+20+1] // Ends inside the ports
+)
+
+func TestCompileFilter(t *testing.T) {
+	eth := func(data []byte) testPacket { return testPacket{data: data, linkType: LinkTypeEthernet} }
+	vlan := func(data []byte, tci uint32) testPacket {
+		return testPacket{data: data, linkType: LinkTypeEthernet, tagged: true, vlanTCI: tci}
+	}
+	out := func(data []byte) testPacket {
+		return testPacket{data: data, linkType: LinkTypeEthernet, pktType: unix.PACKET_OUTGOING}
+	}
+	raw := func(data []byte) testPacket { return testPacket{data: data, linkType: LinkTypeRaw} }
+
+	tests := []struct {
+		expr   string
+		packet testPacket
+		want   bool
+	}{
+		{"", eth(arp4), true},
+		{"", raw(raw6), true},
+
+		// Protocols
+		{"ip", eth(tcp4), true},
+		{"ip", eth(tcp6), false},
+		{"ip6", eth(tcp6), true},
+		{"arp", eth(arp4), true},
+		{"arp", eth(tcp4), false},
+		{"tcp", eth(tcp4), true},
+		{"tcp", eth(tcp6), true},
+		{"tcp", eth(udp4), false},
+		{"udp", eth(udp4), true},
+		{"icmp", eth(icmp4), true},
+		{"icmp", eth(icmp6), false},
+		{"icmp6", eth(icmp6), true},
+
+		// IPv4 hosts and networks, with ARP addresses for unqualified ones
+		{"host 10.0.0.1", eth(tcp4), true},
+		{"host 10.0.0.1", eth(udp4), true},
+		{"host 10.0.0.9", eth(tcp4), false},
+		{"src host 10.0.0.1", eth(tcp4), true},
+		{"src host 10.0.0.1", eth(udp4), false},
+		{"dst host 10.0.0.1", eth(udp4), true},
+		{"dst host 10.0.0.1", eth(tcp4), false},
+		{"src 10.0.0.1", eth(tcp4), true}, // Kind inferred from the value
+		{"host 10.0.0.1", eth(arp4), true},
+		{"dst host 10.0.0.254", eth(arp4), true},
+		{"ip host 10.0.0.1", eth(arp4), false},
+		{"arp src host 10.0.0.1", eth(arp4), true},
+		{"net 10.0.1.0/24", eth(tcp4), true},
+		{"net 10.0.2.0/24", eth(tcp4), false},
+		{"src net 10.0.0.0/24", eth(tcp4), true},
+		{"dst net 10.0.0.0/24", eth(tcp4), false},
+		{"dst net 10.0.0.0/16", eth(tcp4), true},
+		{"dst 10.0.0.0/8", eth(udp4), true},
+		{"host 10.0.0.1", eth(tcp6), false},
+
+		// IPv6 hosts and networks
+		{"host fd00::1", eth(tcp6), true},
+		{"host fd00::1", eth(tcp4), false},
+		{"src host fd00::1", eth(tcp6), true},
+		{"dst host fd00::1", eth(tcp6), false},
+		{"dst host fd00:0:0:1::2", eth(tcp6), true},
+		{"ip6 host fd00::1", eth(tcp6), true},
+		{"net fd00:0:0:1::/64", eth(tcp6), true},
+		{"src net fd00:0:0:1::/64", eth(tcp6), false},
+		{"net fd01::/16", eth(tcp6), false},
+		{"net fd00::/12", eth(tcp6), true},
+		{"net ::/0", eth(tcp6), true},
+		{"net ::/0", eth(tcp4), false},
+
+		// Ports, indexed past IPv4 options and skipping later fragments
+		{"port 80", eth(tcp4), true},
+		{"port 80", eth(udp4), true},
+		{"port 81", eth(tcp4), false},
+		{"tcp port 80", eth(udp4), false},
+		{"udp port 80", eth(udp4), true},
+		{"src port 80", eth(udp4), true},
+		{"src port 80", eth(tcp4), false},
+		{"dst port 80", eth(tcp4), true},
+		{"dst port 53", eth(opts4), true},
+		{"src port 40000", eth(opts4), true},
+		{"port 53", eth(frag4), false},
+		{"udp", eth(frag4), true},
+		{"port 443", eth(tcp6), true},
+		{"tcp dst port 443", eth(tcp6), true},
+		{"udp port 443", eth(tcp6), false},
+		{"port 80", eth(truncTCP), false},
+		{"udp dst 53", eth(dns4), true},
+		{"udp src 53", eth(dns4), false},
+
+		// Operator precedence: not binds tightest, then and, then or
+		{"not tcp and udp", eth(udp4), true},
+		{"not tcp and udp", eth(tcp4), false},
+		{"not tcp and udp", eth(icmp4), false},
+		{"tcp or udp and port 53", eth(tcp4), true},
+		{"tcp or udp and port 53", eth(udp4), true},
+		{"tcp or udp and port 80", eth(dns4), false},
+		{"(tcp or udp) and port 53", eth(tcp4), false},
+		{"(tcp or udp) and port 53", eth(dns4), true},
+		{"not (tcp or udp)", eth(icmp4), true},
+		{"not (tcp or udp)", eth(udp4), false},
+		{"! tcp && ! udp", eth(arp4), true},
+		{"tcp || arp", eth(arp4), true},
+		{"not not tcp", eth(tcp4), true},
+		{"tcp port 80 or not ip", eth(arp4), true},
+		{"tcp port 80 or not ip", eth(dns4), false},
+		{"host 10.0.0.1 and not port 53", eth(dns4), false},
+		{"host 10.0.0.1 and not port 53", eth(tcp4), true},
+
+		// VLANs come from the stripped tag, and later tests keep the
+		// untagged offsets
+		{"vlan", eth(tcp4), false},
+		{"vlan", vlan(tcp4, 10), true},
+		{"vlan 10", vlan(tcp4, 10), true},
+		{"vlan 10", vlan(tcp4, 20), false},
+		{"vlan 10", vlan(tcp4, 0xa00a), true}, // Priority bits are masked
+		{"vlan 10", eth(tcp4), false},
+		{"vlan 10 and tcp port 80", vlan(tcp4, 10), true},
+		{"vlan 10 and host 10.0.0.1", vlan(tcp4, 10), true},
+		{"vlan 10 and port 443", vlan(tcp6, 10), true},
+		{"vlan 10 and udp", vlan(tcp4, 10), false},
+		{"not vlan", eth(tcp4), true},
+		{"vlan and arp", vlan(arp4, 5), true},
+
+		// Direction
+		{"inbound", eth(tcp4), true},
+		{"outbound", eth(tcp4), false},
+		{"outbound", out(tcp4), true},
+		{"inbound", out(tcp4), false},
+		{"outbound and tcp port 80", out(tcp4), true},
+
+		// Ethernet addresses
+		{"ether src 02:00:00:00:00:01", eth(tcp4), true},
+		{"ether dst 02:00:00:00:00:01", eth(tcp4), false},
+		{"ether host 02:00:00:00:00:02", eth(tcp4), true},
+
+		// Interfaces without a link header
+		{"ip", raw(raw4), true},
+		{"ip6", raw(raw4), false},
+		{"ip6", raw(raw6), true},
+		{"tcp port 80", raw(raw4), true},
+		{"host 10.0.1.2", raw(raw4), true},
+		{"udp port 53", raw(raw6), true},
+		{"src host fd00::1", raw(raw6), true},
+		{"arp", raw(raw4), false},
+		{"ether host 02:00:00:00:00:01", raw(raw4), false},
+	}
+
+	for _, tt := range tests {
+		prog, err := CompileFilter(tt.expr, tt.packet.linkType, testSnaplen)
+		if err != nil {
+			t.Errorf("CompileFilter(%q): %v", tt.expr, err)
+			continue
+		}
+		got := run(t, prog, tt.packet)
+		if (got != 0) != tt.want {
+			t.Errorf("filter %q on %d-byte packet: accepted=%v, want %v", tt.expr, len(tt.packet.data), got != 0, tt.want)
+		}
+		if got != 0 && got != testSnaplen {
+			t.Errorf("filter %q: accepted %d bytes, want the snaplen %d", tt.expr, got, testSnaplen)
+		}
+	}
+}
+
+func TestCompileFilterLongJumps(t *testing.T) {
+	// Enough alternatives to push the reject label beyond the reach of a
+	// conditional jump
+	var parts []string
+	for port := 1000; port < 1040; port++ {
+		parts = append(parts, "port "+strconv.Itoa(port))
+	}
+	alternatives := strings.Join(parts, " or ")
+	first := testPacket{data: ether(etherTypeIPv4, ipv4("10.0.0.1", "10.0.1.2", protoTCP, 0, 0, ports(40000, 1000))), linkType: LinkTypeEthernet}
+	first6 := testPacket{data: ether(etherTypeIPv6, ipv6("fd00::1", "fd00::2", protoUDP, ports(1001, 40000))), linkType: LinkTypeEthernet}
+
+	tests := []struct {
+		expr   string
+		packet testPacket
+		want   bool
+	}{
+		{alternatives + " or port 80", testPacket{data: tcp4, linkType: LinkTypeEthernet}, true},
+		{alternatives + " or port 443", testPacket{data: tcp6, linkType: LinkTypeEthernet}, true},
+		{alternatives, testPacket{data: tcp4, linkType: LinkTypeEthernet}, false},
+		{alternatives, first, true},
+		{alternatives, first6, true},
+		{"not (" + alternatives + ") and tcp", first, false},
+		{"not (" + alternatives + ") and tcp", testPacket{data: tcp4, linkType: LinkTypeEthernet}, true},
+		{"vlan 10 and (" + alternatives + " or port 53) and host 10.0.0.1", testPacket{data: dns4, linkType: LinkTypeEthernet, tagged: true, vlanTCI: 10}, true},
+		{"vlan 10 and (" + alternatives + " or port 53) and host 10.0.0.9", testPacket{data: dns4, linkType: LinkTypeEthernet, tagged: true, vlanTCI: 10}, false},
+	}
+
+	for _, tt := range tests {
+		prog, err := CompileFilter(tt.expr, tt.packet.linkType, testSnaplen)
+		if err != nil {
+			t.Fatalf("CompileFilter: %v", err)
+		}
+
+		long := false
+		for pc, in := range prog {
+			if in.Code&0x07 != unix.BPF_JMP {
+				continue
+			}
+			targets := []int{pc + 1 + int(in.Jt), pc + 1 + int(in.Jf)}
+			if in.Code == unix.BPF_JMP|unix.BPF_JA {
+				long = true
+				targets = []int{pc + 1 + int(in.K)}
+			}
+			for _, target := range targets {
+				if target >= len(prog) {
+					t.Fatalf("pc %d: jump to %d past the end of a %d-instruction program", pc, target, len(prog))
+				}
+			}
+		}
+		if !long {
+			t.Errorf("%d-instruction program has no long jump", len(prog))
+		}
+
+		if got := run(t, prog, tt.packet); (got != 0) != tt.want {
+			t.Errorf("long filter on %d-byte packet: accepted=%v, want %v", len(tt.packet.data), got != 0, tt.want)
+		}
+	}
+
+	var huge []string
+	for port := 1; port < 400; port++ {
+		huge = append(huge, "port "+strconv.Itoa(port))
+	}
+	if _, err := CompileFilter(strings.Join(huge, " or "), LinkTypeEthernet, testSnaplen); err == nil {
+		t.Errorf("CompileFilter accepted a program longer than %d instructions", maxInsns)
+	}
+}
+
+func TestCompileFilterErrors(t *testing.T) {
+	for _, expr := range []string{
+		"port",
+		"host",
+		"host nope",
+		"net 10.0.0.0/33",
+		"port 70000",
+		"vlan 5000",
+		"vlan 0",
+		"(tcp",
+		"tcp)",
+		"tcp and",
+		"not",
+		"frobnicate",
+		"icmp port 80",
+		"arp host fd00::1",
+		"ip6 host 10.0.0.1",
+		"ether host 10.0.0.1",
+	} {
+		if _, err := CompileFilter(expr, LinkTypeEthernet, testSnaplen); err == nil {
+			t.Errorf("CompileFilter(%q) succeeded, want an error", expr)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package capture
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// pcapng block types
+const (
+	blockSectionHeader         = 0x0a0d0d0a
+	blockInterfaceDesc         = 0x00000001
+	blockEnhancedPacket        = 0x00000006
+	byteOrderMagic             = 0x1a2b3c4d
+	optEndOfOpt                = 0
+	optSHBUserAppl             = 4
+	optIfName                  = 2
+	optIfDescription           = 3
+	optIfTSResol               = 9
+	optEPBFlags                = 2
+	epbFlagInbound      uint32 = 1
+	epbFlagOutbound     uint32 = 2
+)
+
+// PcapngWriter writes a pcapng section with one interface description
+// block per captured interface. Timestamps have nanosecond resolution.
+type PcapngWriter struct {
+	w          io.Writer
+	interfaces uint32
+}
+
+// NewPcapngWriter writes the section header and returns the writer
+func NewPcapngWriter(w io.Writer) (*PcapngWriter, error) {
+	body := make([]byte, 16)
+	binary.LittleEndian.PutUint32(body[0:], byteOrderMagic)
+	binary.LittleEndian.PutUint16(body[4:], 1) // Major version
+	binary.LittleEndian.PutUint16(body[6:], 0) // Minor version
+	binary.LittleEndian.PutUint64(body[8:], ^uint64(0))
+	body = appendOption(body, optSHBUserAppl, []byte("gonett"))
+	body = appendOption(body, optEndOfOpt, nil)
+
+	pw := &PcapngWriter{w: w}
+	return pw, pw.writeBlock(blockSectionHeader, body)
+}
+
+// AddInterface writes an interface description block and returns the
+// interface ID packets refer to
+func (pw *PcapngWriter) AddInterface(name, description string, linkType uint16, snaplen uint32) (uint32, error) {
+	body := make([]byte, 8)
+	binary.LittleEndian.PutUint16(body[0:], linkType)
+	binary.LittleEndian.PutUint32(body[4:], snaplen)
+	body = appendOption(body, optIfName, []byte(name))
+	if description != "" {
+		body = appendOption(body, optIfDescription, []byte(description))
+	}
+	body = appendOption(body, optIfTSResol, []byte{9})
+	body = appendOption(body, optEndOfOpt, nil)
+
+	if err := pw.writeBlock(blockInterfaceDesc, body); err != nil {
+		return 0, err
+	}
+	pw.interfaces++
+	return pw.interfaces - 1, nil
+}
+
+// WritePacket writes an enhanced packet block. origLen is the length of the
+// packet on the wire, data may be shorter when truncated to the snaplen.
+func (pw *PcapngWriter) WritePacket(iface uint32, ts time.Time, data []byte, origLen int, outbound bool) error {
+	nanos := uint64(ts.UnixNano())
+
+	body := make([]byte, 20, 20+len(data)+16)
+	binary.LittleEndian.PutUint32(body[0:], iface)
+	binary.LittleEndian.PutUint32(body[4:], uint32(nanos>>32))
+	binary.LittleEndian.PutUint32(body[8:], uint32(nanos))
+	binary.LittleEndian.PutUint32(body[12:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(body[16:], uint32(origLen))
+	body = append(body, data...)
+	body = append(body, make([]byte, padding(len(data)))...)
+
+	flags := make([]byte, 4)
+	binary.LittleEndian.PutUint32(flags, epbFlagInbound)
+	if outbound {
+		binary.LittleEndian.PutUint32(flags, epbFlagOutbound)
+	}
+	body = appendOption(body, optEPBFlags, flags)
+	body = appendOption(body, optEndOfOpt, nil)
+
+	return pw.writeBlock(blockEnhancedPacket, body)
+}
+
+// writeBlock frames a block body with its type and total length
+func (pw *PcapngWriter) writeBlock(blockType uint32, body []byte) error {
+	total := uint32(12 + len(body))
+	buf := make([]byte, 0, total)
+	buf = binary.LittleEndian.AppendUint32(buf, blockType)
+	buf = binary.LittleEndian.AppendUint32(buf, total)
+	buf = append(buf, body...)
+	buf = binary.LittleEndian.AppendUint32(buf, total)
+
+	_, err := pw.w.Write(buf)
+	return err
+}
+
+// appendOption appends a pcapng option padded to 32 bits
+func appendOption(buf []byte, code uint16, value []byte) []byte {
+	buf = binary.LittleEndian.AppendUint16(buf, code)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(value)))
+	buf = append(buf, value...)
+	return append(buf, make([]byte, padding(len(value)))...)
+}
+
+func padding(n int) int {
+	return (4 - n%4) % 4
+}
@@ -0,0 +1,181 @@
+package domain
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/vishvananda/netlink"
+)
+
+// Bond represents a bond (LAG) device aggregating several member interfaces
+type Bond struct {
+	Name       string     `json:"name"`
+	Mode       string     `json:"mode"`
+	HashPolicy string     `json:"hash_policy,omitempty"`
+	Namespace  *Namespace `json:"namespace,omitempty"`
+	Port       int        `json:"port,omitempty"`
+	Peer       string     `json:"peer,omitempty"` // "<node>:<bond>" on the other end
+	Members    []string   `json:"members,omitempty"`
+	Addrs      []string   `json:"addrs,omitempty"`
+	MAC        string     `json:"mac,omitempty"`
+	MTU        int        `json:"mtu,omitempty"`
+	Neighbors  []Neighbor `json:"neighbors,omitempty"`
+	CreatedAt  string     `json:"created_at"`
+}
+
+// BondMemberState is the live state of a bond member interface
+type BondMemberState struct {
+	Name      string `json:"name"`
+	OperState string `json:"oper_state"`
+	State     string `json:"state"`      // ACTIVE or BACKUP as seen by the bond
+	MiiStatus string `json:"mii_status"` // UP or DOWN link monitoring result
+	Failures  uint32 `json:"link_failures"`
+}
+
+// bondMiimon is the link monitoring interval in milliseconds, so member
+// failures trigger failover
+const bondMiimon = 100
+
+// CreateBond creates a bond device inside the namespace. Mode is a kernel
+// bonding mode name such as "active-backup", "802.3ad" or "balance-xor";
+// hashPolicy is an optional transmit hash policy such as "layer3+4".
+func CreateBond(name, mode, hashPolicy string, namespace *Namespace) (*Bond, error) {
+	bondMode := netlink.StringToBondMode(mode)
+	if bondMode == netlink.BOND_MODE_UNKNOWN {
+		return nil, fmt.Errorf("unknown bond mode %q", mode)
+	}
+
+	bond := netlink.NewLinkBond(netlink.LinkAttrs{Name: name})
+	bond.Mode = bondMode
+	bond.Miimon = bondMiimon
+	if bondMode == netlink.BOND_MODE_802_3AD {
+		bond.LacpRate = netlink.BOND_LACP_RATE_FAST
+	}
+	if hashPolicy != "" {
+		policy := netlink.StringToBondXmitHashPolicy(hashPolicy)
+		if policy == netlink.BOND_XMIT_HASH_POLICY_UNKNOWN {
+			return nil, fmt.Errorf("unknown bond hash policy %q", hashPolicy)
+		}
+		bond.XmitHashPolicy = policy
+	}
+
+	err := runInNamespace(namespace, func() error {
+		if err := netlink.LinkAdd(bond); err != nil {
+			return fmt.Errorf("add bond %s: %w", name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Bond{
+		Name:       name,
+		Mode:       mode,
+		HashPolicy: hashPolicy,
+		Namespace:  namespace,
+		CreatedAt:  time.Now().Format(time.RFC3339),
+	}, nil
+}
+
+// Enslave adds an interface to the bond and brings both up
+func (b *Bond) Enslave(member string) error {
+	err := runInNamespace(b.Namespace, func() error {
+		bondLink, err := netlink.LinkByName(b.Name)
+		if err != nil {
+			return fmt.Errorf("lookup bond %s: %w", b.Name, err)
+		}
+
+		memberLink, err := netlink.LinkByName(member)
+		if err != nil {
+			return fmt.Errorf("lookup member %s: %w", member, err)
+		}
+
+		// The kernel refuses to enslave interfaces that are up
+		if err := netlink.LinkSetDown(memberLink); err != nil {
+			return fmt.Errorf("member down: %w", err)
+		}
+		if err := netlink.LinkSetMaster(memberLink, bondLink); err != nil {
+			return fmt.Errorf("enslave %s: %w", member, err)
+		}
+		if err := netlink.LinkSetUp(memberLink); err != nil {
+			return fmt.Errorf("member up: %w", err)
+		}
+
+		return netlink.LinkSetUp(bondLink)
+	})
+	if err != nil {
+		return err
+	}
+
+	b.Members = append(b.Members, member)
+	return nil
+}
+
+// AssignIP assigns an IP address to the bond device and records it
+func (b *Bond) AssignIP(ipCIDR string) error {
+	if err := assignIP(b.Name, ipCIDR, b.Namespace); err != nil {
+		return err
+	}
+
+	b.Addrs = append(b.Addrs, ipCIDR)
+	return nil
+}
+
+// SetHardwareAddr sets the bond's MAC address. Set before enslaving, the
+// bond keeps it instead of inheriting the first member's address.
+func (b *Bond) SetHardwareAddr(mac net.HardwareAddr) error {
+	if err := SetHardwareAddr(b.Name, mac, b.Namespace); err != nil {
+		return err
+	}
+
+	b.MAC = mac.String()
+	return nil
+}
+
+// SetMTU sets the bond's MTU. Members enslaved afterwards take it over.
+func (b *Bond) SetMTU(mtu int) error {
+	if err := SetMTU(b.Name, mtu, b.Namespace); err != nil {
+		return err
+	}
+
+	b.MTU = mtu
+	return nil
+}
+
+// AddNeighbor installs a permanent neighbor entry on the bond and records it
+func (b *Bond) AddNeighbor(ip net.IP, mac net.HardwareAddr) error {
+	if err := AddNeighbor(b.Name, ip, mac, b.Namespace); err != nil {
+		return err
+	}
+
+	b.Neighbors = append(b.Neighbors, Neighbor{IP: ip.String(), MAC: mac.String()})
+	return nil
+}
+
+// MemberStates reads the live state of every bond member from the kernel
+func (b *Bond) MemberStates() ([]BondMemberState, error) {
+	var states []BondMemberState
+
+	err := runInNamespace(b.Namespace, func() error {
+		for _, member := range b.Members {
+			state := BondMemberState{Name: member, OperState: "missing", State: "-", MiiStatus: "-"}
+
+			link, err := netlink.LinkByName(member)
+			if err == nil {
+				state.OperState = link.Attrs().OperState.String()
+				if slave, ok := link.Attrs().Slave.(*netlink.BondSlave); ok {
+					state.State = slave.State.String()
+					state.MiiStatus = slave.MiiStatus.String()
+					state.Failures = slave.LinkFailureCount
+				}
+			}
+
+			states = append(states, state)
+		}
+		return nil
+	})
+
+	return states, err
+}
@@ -6,18 +6,102 @@ import (
 	"time"
 
 	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
 	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
 )
 
 // Bridge represents a network bridge
 type Bridge struct {
-	ID        string     `json:"id"`
-	Name      string     `json:"name"`
-	Namespace *Namespace `json:"namespace,omitempty"`
-	CreatedAt string     `json:"created_at"`
-	Veths     []Veth     `json:"veths,omitempty"`
+	ID        string        `json:"id"`
+	Name      string        `json:"name"`
+	Namespace *Namespace    `json:"namespace,omitempty"`
+	Options   BridgeOptions `json:"options"`
+	Ports     []BridgePort  `json:"ports,omitempty"`
+	Mirrors   []Mirror      `json:"mirrors,omitempty"`
+	CreatedAt string        `json:"created_at"`
+	Veths     []Veth        `json:"veths,omitempty"`
 }
 
+// BridgeOptions holds the switch features applied when the bridge is created.
+// STP is the kernel's 802.1D implementation; RSTP needs a userspace daemon
+// such as mstpd running in the switch namespace.
+type BridgeOptions struct {
+	STP           bool   `json:"stp,omitempty"`
+	ForwardDelay  uint32 `json:"forward_delay,omitempty"` // seconds, kernel default when 0
+	VLANFiltering bool   `json:"vlan_filtering,omitempty"`
+	AgeingTime    uint32 `json:"ageing_time,omitempty"` // seconds, kernel default when 0
+	IGMPSnooping  *bool  `json:"igmp_snooping,omitempty"`
+}
+
+// PortVLAN describes the VLAN membership of a bridge port. An access port
+// carries a single untagged VLAN; a trunk carries tagged VLANs and an
+// optional untagged native VLAN.
+type PortVLAN struct {
+	Access int   `json:"access,omitempty"`
+	Trunk  []int `json:"trunk,omitempty"`
+	Native int   `json:"native,omitempty"`
+}
+
+// Validate checks VLAN IDs and that access and trunk settings are not mixed.
+// A port that is not an access port must trunk at least one VLAN.
+func (v *PortVLAN) Validate() error {
+	if v.Access > 0 && (len(v.Trunk) > 0 || v.Native > 0) {
+		return fmt.Errorf("port cannot be both access and trunk")
+	}
+	if v.Access < 0 || v.Access > maxVLANID {
+		return fmt.Errorf("invalid access vlan id %d", v.Access)
+	}
+	if v.Access > 0 {
+		return nil
+	}
+
+	if len(v.Trunk) == 0 {
+		return fmt.Errorf("trunk port needs at least one vlan (use access for a single untagged vlan)")
+	}
+	for _, vid := range v.Trunk {
+		if vid < 1 || vid > maxVLANID {
+			return fmt.Errorf("invalid trunk vlan id %d (want 1-%d)", vid, maxVLANID)
+		}
+	}
+	if v.Native < 0 || v.Native > maxVLANID {
+		return fmt.Errorf("invalid native vlan id %d (want 1-%d)", v.Native, maxVLANID)
+	}
+	return nil
+}
+
+// String formats the VLAN membership as "access 10" or "trunk 10,20 native 1"
+func (v *PortVLAN) String() string {
+	if v.Access > 0 {
+		return fmt.Sprintf("access %d", v.Access)
+	}
+	s := "trunk"
+	for i, vid := range v.Trunk {
+		if i == 0 {
+			s += " "
+		} else {
+			s += ","
+		}
+		s += fmt.Sprintf("%d", vid)
+	}
+	if v.Native > 0 {
+		s += fmt.Sprintf(" native %d", v.Native)
+	}
+	return s
+}
+
+// BridgePort is an interface attached to a bridge
+type BridgePort struct {
+	Interface string    `json:"interface"`
+	VLAN      *PortVLAN `json:"vlan,omitempty"`
+}
+
+// defaultVLAN is the VLAN the kernel puts every new bridge port in
+const defaultVLAN = 1
+
+// maxVLANID is the highest usable 802.1Q VLAN ID
+const maxVLANID = 4094
+
 func NewBridge(id, name string, namespace *Namespace) *Bridge {
 	return &Bridge{
 		ID:        id,
@@ -29,6 +113,11 @@ func NewBridge(id, name string, namespace *Namespace) *Bridge {
 }
 
 func CreateBridge(name string, namespace *Namespace) (*Bridge, error) {
+	return CreateBridgeWithOptions(name, namespace, BridgeOptions{})
+}
+
+// CreateBridgeWithOptions creates a bridge inside the namespace with the given switch features
+func CreateBridgeWithOptions(name string, namespace *Namespace, opts BridgeOptions) (*Bridge, error) {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 
@@ -55,6 +144,15 @@ func CreateBridge(name string, namespace *Namespace) (*Bridge, error) {
 		LinkAttrs: netlink.LinkAttrs{
 			Name: name,
 		},
+		MulticastSnooping: opts.IGMPSnooping,
+	}
+	if opts.VLANFiltering {
+		vlanFiltering := true
+		br.VlanFiltering = &vlanFiltering
+	}
+	if opts.AgeingTime > 0 {
+		ageingTime := opts.AgeingTime * userHZ
+		br.AgeingTime = &ageingTime
 	}
 
 	if err := netlink.LinkAdd(br); err != nil {
@@ -69,6 +167,12 @@ func CreateBridge(name string, namespace *Namespace) (*Bridge, error) {
 		return nil, fmt.Errorf("lookup bridge: %w", err)
 	}
 
+	// STP and forward delay are not exposed by netlink.Bridge
+	if err := setBridgeSTP(link, opts); err != nil {
+		netns.Set(origNS)
+		return nil, fmt.Errorf("configure stp: %w", err)
+	}
+
 	// Bring up the bridge interface
 	if err := netlink.LinkSetUp(link); err != nil {
 		netns.Set(origNS)
@@ -84,6 +188,7 @@ func CreateBridge(name string, namespace *Namespace) (*Bridge, error) {
 		ID:        "",
 		Name:      name,
 		Namespace: namespace,
+		Options:   opts,
 		CreatedAt: time.Now().Format(time.RFC3339),
 		Veths:     []Veth{},
 	}
@@ -91,6 +196,36 @@ func CreateBridge(name string, namespace *Namespace) (*Bridge, error) {
 	return bridge, nil
 }
 
+// userHZ is the clock_t resolution the kernel uses for bridge timers
+const userHZ = 100
+
+// setBridgeSTP sets the STP state and forward delay of a bridge with a raw
+// RTM_NEWLINK request. Must be called inside the bridge's namespace.
+func setBridgeSTP(link netlink.Link, opts BridgeOptions) error {
+	if !opts.STP && opts.ForwardDelay == 0 {
+		return nil
+	}
+
+	req := nl.NewNetlinkRequest(unix.RTM_NEWLINK, unix.NLM_F_ACK)
+	msg := nl.NewIfInfomsg(unix.AF_UNSPEC)
+	msg.Index = int32(link.Attrs().Index)
+	req.AddData(msg)
+
+	linkInfo := nl.NewRtAttr(unix.IFLA_LINKINFO, nil)
+	linkInfo.AddRtAttr(nl.IFLA_INFO_KIND, nl.NonZeroTerminated("bridge"))
+	data := linkInfo.AddRtAttr(nl.IFLA_INFO_DATA, nil)
+	if opts.ForwardDelay > 0 {
+		data.AddRtAttr(nl.IFLA_BR_FORWARD_DELAY, nl.Uint32Attr(opts.ForwardDelay*userHZ))
+	}
+	if opts.STP {
+		data.AddRtAttr(nl.IFLA_BR_STP_STATE, nl.Uint32Attr(1))
+	}
+	req.AddData(linkInfo)
+
+	_, err := req.Execute(unix.NETLINK_ROUTE, 0)
+	return err
+}
+
 // AddInterface adds an interface to the bridge
 func (b *Bridge) AddInterface(veth Veth) error {
 	// Save current ns
@@ -145,7 +280,17 @@ func (b *Bridge) AddInterface(veth Veth) error {
 }
 
 // AttachInterfaceByName attaches an interface to the bridge by interface name
-func (b *Bridge) AttachInterfaceByName(ifName string) error {
+// and, when vlan is set, configures the port as an access or trunk port
+func (b *Bridge) AttachInterfaceByName(ifName string, vlan *PortVLAN) error {
+	if vlan != nil {
+		if !b.Options.VLANFiltering {
+			return fmt.Errorf("vlan configuration on %s requires vlan filtering on bridge %s", ifName, b.Name)
+		}
+		if err := vlan.Validate(); err != nil {
+			return fmt.Errorf("vlan configuration on %s: %w", ifName, err)
+		}
+	}
+
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 
@@ -200,9 +345,49 @@ func (b *Bridge) AttachInterfaceByName(ifName string) error {
 		return fmt.Errorf("set up: %w", err)
 	}
 
+	// Configure port VLAN membership
+	if vlan != nil {
+		if err := configurePortVLAN(ifLink, vlan); err != nil {
+			netns.Set(origNS)
+			return fmt.Errorf("configure vlan on %s: %w", ifName, err)
+		}
+	}
+
 	// Restore namespace immediately
 	netns.Set(origNS)
 
+	b.Ports = append(b.Ports, BridgePort{Interface: ifName, VLAN: vlan})
+
+	return nil
+}
+
+// configurePortVLAN replaces the default VLAN of a bridge port with the
+// access or trunk configuration. Must be called inside the bridge's namespace.
+func configurePortVLAN(link netlink.Link, vlan *PortVLAN) error {
+	untagged := vlan.Access
+	if untagged == 0 {
+		untagged = vlan.Native
+	}
+
+	if err := netlink.BridgeVlanDel(link, defaultVLAN, true, true, false, true); err != nil {
+		return fmt.Errorf("remove default vlan: %w", err)
+	}
+
+	if untagged > 0 {
+		if err := netlink.BridgeVlanAdd(link, uint16(untagged), true, true, false, true); err != nil {
+			return fmt.Errorf("add untagged vlan %d: %w", untagged, err)
+		}
+	}
+
+	for _, vid := range vlan.Trunk {
+		if vid == untagged {
+			continue
+		}
+		if err := netlink.BridgeVlanAdd(link, uint16(vid), false, false, false, true); err != nil {
+			return fmt.Errorf("add tagged vlan %d: %w", vid, err)
+		}
+	}
+
 	return nil
 }
 
@@ -1,7 +1,9 @@
 package domain
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -14,13 +16,27 @@ import (
 
 // Container represents a container with its network components
 type Container struct {
-	ID        string     `json:"id"`
-	Name      string     `json:"name"`
-	CreatedAt string     `json:"created_at"`
-	Namespace *Namespace `json:"namespace,omitempty"`
-	Bridges   []Bridge   `json:"bridges,omitempty"`
-	Veths     []Veth     `json:"veths,omitempty"`
-	isChild   bool       `json:"-"`
+	ID        string              `json:"id"`
+	Name      string              `json:"name"`
+	Type      string              `json:"type,omitempty"`
+	Lab       string              `json:"lab,omitempty"`
+	CreatedAt string              `json:"created_at"`
+	Namespace *Namespace          `json:"namespace,omitempty"`
+	Bridges   []Bridge            `json:"bridges,omitempty"`
+	Veths     []Veth              `json:"veths,omitempty"`
+	VLANs     []VLANInterface     `json:"vlans,omitempty"`
+	Bonds     []Bond              `json:"bonds,omitempty"`
+	Tunnels   []Tunnel            `json:"tunnels,omitempty"`
+	Routes    []Route             `json:"routes,omitempty"`
+	NAT       *NAT                `json:"nat,omitempty"`
+	Externals []ExternalInterface `json:"externals,omitempty"`
+	Sysctls   map[string]string   `json:"sysctls,omitempty"`
+	Services  []Service           `json:"services,omitempty"`
+	Leases    []DHCPLease         `json:"leases,omitempty"`
+	Resolver  *Resolver           `json:"resolver,omitempty"`
+	BuildTime float64             `json:"build_seconds,omitempty"` // How long building the container's lab took
+	Execs     int                 `json:"-"`                       // Commands run through gonett exec, kept in a counter file
+	isChild   bool                `json:"-"`
 }
 
 func NewContainer(name string, isChild bool) *Container {
@@ -64,11 +80,16 @@ func (c *Container) AddNamespace(name string) error {
 
 // AddBridge creates and adds a bridge to the container's namespace
 func (c *Container) AddBridge(name string) (*Bridge, error) {
+	return c.AddBridgeWithOptions(name, BridgeOptions{})
+}
+
+// AddBridgeWithOptions creates and adds a bridge with switch features to the container's namespace
+func (c *Container) AddBridgeWithOptions(name string, opts BridgeOptions) (*Bridge, error) {
 	if c.Namespace == nil {
 		return nil, fmt.Errorf("container does not have a namespace")
 	}
 
-	bridge, err := CreateBridge(name, c.Namespace)
+	bridge, err := CreateBridgeWithOptions(name, c.Namespace, opts)
 	if err != nil {
 		return nil, fmt.Errorf("create bridge: %w", err)
 	}
@@ -77,6 +98,16 @@ func (c *Container) AddBridge(name string) (*Bridge, error) {
 	return bridge, nil
 }
 
+// BridgeWithPort returns the container's bridge an interface is attached to
+func (c *Container) BridgeWithPort(ifName string) *Bridge {
+	for i := range c.Bridges {
+		if c.Bridges[i].hasPort(ifName) {
+			return &c.Bridges[i]
+		}
+	}
+	return nil
+}
+
 // AddVeth creates and adds a veth pair to the container
 func (c *Container) AddVeth(nsA, nsB *Namespace, name string) (*Veth, error) {
 	veth, err := CreateVeth(nsA, nsB, name)
@@ -88,6 +119,94 @@ func (c *Container) AddVeth(nsA, nsB *Namespace, name string) (*Veth, error) {
 	return veth, nil
 }
 
+// FindVeth returns the veth with an end named ifName in the container's
+// namespace
+func (c *Container) FindVeth(ifName string) *Veth {
+	for i := range c.Veths {
+		v := &c.Veths[i]
+		if v.Name == ifName && SameNamespace(v.NamespaceA, c.Namespace) {
+			return v
+		}
+		if v.PeerName == ifName && SameNamespace(v.NamespaceB, c.Namespace) {
+			return v
+		}
+	}
+	return nil
+}
+
+// HasLink reports whether the container records the veth
+func (c *Container) HasLink(veth Veth) bool {
+	for i := range c.Veths {
+		if c.Veths[i].SameLink(veth) {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveVeth drops the container's record of a veth along with the bridge
+// ports its ends occupied
+func (c *Container) RemoveVeth(veth Veth) {
+	var veths []Veth
+	for _, v := range c.Veths {
+		if !v.SameLink(veth) {
+			veths = append(veths, v)
+		}
+	}
+	c.Veths = veths
+
+	for i := range c.Bridges {
+		bridge := &c.Bridges[i]
+		var ports []BridgePort
+		for _, p := range bridge.Ports {
+			if p.Interface != veth.Name && p.Interface != veth.PeerName {
+				ports = append(ports, p)
+			}
+		}
+		bridge.Ports = ports
+	}
+}
+
+// AddVLANInterface creates an 802.1Q sub-interface on a parent interface in
+// the container's namespace and records it on the container
+func (c *Container) AddVLANInterface(parent string, vid int) (*VLANInterface, error) {
+	if c.Namespace == nil {
+		return nil, fmt.Errorf("container does not have a namespace")
+	}
+
+	vlan, err := CreateVLANInterface(parent, vid, c.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("create vlan interface: %w", err)
+	}
+
+	c.VLANs = append(c.VLANs, *vlan)
+	return &c.VLANs[len(c.VLANs)-1], nil
+}
+
+// Addresses returns every address recorded on the container's interfaces
+// in CIDR format
+func (c *Container) Addresses() []string {
+	var addrs []string
+	for _, v := range c.Veths {
+		if SameNamespace(v.NamespaceA, c.Namespace) {
+			addrs = append(addrs, v.AddrsA...)
+		}
+		if SameNamespace(v.NamespaceB, c.Namespace) {
+			addrs = append(addrs, v.AddrsB...)
+		}
+	}
+	for _, b := range c.Bonds {
+		addrs = append(addrs, b.Addrs...)
+	}
+	for _, t := range c.Tunnels {
+		addrs = append(addrs, t.Addrs...)
+	}
+	for _, v := range c.VLANs {
+		addrs = append(addrs, v.Addrs...)
+	}
+	return addrs
+}
+
 // ConnectVethToBridge connects a veth end to a bridge in the container's namespace
 func (c *Container) ConnectVethToBridge(vethName, bridgeName, vethEnd string) error {
 	if c.Namespace == nil {
@@ -133,9 +252,25 @@ func (c *Container) ConnectVethToBridge(vethName, bridgeName, vethEnd string) er
 
 // Exec executes a command inside the container's namespace
 func (c *Container) Exec(cmd []string) error {
+	return c.ExecIO(cmd, os.Stdin, os.Stdout, os.Stderr)
+}
+
+// ExecIO executes a command inside the container's namespace with the
+// given standard streams. Like exec.Cmd, it only returns once a stdin that
+// is not an *os.File reaches EOF.
+func (c *Container) ExecIO(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	return c.ExecContext(context.Background(), cmd, stdin, stdout, stderr)
+}
+
+// ExecContext is ExecIO with a command that is killed, along with the
+// processes it started, when ctx is done
+func (c *Container) ExecContext(ctx context.Context, cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
 	if c.Namespace == nil {
 		return fmt.Errorf("container does not have a namespace")
 	}
+	if len(cmd) == 0 {
+		return fmt.Errorf("no command given")
+	}
 
 	// Lock OS thread for namespace operations
 	runtime.LockOSThread()
@@ -163,15 +298,36 @@ func (c *Container) Exec(cmd []string) error {
 	// Restore original namespace before returning
 	defer unix.Setns(int(origNS.Fd()), unix.CLONE_NEWNET)
 
-	// Run the command in the namespace
-	execution := exec.Command(cmd[0], cmd[1:]...)
-	execution.Stdout = os.Stdout
-	execution.Stderr = os.Stderr
-	execution.Stdin = os.Stdin
+	// Run the command in the namespace. When the namespace has its own /etc
+	// files (resolv.conf), go through a helper that mounts them in a private
+	// mount namespace first.
+	execution := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
+	execution.SysProcAttr = &syscall.SysProcAttr{}
+	if c.Namespace.HasEtc() {
+		execution = exec.CommandContext(ctx, "/proc/self/exe", append([]string{NsexecCommand, c.Namespace.EtcDir()}, cmd...)...)
+		execution.SysProcAttr = &syscall.SysProcAttr{Unshareflags: syscall.CLONE_NEWNS}
+	}
+	// A cancellable command gets its own process group so cancelling kills
+	// its children too. Others stay in the caller's group, which owns the
+	// terminal they may read from.
+	if ctx.Done() != nil {
+		execution.SysProcAttr.Setpgid = true
+		execution.Cancel = func() error {
+			return syscall.Kill(-execution.Process.Pid, syscall.SIGKILL)
+		}
+		execution.WaitDelay = execWaitDelay
+	}
+	execution.Stdout = stdout
+	execution.Stderr = stderr
+	execution.Stdin = stdin
 
 	return execution.Run()
 }
 
+// execWaitDelay is how long a cancelled command may keep its output pipes
+// open after being killed
+const execWaitDelay = time.Second
+
 // AttachShell attaches to an interactive shell in the container's namespace
 func (c *Container) AttachShell() error {
 	if c.Namespace == nil {
@@ -185,6 +341,8 @@ func (c *Container) AttachShell() error {
 
 	// Parent process: fork and exec ourselves with special flag
 	cmd := exec.Command("/proc/self/exe", "__gonett_nsenter__", c.Namespace.Path, c.Name)
+	// A private mount namespace lets the child mount /etc/netns files
+	cmd.SysProcAttr = &syscall.SysProcAttr{Unshareflags: syscall.CLONE_NEWNS}
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
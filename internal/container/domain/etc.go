@@ -0,0 +1,104 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// NetnsEtcDir holds per-namespace files that replace their /etc
+// counterpart inside the namespace, following the iproute2 convention
+// (/etc/netns/<name>/resolv.conf)
+const NetnsEtcDir = "/etc/netns"
+
+// NsexecCommand is the hidden command running a program inside a private
+// mount namespace with the namespace's /etc/netns files bind mounted
+const NsexecCommand = "__gonett_nsexec__"
+
+// Resolver is the DNS configuration written to a container's resolv.conf
+type Resolver struct {
+	Nameservers []string `json:"nameservers"`
+	Search      []string `json:"search,omitempty"`
+}
+
+// SetResolver writes the container's resolv.conf and records it
+func (c *Container) SetResolver(r Resolver) error {
+	if c.Namespace == nil {
+		return fmt.Errorf("container %s has no namespace", c.Name)
+	}
+	if err := c.Namespace.WriteResolvConf(r.Nameservers, r.Search); err != nil {
+		return err
+	}
+	c.Resolver = &r
+	return nil
+}
+
+// EtcDir returns the directory whose files replace /etc entries for
+// programs run inside the namespace
+func (ns *Namespace) EtcDir() string {
+	return filepath.Join(NetnsEtcDir, ns.Name)
+}
+
+// HasEtc reports whether the namespace has any /etc replacement files
+func (ns *Namespace) HasEtc() bool {
+	entries, err := os.ReadDir(ns.EtcDir())
+	return err == nil && len(entries) > 0
+}
+
+// WriteResolvConf writes the resolv.conf used by programs run inside the
+// namespace through gonett exec/attach (or ip netns exec)
+func (ns *Namespace) WriteResolvConf(nameservers, search []string) error {
+	if err := os.MkdirAll(ns.EtcDir(), 0755); err != nil {
+		return fmt.Errorf("create %s: %w", ns.EtcDir(), err)
+	}
+
+	var b strings.Builder
+	b.WriteString("# Generated by gonett\n")
+	if len(search) > 0 {
+		fmt.Fprintf(&b, "search %s\n", strings.Join(search, " "))
+	}
+	for _, ns := range nameservers {
+		fmt.Fprintf(&b, "nameserver %s\n", ns)
+	}
+
+	path := filepath.Join(ns.EtcDir(), "resolv.conf")
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
+
+// RemoveEtc deletes the namespace's /etc replacement files
+func (ns *Namespace) RemoveEtc() error {
+	if err := os.RemoveAll(ns.EtcDir()); err != nil {
+		return fmt.Errorf("remove %s: %w", ns.EtcDir(), err)
+	}
+	return nil
+}
+
+// BindEtc bind mounts every file of dir over the matching /etc entry. It
+// must run in a private mount namespace, otherwise the mounts leak into the
+// host. A missing dir is not an error.
+func BindEtc(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read %s: %w", dir, err)
+	}
+
+	for _, entry := range entries {
+		src := filepath.Join(dir, entry.Name())
+		dst := filepath.Join("/etc", entry.Name())
+		if err := unix.Mount(src, dst, "none", unix.MS_BIND, ""); err != nil {
+			return fmt.Errorf("bind %s on %s: %w", src, dst, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package domain
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+// External interface attach modes
+const (
+	ExternalMove    = "move"
+	ExternalMacvlan = "macvlan"
+	ExternalIPVlan  = "ipvlan"
+)
+
+// ExternalInterface is an interface from outside the lab attached to a
+// switch. Moved interfaces remember where they came from so they can be
+// handed back instead of being destroyed with the switch namespace.
+type ExternalInterface struct {
+	Name            string     `json:"name"`
+	Parent          string     `json:"parent"`
+	Mode            string     `json:"mode"`
+	OriginNamespace string     `json:"origin_namespace,omitempty"` // namespace path, empty for the root namespace
+	OriginAddrs     []string   `json:"origin_addrs,omitempty"`
+	OriginUp        bool       `json:"origin_up,omitempty"`
+	Namespace       *Namespace `json:"namespace,omitempty"`
+	CreatedAt       string     `json:"created_at"`
+}
+
+// originNamespace returns the namespace record for a namespace path, or nil
+// for the current (root) namespace
+func originNamespace(path string) *Namespace {
+	if path == "" {
+		return nil
+	}
+	return &Namespace{Name: path, Path: path}
+}
+
+// openNamespace opens a namespace handle for a path, or the current
+// namespace for an empty path
+func openNamespace(path string) (netns.NsHandle, error) {
+	if path == "" {
+		return netns.Get()
+	}
+	return netns.GetFromPath(path)
+}
+
+// AttachExternalInterface brings an interface from the origin namespace into
+// the target namespace to be bridged. In move mode the interface itself is
+// moved; in macvlan mode a new passthru child interface named name is
+// created on top of it and the parent stays where it is.
+func AttachExternalInterface(parent, name, mode, originPath string, namespace *Namespace) (*ExternalInterface, error) {
+	if mode == "" {
+		mode = ExternalMove
+	}
+	if name == "" {
+		name = parent
+	}
+	if len(name) > 15 {
+		return nil, fmt.Errorf("interface name %s is longer than 15 characters", name)
+	}
+
+	target, err := netns.GetFromPath(namespace.Path)
+	if err != nil {
+		return nil, fmt.Errorf("open namespace %s: %w", namespace.Name, err)
+	}
+	defer target.Close()
+
+	ext := &ExternalInterface{
+		Name:            name,
+		Parent:          parent,
+		Mode:            mode,
+		OriginNamespace: originPath,
+		Namespace:       namespace,
+		CreatedAt:       time.Now().Format(time.RFC3339),
+	}
+
+	err = runInNamespace(originNamespace(originPath), func() error {
+		parentLink, err := netlink.LinkByName(parent)
+		if err != nil {
+			return fmt.Errorf("lookup %s: %w", parent, err)
+		}
+
+		switch mode {
+		case ExternalMove:
+			if name != parent {
+				return fmt.Errorf("moved interfaces keep their name")
+			}
+
+			// Remember the configuration the namespace move drops
+			addrs, err := netlink.AddrList(parentLink, netlink.FAMILY_ALL)
+			if err != nil {
+				return fmt.Errorf("list addresses of %s: %w", parent, err)
+			}
+			for _, addr := range addrs {
+				if addr.IP.IsLinkLocalUnicast() {
+					continue
+				}
+				ext.OriginAddrs = append(ext.OriginAddrs, addr.IPNet.String())
+			}
+			ext.OriginUp = parentLink.Attrs().Flags&net.FlagUp != 0
+
+			return netlink.LinkSetNsFd(parentLink, int(target))
+
+		case ExternalMacvlan:
+			// A bridged child carries frames for every MAC in the lab, so
+			// it takes the parent over in passthru mode instead of
+			// filtering on its own MAC
+			return netlink.LinkAdd(&netlink.Macvlan{
+				LinkAttrs: netlink.LinkAttrs{
+					Name:        name,
+					ParentIndex: parentLink.Attrs().Index,
+					Namespace:   netlink.NsFd(target),
+				},
+				Mode: netlink.MACVLAN_MODE_PASSTHRU,
+			})
+
+		case ExternalIPVlan:
+			return fmt.Errorf("ipvlan children share their parent's MAC and cannot be bridged, use macvlan")
+
+		default:
+			return fmt.Errorf("unknown external interface mode %q", mode)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ext, nil
+}
+
+// Restore hands a moved interface back to its origin namespace and
+// reapplies its addresses and up state. Macvlan and ipvlan children are
+// simply deleted; their parent never left.
+func (e *ExternalInterface) Restore() error {
+	if e.Mode != ExternalMove {
+		return runInNamespace(e.Namespace, func() error {
+			if link, err := netlink.LinkByName(e.Name); err == nil {
+				return netlink.LinkDel(link)
+			}
+			return nil
+		})
+	}
+
+	origin, err := openNamespace(e.OriginNamespace)
+	if err != nil {
+		return fmt.Errorf("open origin namespace of %s: %w", e.Name, err)
+	}
+	defer origin.Close()
+
+	err = runInNamespace(e.Namespace, func() error {
+		link, err := netlink.LinkByName(e.Name)
+		if err != nil {
+			return fmt.Errorf("lookup %s: %w", e.Name, err)
+		}
+		if err := netlink.LinkSetNoMaster(link); err != nil {
+			return fmt.Errorf("detach %s from bridge: %w", e.Name, err)
+		}
+		if err := netlink.LinkSetDown(link); err != nil {
+			return fmt.Errorf("set %s down: %w", e.Name, err)
+		}
+		return netlink.LinkSetNsFd(link, int(origin))
+	})
+	if err != nil {
+		return err
+	}
+
+	return runInNamespace(originNamespace(e.OriginNamespace), func() error {
+		link, err := netlink.LinkByName(e.Name)
+		if err != nil {
+			return fmt.Errorf("lookup restored %s: %w", e.Name, err)
+		}
+
+		var errs []string
+		for _, cidr := range e.OriginAddrs {
+			addr, err := netlink.ParseAddr(cidr)
+			if err == nil {
+				err = netlink.AddrAdd(link, addr)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("restore address %s: %v", cidr, err))
+			}
+		}
+		if e.OriginUp {
+			if err := netlink.LinkSetUp(link); err != nil {
+				errs = append(errs, fmt.Sprintf("set %s up: %v", e.Name, err))
+			}
+		}
+
+		if len(errs) > 0 {
+			return fmt.Errorf("%s", strings.Join(errs, "; "))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,74 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// DisableDAD turns off IPv6 duplicate address detection in the namespace.
+// Interfaces created afterwards inherit the "default" setting, and the
+// kernel only skips DAD when both "all" and the interface setting are off.
+func DisableDAD(namespace *Namespace) error {
+	for _, key := range []string{"net.ipv6.conf.all.accept_dad", "net.ipv6.conf.default.accept_dad"} {
+		if _, err := SetSysctl(namespace, key, "0"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnableForwarding turns on IPv4 and IPv6 forwarding in the namespace
+func EnableForwarding(namespace *Namespace) error {
+	for _, key := range []string{"net.ipv4.ip_forward", "net.ipv6.conf.all.forwarding"} {
+		if _, err := SetSysctl(namespace, key, "1"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WaitDAD blocks until no IPv6 address in the namespace is tentative, so
+// addresses are usable as soon as it returns. Addresses that failed DAD are
+// reported as an error.
+func WaitDAD(namespace *Namespace, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		var tentative, failed []string
+
+		err := runInNamespace(namespace, func() error {
+			addrs, err := netlink.AddrList(nil, netlink.FAMILY_V6)
+			if err != nil {
+				return fmt.Errorf("list addresses: %w", err)
+			}
+			for _, addr := range addrs {
+				switch {
+				case addr.Flags&unix.IFA_F_DADFAILED != 0:
+					failed = append(failed, addr.IPNet.String())
+				case addr.Flags&unix.IFA_F_TENTATIVE != 0:
+					tentative = append(tentative, addr.IPNet.String())
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(failed) > 0 {
+			return fmt.Errorf("duplicate address detection failed for %s", strings.Join(failed, ", "))
+		}
+		if len(tentative) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("addresses still tentative after %s: %s", timeout, strings.Join(tentative, ", "))
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+}
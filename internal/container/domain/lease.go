@@ -0,0 +1,12 @@
+package domain
+
+// DHCPLease records an address a container obtained through DHCP
+type DHCPLease struct {
+	Interface  string   `json:"interface"`
+	Address    string   `json:"address"`
+	Router     string   `json:"router,omitempty"`
+	DNS        []string `json:"dns,omitempty"`
+	Server     string   `json:"server"`
+	LeaseTime  int      `json:"lease_time"` // Seconds
+	ObtainedAt string   `json:"obtained_at"`
+}
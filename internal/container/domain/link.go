@@ -0,0 +1,154 @@
+package domain
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/vishvananda/netlink"
+)
+
+// Neighbor is a permanent neighbor (ARP/NDP) entry installed on an interface
+type Neighbor struct {
+	IP  string `json:"ip"`
+	MAC string `json:"mac"`
+}
+
+// DeriveMAC returns a locally administered unicast MAC address encoding a
+// node index and a port number (02:00:NN:NN:PP:PP), so frames in a capture
+// can be traced back to the node and port that sent them
+func DeriveMAC(node, port int) net.HardwareAddr {
+	return net.HardwareAddr{0x02, 0x00, byte(node >> 8), byte(node), byte(port >> 8), byte(port)}
+}
+
+// SetHardwareAddr sets the MAC address of an interface inside a namespace
+func SetHardwareAddr(ifname string, mac net.HardwareAddr, namespace *Namespace) error {
+	return runInNamespace(namespace, func() error {
+		link, err := netlink.LinkByName(ifname)
+		if err != nil {
+			return fmt.Errorf("get link %s: %w", ifname, err)
+		}
+		if err := netlink.LinkSetHardwareAddr(link, mac); err != nil {
+			return fmt.Errorf("set mac %s on %s: %w", mac, ifname, err)
+		}
+		return nil
+	})
+}
+
+// SetLinkUp brings an interface up inside a namespace
+func SetLinkUp(ifname string, namespace *Namespace) error {
+	return runInNamespace(namespace, func() error {
+		link, err := netlink.LinkByName(ifname)
+		if err != nil {
+			return fmt.Errorf("get link %s: %w", ifname, err)
+		}
+		if err := netlink.LinkSetUp(link); err != nil {
+			return fmt.Errorf("set %s up: %w", ifname, err)
+		}
+		return nil
+	})
+}
+
+// SetLinkDown takes an interface down inside a namespace
+func SetLinkDown(ifname string, namespace *Namespace) error {
+	return runInNamespace(namespace, func() error {
+		link, err := netlink.LinkByName(ifname)
+		if err != nil {
+			return fmt.Errorf("get link %s: %w", ifname, err)
+		}
+		if err := netlink.LinkSetDown(link); err != nil {
+			return fmt.Errorf("set %s down: %w", ifname, err)
+		}
+		return nil
+	})
+}
+
+// SetLinkDelay adds a one-way delay to the traffic an interface sends
+// through a netem root qdisc, replacing any root qdisc it had
+func SetLinkDelay(ifname string, delay time.Duration, namespace *Namespace) error {
+	return runInNamespace(namespace, func() error {
+		link, err := netlink.LinkByName(ifname)
+		if err != nil {
+			return fmt.Errorf("get link %s: %w", ifname, err)
+		}
+		netem := netlink.NewNetem(netlink.QdiscAttrs{
+			LinkIndex: link.Attrs().Index,
+			Handle:    netlink.MakeHandle(1, 0),
+			Parent:    netlink.HANDLE_ROOT,
+		}, netlink.NetemQdiscAttrs{Latency: uint32(delay.Microseconds())})
+		if err := netlink.QdiscReplace(netem); err != nil {
+			return fmt.Errorf("set delay %s on %s: %w", delay, ifname, err)
+		}
+		return nil
+	})
+}
+
+// HardwareAddr returns the MAC address of an interface inside a namespace
+func HardwareAddr(ifname string, namespace *Namespace) (net.HardwareAddr, error) {
+	var mac net.HardwareAddr
+	err := runInNamespace(namespace, func() error {
+		link, err := netlink.LinkByName(ifname)
+		if err != nil {
+			return fmt.Errorf("get link %s: %w", ifname, err)
+		}
+		mac = link.Attrs().HardwareAddr
+		return nil
+	})
+	return mac, err
+}
+
+// SetMTU sets the MTU of an interface inside a namespace
+func SetMTU(ifname string, mtu int, namespace *Namespace) error {
+	return runInNamespace(namespace, func() error {
+		link, err := netlink.LinkByName(ifname)
+		if err != nil {
+			return fmt.Errorf("get link %s: %w", ifname, err)
+		}
+		if err := netlink.LinkSetMTU(link, mtu); err != nil {
+			return fmt.Errorf("set mtu %d on %s: %w", mtu, ifname, err)
+		}
+		return nil
+	})
+}
+
+// InterfaceMTU returns the current MTU of an interface inside a namespace
+func InterfaceMTU(ifname string, namespace *Namespace) (int, error) {
+	var mtu int
+	err := runInNamespace(namespace, func() error {
+		link, err := netlink.LinkByName(ifname)
+		if err != nil {
+			return fmt.Errorf("get link %s: %w", ifname, err)
+		}
+		mtu = link.Attrs().MTU
+		return nil
+	})
+	return mtu, err
+}
+
+// AddNeighbor installs a permanent neighbor entry mapping ip to mac on an
+// interface inside a namespace, replacing any learned entry
+func AddNeighbor(ifname string, ip net.IP, mac net.HardwareAddr, namespace *Namespace) error {
+	return runInNamespace(namespace, func() error {
+		link, err := netlink.LinkByName(ifname)
+		if err != nil {
+			return fmt.Errorf("get link %s: %w", ifname, err)
+		}
+
+		family := netlink.FAMILY_V6
+		if ip.To4() != nil {
+			family = netlink.FAMILY_V4
+		}
+
+		neigh := &netlink.Neigh{
+			LinkIndex:    link.Attrs().Index,
+			Family:       family,
+			State:        netlink.NUD_PERMANENT,
+			IP:           ip,
+			HardwareAddr: mac,
+		}
+		if err := netlink.NeighSet(neigh); err != nil {
+			return fmt.Errorf("add neighbor %s on %s: %w", ip, ifname, err)
+		}
+		return nil
+	})
+}
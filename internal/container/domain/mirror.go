@@ -0,0 +1,313 @@
+package domain
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// Mirror directions
+const (
+	MirrorIngress = "ingress" // Frames the switch receives on the source port
+	MirrorEgress  = "egress"  // Frames the switch sends out of the source port
+	MirrorBoth    = "both"
+)
+
+// Mirror copies the traffic of bridge ports to a monitor port, like a SPAN
+// session on a hardware switch. Each source port gets a clsact qdisc with a
+// match-everything u32 filter whose mirred action copies frames out of the
+// monitor port; the filters of one mirror share its priority. The action
+// leaves the verdict unspecified so classification goes on to the filters
+// of other sessions mirroring the same port.
+type Mirror struct {
+	Name      string   `json:"name"`
+	Sources   []string `json:"sources"`
+	Monitor   string   `json:"monitor"`
+	Direction string   `json:"direction"`
+	Priority  uint16   `json:"priority"`
+}
+
+// parents returns the clsact hooks the mirror attaches to
+func (m *Mirror) parents() []uint32 {
+	switch m.Direction {
+	case MirrorIngress:
+		return []uint32{netlink.HANDLE_MIN_INGRESS}
+	case MirrorEgress:
+		return []uint32{netlink.HANDLE_MIN_EGRESS}
+	}
+	return []uint32{netlink.HANDLE_MIN_INGRESS, netlink.HANDLE_MIN_EGRESS}
+}
+
+// UsesPort reports whether the session mirrors or monitors a port
+func (m *Mirror) UsesPort(ifName string) bool {
+	return m.Monitor == ifName || slices.Contains(m.Sources, ifName)
+}
+
+// FindMirror returns the bridge's mirror with the given name
+func (b *Bridge) FindMirror(name string) *Mirror {
+	for i := range b.Mirrors {
+		if b.Mirrors[i].Name == name {
+			return &b.Mirrors[i]
+		}
+	}
+	return nil
+}
+
+// hasPort reports whether an interface is attached to the bridge
+func (b *Bridge) hasPort(ifName string) bool {
+	for _, p := range b.Ports {
+		if p.Interface == ifName {
+			return true
+		}
+	}
+	return false
+}
+
+// AddMirror installs a mirror session on the bridge and records it. An
+// empty direction mirrors both directions.
+func (b *Bridge) AddMirror(m Mirror) error {
+	if m.Direction == "" {
+		m.Direction = MirrorBoth
+	}
+	if err := b.validateMirror(m); err != nil {
+		return err
+	}
+
+	// Give the session a filter priority no other session uses
+	m.Priority = 1
+	for _, other := range b.Mirrors {
+		if other.Priority >= m.Priority {
+			m.Priority = other.Priority + 1
+		}
+	}
+
+	if err := b.installMirror(m); err != nil {
+		return err
+	}
+
+	b.Mirrors = append(b.Mirrors, m)
+	return nil
+}
+
+// installMirror adds the session's filters with its recorded priority
+func (b *Bridge) installMirror(m Mirror) error {
+	err := runInNamespace(b.Namespace, func() error {
+		monitor, err := netlink.LinkByName(m.Monitor)
+		if err != nil {
+			return fmt.Errorf("lookup monitor port %s: %w", m.Monitor, err)
+		}
+
+		for _, source := range m.Sources {
+			link, err := netlink.LinkByName(source)
+			if err != nil {
+				return fmt.Errorf("lookup source port %s: %w", source, err)
+			}
+			if err := ensureClsact(link); err != nil {
+				return fmt.Errorf("add clsact qdisc on %s: %w", source, err)
+			}
+
+			for _, parent := range m.parents() {
+				mirred := netlink.NewMirredAction(monitor.Attrs().Index)
+				mirred.MirredAction = netlink.TCA_EGRESS_MIRROR
+				mirred.Action = netlink.TC_ACT_UNSPEC
+
+				// u32 with an empty key is available on kernels without cls_matchall
+				filter := &netlink.U32{
+					FilterAttrs: netlink.FilterAttrs{
+						LinkIndex: link.Attrs().Index,
+						Parent:    parent,
+						Priority:  m.Priority,
+						Protocol:  unix.ETH_P_ALL,
+					},
+					Sel: &netlink.TcU32Sel{
+						Flags: nl.TC_U32_TERMINAL,
+						Nkeys: 1,
+						Keys:  []netlink.TcU32Key{{Mask: 0, Val: 0, Off: 0}},
+					},
+					Actions: []netlink.Action{mirred},
+				}
+				if err := netlink.FilterAdd(filter); err != nil {
+					return fmt.Errorf("add mirror filter on %s: %w", source, err)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// Do not leave half a session behind
+		removeMirrorFilters(b.Namespace, m)
+		return fmt.Errorf("add mirror %s: %w", m.Name, err)
+	}
+	return nil
+}
+
+// RestoreMirror installs a recorded session's filters again, for example
+// after one of its ports was re-created, keeping its priority
+func (b *Bridge) RestoreMirror(name string) error {
+	m := b.FindMirror(name)
+	if m == nil {
+		return fmt.Errorf("mirror %s not found on bridge %s", name, b.Name)
+	}
+
+	// Filters left on surviving ports would otherwise be doubled
+	if err := removeMirrorFilters(b.Namespace, *m); err != nil {
+		return fmt.Errorf("restore mirror %s: %w", name, err)
+	}
+	return b.installMirror(*m)
+}
+
+// validateMirror checks that a new session only references bridge ports
+func (b *Bridge) validateMirror(m Mirror) error {
+	if m.Name == "" {
+		return fmt.Errorf("mirror needs a name")
+	}
+	if b.FindMirror(m.Name) != nil {
+		return fmt.Errorf("mirror %s already exists on bridge %s", m.Name, b.Name)
+	}
+	if m.Direction != MirrorIngress && m.Direction != MirrorEgress && m.Direction != MirrorBoth {
+		return fmt.Errorf("invalid mirror direction %q (want ingress, egress or both)", m.Direction)
+	}
+	if len(m.Sources) == 0 {
+		return fmt.Errorf("mirror %s needs at least one source port", m.Name)
+	}
+	if !b.hasPort(m.Monitor) {
+		return fmt.Errorf("monitor port %s is not attached to bridge %s", m.Monitor, b.Name)
+	}
+	for _, source := range m.Sources {
+		if source == m.Monitor {
+			return fmt.Errorf("port %s cannot be both source and monitor", source)
+		}
+		if !b.hasPort(source) {
+			return fmt.Errorf("source port %s is not attached to bridge %s", source, b.Name)
+		}
+	}
+	return nil
+}
+
+// RemoveMirror removes a mirror session from the bridge
+func (b *Bridge) RemoveMirror(name string) error {
+	m := b.FindMirror(name)
+	if m == nil {
+		return fmt.Errorf("mirror %s not found on bridge %s", name, b.Name)
+	}
+
+	if err := removeMirrorFilters(b.Namespace, *m); err != nil {
+		return fmt.Errorf("remove mirror %s: %w", name, err)
+	}
+
+	b.Mirrors = slices.DeleteFunc(b.Mirrors, func(other Mirror) bool { return other.Name == name })
+	return nil
+}
+
+// removeMirrorFilters deletes a session's filters and drops clsact qdiscs
+// that no longer hold any filter. Ports that have disappeared are skipped.
+func removeMirrorFilters(namespace *Namespace, m Mirror) error {
+	return runInNamespace(namespace, func() error {
+		for _, source := range m.Sources {
+			link, err := netlink.LinkByName(source)
+			if err != nil {
+				continue
+			}
+
+			remaining := 0
+			for _, parent := range []uint32{netlink.HANDLE_MIN_INGRESS, netlink.HANDLE_MIN_EGRESS} {
+				filters, err := netlink.FilterList(link, parent)
+				if err != nil {
+					continue
+				}
+				for _, f := range filters {
+					if f.Attrs().Priority != m.Priority {
+						remaining++
+						continue
+					}
+					if err := netlink.FilterDel(f); err != nil {
+						return fmt.Errorf("delete mirror filter on %s: %w", source, err)
+					}
+				}
+			}
+
+			if remaining == 0 {
+				netlink.QdiscDel(clsact(link))
+			}
+		}
+		return nil
+	})
+}
+
+// MirrorActive reports whether every filter of the session is installed
+// and still copies to the monitor port. A re-created monitor port has a new
+// index, which leaves the old filters copying nowhere. Filters that end
+// classification, as installed by earlier releases, hide the sessions after
+// them and do not count.
+func (b *Bridge) MirrorActive(m Mirror) bool {
+	active := true
+	runInNamespace(b.Namespace, func() error {
+		monitor, err := netlink.LinkByName(m.Monitor)
+		if err != nil {
+			active = false
+			return nil
+		}
+
+		for _, source := range m.Sources {
+			link, err := netlink.LinkByName(source)
+			if err != nil {
+				active = false
+				return nil
+			}
+			for _, parent := range m.parents() {
+				filters, err := netlink.FilterList(link, parent)
+				if err != nil || !slices.ContainsFunc(filters, func(f netlink.Filter) bool {
+					return f.Attrs().Priority == m.Priority && mirrorsTo(f, monitor.Attrs().Index)
+				}) {
+					active = false
+					return nil
+				}
+			}
+		}
+		return nil
+	})
+	return active
+}
+
+// mirrorsTo reports whether a filter has a mirred action to the interface
+// that lets classification continue
+func mirrorsTo(f netlink.Filter, index int) bool {
+	u32, ok := f.(*netlink.U32)
+	if !ok {
+		return false
+	}
+	for _, action := range u32.Actions {
+		if mirred, ok := action.(*netlink.MirredAction); ok && mirred.Ifindex == index && mirred.Action == netlink.TC_ACT_UNSPEC {
+			return true
+		}
+	}
+	return false
+}
+
+func clsact(link netlink.Link) *netlink.Clsact {
+	return &netlink.Clsact{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: link.Attrs().Index,
+			Handle:    netlink.MakeHandle(0xffff, 0),
+			Parent:    netlink.HANDLE_CLSACT,
+		},
+	}
+}
+
+// ensureClsact adds a clsact qdisc to the link unless it already has one.
+// Must be called inside the link's namespace.
+func ensureClsact(link netlink.Link) error {
+	qdiscs, err := netlink.QdiscList(link)
+	if err != nil {
+		return err
+	}
+	for _, q := range qdiscs {
+		if q.Type() == "clsact" {
+			return nil
+		}
+	}
+	return netlink.QdiscAdd(clsact(link))
+}
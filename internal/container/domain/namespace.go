@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"time"
 
 	"github.com/vishvananda/netns"
@@ -29,13 +30,30 @@ func CreateNamespace(name string) *Namespace {
 
 	nsPath := filepath.Join(NETNS_BASE, name)
 
+	// NewNamed switches the calling thread into the new namespace, so pin
+	// the thread and switch it back afterwards
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origNS, err := netns.Get()
+	if err != nil {
+		return nil
+	}
+	defer origNS.Close()
+
 	// Create new named namespace
 	ns, err := netns.NewNamed(name)
 	if err != nil {
+		netns.Set(origNS)
 		return nil
 	}
 	ns.Close()
 
+	// Restore namespace immediately
+	if err := netns.Set(origNS); err != nil {
+		return nil
+	}
+
 	namespace := &Namespace{
 		ID:        "",
 		Name:      name,
@@ -54,5 +72,60 @@ func (ns *Namespace) Delete() error {
 		return fmt.Errorf("delete netns: %w", err)
 	}
 
+	if err := ns.RemoveEtc(); err != nil {
+		return err
+	}
+
 	return nil
 }
+
+// SameNamespace reports whether two namespace records refer to the same
+// namespace. A nil namespace stands for the root namespace.
+func SameNamespace(a, b *Namespace) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Name == b.Name
+}
+
+// Run runs fn with the calling OS thread inside the namespace. Sockets
+// opened by fn stay bound to the namespace after Run returns. A nil
+// namespace runs fn in the current namespace.
+func (ns *Namespace) Run(fn func() error) error {
+	return runInNamespace(ns, fn)
+}
+
+// runInNamespace runs fn with the calling OS thread switched into the
+// namespace, restoring the original namespace afterwards. A nil namespace
+// runs fn in the current namespace.
+func runInNamespace(namespace *Namespace, fn func() error) error {
+	if namespace == nil {
+		return fn()
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	// Save current namespace
+	origNS, err := netns.Get()
+	if err != nil {
+		return fmt.Errorf("get current ns: %w", err)
+	}
+	defer origNS.Close()
+
+	// Open target namespace
+	targetNS, err := netns.GetFromPath(namespace.Path)
+	if err != nil {
+		return fmt.Errorf("open namespace %s: %w", namespace.Name, err)
+	}
+	defer targetNS.Close()
+
+	if err := netns.Set(targetNS); err != nil {
+		return fmt.Errorf("set namespace: %w", err)
+	}
+
+	// Restore namespace before returning
+	defer netns.Set(origNS)
+
+	return fn()
+}
@@ -0,0 +1,121 @@
+package domain
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+)
+
+// ipForwardKey is the sysctl enabling IPv4 forwarding
+const ipForwardKey = "net.ipv4.ip_forward"
+
+// NAT records the root namespace configuration of a NAT node so it can be
+// removed again on teardown
+type NAT struct {
+	Interface   string    `json:"interface"`
+	Address     string    `json:"address"`
+	Subnet      string    `json:"subnet"`
+	PrevForward string    `json:"prev_forward"`
+	Rules       []NATRule `json:"rules"`
+}
+
+// NATRule is an iptables rule installed for a NAT node
+type NATRule struct {
+	Table string   `json:"table"`
+	Chain string   `json:"chain"`
+	Spec  []string `json:"spec"`
+}
+
+func (r NATRule) args(action string) []string {
+	return append([]string{"-w", "-t", r.Table, action, r.Chain}, r.Spec...)
+}
+
+// SetupNAT enables forwarding in the current (root) namespace and
+// masquerades traffic from the subnet of address leaving through any other
+// interface than ifname
+func SetupNAT(ifname, address string) (*NAT, error) {
+	_, subnet, err := net.ParseCIDR(address)
+	if err != nil {
+		return nil, fmt.Errorf("parse nat address %q: %w", address, err)
+	}
+
+	if _, err := exec.LookPath("iptables"); err != nil {
+		return nil, fmt.Errorf("nat requires iptables: %w", err)
+	}
+
+	prev, err := SetSysctl(nil, ipForwardKey, "1")
+	if err != nil {
+		return nil, fmt.Errorf("enable forwarding: %w", err)
+	}
+
+	nat := &NAT{
+		Interface:   ifname,
+		Address:     address,
+		Subnet:      subnet.String(),
+		PrevForward: prev,
+	}
+
+	rules := []NATRule{
+		{Table: "nat", Chain: "POSTROUTING", Spec: []string{"-s", subnet.String(), "!", "-d", subnet.String(), "-j", "MASQUERADE"}},
+		{Table: "filter", Chain: "FORWARD", Spec: []string{"-i", ifname, "-j", "ACCEPT"}},
+		{Table: "filter", Chain: "FORWARD", Spec: []string{"-o", ifname, "-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "ACCEPT"}},
+	}
+
+	for _, rule := range rules {
+		// Insert at the top so default DROP policies do not shadow the rule
+		if err := iptables(rule.args("-I")...); err != nil {
+			nat.Teardown(true)
+			return nil, fmt.Errorf("install nat rule: %w", err)
+		}
+		nat.Rules = append(nat.Rules, rule)
+	}
+
+	return nat, nil
+}
+
+// Teardown removes the iptables rules and deletes the NAT interface from
+// the root namespace. Forwarding is shared by every NAT node, so its setting
+// is only restored when restoreForward is set, for the last one.
+func (n *NAT) Teardown(restoreForward bool) error {
+	var errs []string
+
+	for _, rule := range n.Rules {
+		if err := iptables(rule.args("-D")...); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if restoreForward && n.PrevForward != "" && n.PrevForward != "1" {
+		if _, err := SetSysctl(nil, ipForwardKey, n.PrevForward); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if link, err := netlink.LinkByName(n.Interface); err == nil {
+		if err := netlink.LinkDel(link); err != nil {
+			errs = append(errs, fmt.Sprintf("delete %s: %v", n.Interface, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("nat teardown: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Gateway returns the NAT address without its prefix length
+func (n *NAT) Gateway() net.IP {
+	ip, _, _ := net.ParseCIDR(n.Address)
+	return ip
+}
+
+func iptables(args ...string) error {
+	out, err := exec.Command("iptables", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("iptables %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package domain
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+)
+
+// Route is a static route installed inside a container's namespace.
+// Destination "default" matches every address of the gateway's family.
+type Route struct {
+	Destination string `json:"destination"`
+	Gateway     string `json:"gateway,omitempty"`
+	Device      string `json:"device,omitempty"`
+}
+
+// String formats the route like "ip route" does
+func (r Route) String() string {
+	s := r.Destination
+	if r.Gateway != "" {
+		s += " via " + r.Gateway
+	}
+	if r.Device != "" {
+		s += " dev " + r.Device
+	}
+	return s
+}
+
+// AddRoute installs a route inside the namespace
+func AddRoute(namespace *Namespace, route Route) error {
+	var gw net.IP
+	if route.Gateway != "" {
+		gw = net.ParseIP(route.Gateway)
+		if gw == nil {
+			return fmt.Errorf("invalid gateway %q", route.Gateway)
+		}
+	}
+
+	var dst *net.IPNet
+	if route.Destination != "default" {
+		_, ipNet, err := net.ParseCIDR(route.Destination)
+		if err != nil {
+			return fmt.Errorf("invalid destination %q: %w", route.Destination, err)
+		}
+		dst = ipNet
+	} else if gw == nil {
+		return fmt.Errorf("default route requires a gateway")
+	} else if gw.To4() != nil {
+		dst = &net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}
+	} else {
+		dst = &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}
+	}
+
+	return runInNamespace(namespace, func() error {
+		r := &netlink.Route{Dst: dst, Gw: gw}
+
+		if route.Device != "" {
+			link, err := netlink.LinkByName(route.Device)
+			if err != nil {
+				return fmt.Errorf("lookup device %s: %w", route.Device, err)
+			}
+			r.LinkIndex = link.Attrs().Index
+		}
+
+		if err := netlink.RouteAdd(r); err != nil {
+			return fmt.Errorf("add route %s: %w", route, err)
+		}
+		return nil
+	})
+}
+
+// AddRoute installs a route in the container's namespace and records it
+func (c *Container) AddRoute(route Route) error {
+	if c.Namespace == nil {
+		return fmt.Errorf("container does not have a namespace")
+	}
+
+	if err := AddRoute(c.Namespace, route); err != nil {
+		return err
+	}
+
+	c.Routes = append(c.Routes, route)
+	return nil
+}
+
+// HasDefaultRoute reports whether the container has a recorded default
+// route for the address family of ip
+func (c *Container) HasDefaultRoute(ip net.IP) bool {
+	for _, r := range c.Routes {
+		if r.Destination != "default" {
+			continue
+		}
+		gw := net.ParseIP(r.Gateway)
+		if gw != nil && (gw.To4() != nil) == (ip.To4() != nil) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package domain
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ServiceCommand is the hidden command under which a gonett binary runs a
+// background service. Binaries starting services must dispatch it.
+const ServiceCommand = "__gonett_service__"
+
+// servicesDir holds the logs of background services
+const servicesDir = "/var/lib/gonett/services"
+
+// serviceStartGrace is how long a new service has to fail before it is
+// considered started
+const serviceStartGrace = 300 * time.Millisecond
+
+// Service is a background process serving a container, such as a DHCP server
+type Service struct {
+	Name      string `json:"name"`
+	PID       int    `json:"pid"`
+	Log       string `json:"log"`
+	StartedAt string `json:"started_at"`
+}
+
+// StartService re-executes the current binary as
+// "<exe> __gonett_service__ <name> <config>" inside the container's
+// namespace (the current one for containers without a namespace, such as
+// NAT nodes), detached in its own session, and records the service on the
+// container. Output goes to a log file under /var/lib/gonett/services.
+func (c *Container) StartService(name, config string) (*Service, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("find executable: %w", err)
+	}
+
+	if err := os.MkdirAll(servicesDir, 0755); err != nil {
+		return nil, fmt.Errorf("create services dir: %w", err)
+	}
+	logPath := filepath.Join(servicesDir, fmt.Sprintf("%s-%s.log", c.Name, name))
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open service log: %w", err)
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(exe, ServiceCommand, name, config)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	// The child inherits the namespace of the thread that forks it
+	if err := runInNamespace(c.Namespace, cmd.Start); err != nil {
+		return nil, fmt.Errorf("start service %s: %w", name, err)
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	select {
+	case err := <-exited:
+		return nil, fmt.Errorf("service %s exited (%v), see %s", name, err, logPath)
+	case <-time.After(serviceStartGrace):
+	}
+
+	service := Service{
+		Name:      name,
+		PID:       cmd.Process.Pid,
+		Log:       logPath,
+		StartedAt: time.Now().Format(time.RFC3339),
+	}
+	c.Services = append(c.Services, service)
+
+	return &service, nil
+}
+
+// Running reports whether the service process is still alive. The command
+// line is checked so a recycled PID is never mistaken for the service.
+func (s *Service) Running() bool {
+	cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", s.PID))
+	if err != nil {
+		return false
+	}
+	args := strings.Split(string(cmdline), "\x00")
+	return len(args) > 2 && args[1] == ServiceCommand && args[2] == s.Name
+}
+
+// Config returns the configuration the running service was started with,
+// read back from its command line
+func (s *Service) Config() (string, error) {
+	if !s.Running() {
+		return "", fmt.Errorf("service %s is not running", s.Name)
+	}
+	cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", s.PID))
+	if err != nil {
+		return "", fmt.Errorf("read service %s: %w", s.Name, err)
+	}
+	args := strings.Split(strings.TrimSuffix(string(cmdline), "\x00"), "\x00")
+	if len(args) < 4 {
+		return "", fmt.Errorf("service %s has no config", s.Name)
+	}
+	return args[3], nil
+}
+
+// Stop terminates the service, killing it if it ignores SIGTERM
+func (s *Service) Stop() error {
+	if !s.Running() {
+		return nil
+	}
+
+	if err := syscall.Kill(s.PID, syscall.SIGTERM); err != nil {
+		return fmt.Errorf("stop service %s: %w", s.Name, err)
+	}
+
+	for i := 0; i < 20; i++ {
+		if !s.Running() {
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if err := syscall.Kill(s.PID, syscall.SIGKILL); err != nil {
+		return fmt.Errorf("kill service %s: %w", s.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sysctlPath converts a sysctl key such as "net.ipv4.ip_forward" into its
+// /proc/sys path. Keys that already use "/" separators are taken as is, which
+// allows interface names containing dots (net/ipv6/conf/eth0.10/accept_dad).
+func sysctlPath(key string) string {
+	if !strings.Contains(key, "/") {
+		key = strings.ReplaceAll(key, ".", "/")
+	}
+	return filepath.Join("/proc/sys", key)
+}
+
+// GetSysctl reads a sysctl inside the namespace. Network sysctls are
+// resolved against the namespace of the calling thread, so a nil namespace
+// reads the current namespace.
+func GetSysctl(namespace *Namespace, key string) (string, error) {
+	var value string
+
+	err := runInNamespace(namespace, func() error {
+		data, err := os.ReadFile(sysctlPath(key))
+		if err != nil {
+			return fmt.Errorf("read sysctl %s: %w", key, err)
+		}
+		value = strings.TrimSpace(string(data))
+		return nil
+	})
+
+	return value, err
+}
+
+// SetSysctl writes a sysctl inside the namespace and returns its previous value
+func SetSysctl(namespace *Namespace, key, value string) (string, error) {
+	var prev string
+
+	err := runInNamespace(namespace, func() error {
+		path := sysctlPath(key)
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read sysctl %s: %w", key, err)
+		}
+		prev = strings.TrimSpace(string(data))
+
+		if err := os.WriteFile(path, []byte(value), 0644); err != nil {
+			return fmt.Errorf("write sysctl %s: %w", key, err)
+		}
+		return nil
+	})
+
+	return prev, err
+}
+
+// SetSysctl sets a sysctl inside the container's namespace and records it
+func (c *Container) SetSysctl(key, value string) error {
+	if c.Namespace == nil {
+		return fmt.Errorf("container %s has no namespace", c.Name)
+	}
+
+	if _, err := SetSysctl(c.Namespace, key, value); err != nil {
+		return err
+	}
+
+	if c.Sysctls == nil {
+		c.Sysctls = make(map[string]string)
+	}
+	c.Sysctls[key] = value
+	return nil
+}
@@ -0,0 +1,210 @@
+package domain
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/vishvananda/netlink"
+)
+
+// Tunnel kinds supported by CreateTunnel
+const (
+	TunnelVXLAN = "vxlan"
+	TunnelGRE   = "gre"
+	TunnelIPIP  = "ipip"
+)
+
+// DefaultVXLANPort is the IANA assigned VXLAN UDP port
+const DefaultVXLANPort = 4789
+
+// Tunnel represents a VXLAN, GRE or IP-in-IP device whose packets are
+// carried between Local and Remote over the underlay network
+type Tunnel struct {
+	Name      string     `json:"name"`
+	Kind      string     `json:"kind"`
+	Namespace *Namespace `json:"namespace,omitempty"`
+	Local     string     `json:"local"`
+	Remote    string     `json:"remote"`
+	VNI       int        `json:"vni,omitempty"`
+	Key       uint32     `json:"key,omitempty"`
+	UDPPort   int        `json:"udp_port,omitempty"`
+	MTU       int        `json:"mtu"`
+	Port      int        `json:"port,omitempty"`
+	Peer      string     `json:"peer,omitempty"` // "<node>:<tunnel>" on the other end
+	Addrs     []string   `json:"addrs,omitempty"`
+	CreatedAt string     `json:"created_at"`
+}
+
+// TunnelConfig describes a tunnel device to create. A zero MTU is derived
+// from the underlay interface MTU minus the encapsulation overhead.
+type TunnelConfig struct {
+	Name    string
+	Kind    string
+	Local   string
+	Remote  string
+	VNI     int
+	Key     uint32
+	UDPPort int
+	MTU     int
+}
+
+// TunnelOverhead returns the encapsulation overhead in bytes for a tunnel
+// kind over an IPv4 or IPv6 underlay
+func TunnelOverhead(kind string, key bool, ipv6 bool) (int, error) {
+	ipHeader := 20
+	if ipv6 {
+		ipHeader = 40
+	}
+
+	switch kind {
+	case TunnelVXLAN:
+		// outer IP + UDP (8) + VXLAN (8) + inner Ethernet (14)
+		return ipHeader + 30, nil
+	case TunnelGRE:
+		if key {
+			return ipHeader + 8, nil
+		}
+		return ipHeader + 4, nil
+	case TunnelIPIP:
+		return ipHeader, nil
+	default:
+		return 0, fmt.Errorf("unknown tunnel kind %q", kind)
+	}
+}
+
+// UnderlayMTU checks that address is configured inside the namespace and
+// returns the MTU of the interface carrying it
+func UnderlayMTU(address string, namespace *Namespace) (int, error) {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return 0, fmt.Errorf("invalid underlay address %q", address)
+	}
+
+	mtu := 0
+	err := runInNamespace(namespace, func() error {
+		addrs, err := netlink.AddrList(nil, netlink.FAMILY_ALL)
+		if err != nil {
+			return fmt.Errorf("list addresses: %w", err)
+		}
+
+		for _, addr := range addrs {
+			if !addr.IP.Equal(ip) {
+				continue
+			}
+			link, err := netlink.LinkByIndex(addr.LinkIndex)
+			if err != nil {
+				return fmt.Errorf("lookup underlay interface: %w", err)
+			}
+			mtu = link.Attrs().MTU
+			return nil
+		}
+
+		return fmt.Errorf("underlay address %s not found in %s", address, namespace.Name)
+	})
+
+	return mtu, err
+}
+
+// CreateTunnel creates a tunnel device inside the namespace after
+// validating that the local underlay address exists there
+func CreateTunnel(cfg TunnelConfig, namespace *Namespace) (*Tunnel, error) {
+	local := net.ParseIP(cfg.Local)
+	remote := net.ParseIP(cfg.Remote)
+	if local == nil || remote == nil {
+		return nil, fmt.Errorf("invalid tunnel endpoints %q -> %q", cfg.Local, cfg.Remote)
+	}
+	ipv6 := local.To4() == nil
+	if ipv6 != (remote.To4() == nil) {
+		return nil, fmt.Errorf("tunnel endpoints %s and %s use different address families", cfg.Local, cfg.Remote)
+	}
+	if ipv6 && cfg.Kind != TunnelVXLAN {
+		return nil, fmt.Errorf("%s tunnels require an IPv4 underlay", cfg.Kind)
+	}
+
+	underlayMTU, err := UnderlayMTU(cfg.Local, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	overhead, err := TunnelOverhead(cfg.Kind, cfg.Key != 0, ipv6)
+	if err != nil {
+		return nil, err
+	}
+
+	mtu := cfg.MTU
+	if mtu == 0 {
+		mtu = underlayMTU - overhead
+	}
+	if mtu+overhead > underlayMTU {
+		return nil, fmt.Errorf("tunnel mtu %d plus %d bytes of overhead exceeds underlay mtu %d", mtu, overhead, underlayMTU)
+	}
+
+	attrs := netlink.LinkAttrs{Name: cfg.Name, MTU: mtu}
+
+	var link netlink.Link
+	switch cfg.Kind {
+	case TunnelVXLAN:
+		if cfg.VNI < 1 || cfg.VNI > 1<<24-1 {
+			return nil, fmt.Errorf("invalid vxlan vni %d", cfg.VNI)
+		}
+		if cfg.UDPPort == 0 {
+			cfg.UDPPort = DefaultVXLANPort
+		}
+		link = &netlink.Vxlan{
+			LinkAttrs: attrs,
+			VxlanId:   cfg.VNI,
+			SrcAddr:   local,
+			Group:     remote,
+			Port:      cfg.UDPPort,
+			Learning:  true,
+		}
+	case TunnelGRE:
+		link = &netlink.Gretun{
+			LinkAttrs: attrs,
+			Local:     local,
+			Remote:    remote,
+			IKey:      cfg.Key,
+			OKey:      cfg.Key,
+		}
+	case TunnelIPIP:
+		link = &netlink.Iptun{
+			LinkAttrs: attrs,
+			Local:     local,
+			Remote:    remote,
+		}
+	}
+
+	err = runInNamespace(namespace, func() error {
+		if err := netlink.LinkAdd(link); err != nil {
+			return fmt.Errorf("add %s tunnel %s: %w", cfg.Kind, cfg.Name, err)
+		}
+		return netlink.LinkSetUp(link)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tunnel{
+		Name:      cfg.Name,
+		Kind:      cfg.Kind,
+		Namespace: namespace,
+		Local:     cfg.Local,
+		Remote:    cfg.Remote,
+		VNI:       cfg.VNI,
+		Key:       cfg.Key,
+		UDPPort:   cfg.UDPPort,
+		MTU:       mtu,
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}, nil
+}
+
+// AssignIP assigns an IP address to the tunnel device and records it
+func (t *Tunnel) AssignIP(ipCIDR string) error {
+	if err := assignIP(t.Name, ipCIDR, t.Namespace); err != nil {
+		return err
+	}
+
+	t.Addrs = append(t.Addrs, ipCIDR)
+	return nil
+}
@@ -2,6 +2,8 @@ package domain
 
 import (
 	"fmt"
+	"net"
+	"os"
 	"runtime"
 	"time"
 
@@ -16,9 +18,31 @@ type Veth struct {
 	PeerName   string     `json:"peer_name"`
 	NamespaceA *Namespace `json:"namespace_a,omitempty"`
 	NamespaceB *Namespace `json:"namespace_b,omitempty"`
+	PortA      int        `json:"port_a,omitempty"`
+	PortB      int        `json:"port_b,omitempty"`
+	AddrsA     []string   `json:"addrs_a,omitempty"`
+	AddrsB     []string   `json:"addrs_b,omitempty"`
+	MACA       string     `json:"mac_a,omitempty"`
+	MACB       string     `json:"mac_b,omitempty"`
+	MTUA       int        `json:"mtu_a,omitempty"`
+	MTUB       int        `json:"mtu_b,omitempty"`
+	NeighborsA []Neighbor `json:"neighbors_a,omitempty"`
+	NeighborsB []Neighbor `json:"neighbors_b,omitempty"`
+	Delay      string     `json:"delay,omitempty"` // One-way delay added on both ends, e.g. "2.5ms"
 	CreatedAt  string     `json:"created_at"`
 }
 
+// VethEnd describes one end of a veth pair created by CreateVethPair.
+// A nil MAC lets the kernel pick a random address and a zero MTU keeps the
+// kernel default.
+type VethEnd struct {
+	Name      string
+	Port      int
+	Namespace *Namespace
+	MAC       net.HardwareAddr
+	MTU       int
+}
+
 // CreateVeth creates a new virtual ethernet pair
 func CreateVeth(NamespaceA *Namespace, NamespaceB *Namespace, nameA string) (*Veth, error) {
 	runtime.LockOSThread()
@@ -78,6 +102,76 @@ func CreateVeth(NamespaceA *Namespace, NamespaceB *Namespace, nameA string) (*Ve
 	return veth, nil
 }
 
+// CreateVethPair creates a veth pair with each end placed directly in its
+// namespace, so end names only have to be unique inside their own namespace.
+// An end with a nil namespace stays in the current namespace.
+func CreateVethPair(a, b VethEnd) (*Veth, error) {
+	v := &netlink.Veth{
+		LinkAttrs: netlink.LinkAttrs{
+			Name:         a.Name,
+			HardwareAddr: a.MAC,
+			MTU:          a.MTU,
+		},
+		PeerName:         b.Name,
+		PeerHardwareAddr: b.MAC,
+		PeerMTU:          uint32(b.MTU),
+	}
+
+	if a.Namespace != nil {
+		nsA, err := netns.GetFromPath(a.Namespace.Path)
+		if err != nil {
+			return nil, fmt.Errorf("open namespace %s: %w", a.Namespace.Name, err)
+		}
+		defer nsA.Close()
+		v.LinkAttrs.Namespace = netlink.NsFd(nsA)
+	}
+
+	if b.Namespace != nil {
+		nsB, err := netns.GetFromPath(b.Namespace.Path)
+		if err != nil {
+			return nil, fmt.Errorf("open namespace %s: %w", b.Namespace.Name, err)
+		}
+		defer nsB.Close()
+		v.PeerNamespace = netlink.NsFd(nsB)
+	}
+
+	if err := netlink.LinkAdd(v); err != nil {
+		return nil, fmt.Errorf("create veth %s<->%s: %w", a.Name, b.Name, err)
+	}
+
+	veth := &Veth{
+		ID:         "",
+		Name:       a.Name,
+		PeerName:   b.Name,
+		NamespaceA: a.Namespace,
+		NamespaceB: b.Namespace,
+		PortA:      a.Port,
+		PortB:      b.Port,
+		MTUA:       a.MTU,
+		MTUB:       b.MTU,
+		CreatedAt:  time.Now().Format(time.RFC3339),
+	}
+	if a.MAC != nil {
+		veth.MACA = a.MAC.String()
+	}
+	if b.MAC != nil {
+		veth.MACB = b.MAC.String()
+	}
+
+	return veth, nil
+}
+
+// SameLink reports whether o records the same veth pair. Each container
+// keeps its own copy of a link, so copies are matched by their A end.
+func (v *Veth) SameLink(o Veth) bool {
+	return v.Name == o.Name && SameNamespace(v.NamespaceA, o.NamespaceA)
+}
+
+// IsEndA reports whether ifname in namespace is the veth's A end
+func (v *Veth) IsEndA(ifname string, namespace *Namespace) bool {
+	return ifname == v.Name && SameNamespace(namespace, v.NamespaceA)
+}
+
 // MoveEndToNamespace moves one end of the veth to a namespace
 func (v *Veth) MoveEndToNamespace(ifname string, namespace *Namespace) error {
 	runtime.LockOSThread()
@@ -128,66 +222,83 @@ func (v *Veth) MoveEndToNamespace(ifname string, namespace *Namespace) error {
 }
 
 // AssignIP assigns an IP address to a veth interface inside a namespace
+// and records it on the matching end
 func (v *Veth) AssignIP(ifname, ipCIDR string, namespace *Namespace) error {
-	runtime.LockOSThread()
-	defer runtime.UnlockOSThread()
-
-	// Save current namespace
-	origNS, err := netns.Get()
-	if err != nil {
-		return fmt.Errorf("get current ns: %w", err)
+	if err := assignIP(ifname, ipCIDR, namespace); err != nil {
+		return err
 	}
-	defer origNS.Close()
 
-	// Open target namespace
-	targetNS, err := netns.GetFromPath(namespace.Path)
-	if err != nil {
-		return fmt.Errorf("open namespace: %w", err)
-	}
-	defer targetNS.Close()
-
-	// Set to target namespace
-	if err := netns.Set(targetNS); err != nil {
-		netns.Set(origNS)
-		return fmt.Errorf("set namespace: %w", err)
+	if v.IsEndA(ifname, namespace) {
+		v.AddrsA = append(v.AddrsA, ipCIDR)
+	} else {
+		v.AddrsB = append(v.AddrsB, ipCIDR)
 	}
 
-	// Get link
-	link, err := netlink.LinkByName(ifname)
-	if err != nil {
-		netns.Set(origNS)
-		return fmt.Errorf("get link: %w", err)
-	}
-
-	// Parse IP address
-	addr, err := netlink.ParseAddr(ipCIDR)
-	if err != nil {
-		netns.Set(origNS)
-		return fmt.Errorf("parse addr: %w", err)
-	}
+	return nil
+}
 
-	// Add address to interface
-	if err := netlink.AddrAdd(link, addr); err != nil {
-		netns.Set(origNS)
-		return fmt.Errorf("add addr: %w", err)
+// AddNeighbor installs a permanent neighbor entry on a veth end and records
+// it on that end
+func (v *Veth) AddNeighbor(ifname string, namespace *Namespace, ip net.IP, mac net.HardwareAddr) error {
+	if err := AddNeighbor(ifname, ip, mac, namespace); err != nil {
+		return err
 	}
 
-	// Bring interface up
-	if err := netlink.LinkSetUp(link); err != nil {
-		netns.Set(origNS)
-		return fmt.Errorf("set up: %w", err)
+	neighbor := Neighbor{IP: ip.String(), MAC: mac.String()}
+	if v.IsEndA(ifname, namespace) {
+		v.NeighborsA = append(v.NeighborsA, neighbor)
+	} else {
+		v.NeighborsB = append(v.NeighborsB, neighbor)
 	}
 
-	// Restore namespace immediately
-	netns.Set(origNS)
 	return nil
 }
 
+// assignIP assigns an IP address to an interface inside a namespace.
+// A nil namespace configures the interface in the current namespace.
+func assignIP(ifname, ipCIDR string, namespace *Namespace) error {
+	return runInNamespace(namespace, func() error {
+		// Get link
+		link, err := netlink.LinkByName(ifname)
+		if err != nil {
+			return fmt.Errorf("get link: %w", err)
+		}
+
+		// Parse IP address
+		addr, err := netlink.ParseAddr(ipCIDR)
+		if err != nil {
+			return fmt.Errorf("parse addr: %w", err)
+		}
+
+		// Add address to interface
+		if err := netlink.AddrAdd(link, addr); err != nil {
+			return fmt.Errorf("add addr: %w", err)
+		}
+
+		// Bring interface up
+		if err := netlink.LinkSetUp(link); err != nil {
+			return fmt.Errorf("set up: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// Delete removes the veth pair through its A end. Ends living in a named
+// namespace are looked up there, so an interface in the current namespace
+// that happens to share the name is never touched.
 func (v *Veth) Delete() error {
-	link, err := netlink.LinkByName(v.Name)
-	if err == nil {
-		netlink.LinkDel(link)
+	if v.NamespaceA != nil {
+		if _, err := os.Stat(v.NamespaceA.Path); err != nil {
+			// Namespace already deleted, the veth went with it
+			return nil
+		}
 	}
 
-	return nil
+	return runInNamespace(v.NamespaceA, func() error {
+		if link, err := netlink.LinkByName(v.Name); err == nil {
+			netlink.LinkDel(link)
+		}
+		return nil
+	})
 }
@@ -0,0 +1,90 @@
+package domain
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/vishvananda/netlink"
+)
+
+// VLANInterface represents an 802.1Q sub-interface (e.g. eth0.10) on top of
+// a parent interface inside a namespace
+type VLANInterface struct {
+	Name      string     `json:"name"`
+	Parent    string     `json:"parent"`
+	VLANID    int        `json:"vlan_id"`
+	Namespace *Namespace `json:"namespace,omitempty"`
+	Addrs     []string   `json:"addrs,omitempty"`
+	Neighbors []Neighbor `json:"neighbors,omitempty"`
+	CreatedAt string     `json:"created_at"`
+}
+
+// CreateVLANInterface creates a "<parent>.<vid>" sub-interface inside the namespace
+func CreateVLANInterface(parent string, vid int, namespace *Namespace) (*VLANInterface, error) {
+	if vid < 1 || vid > 4094 {
+		return nil, fmt.Errorf("invalid vlan id %d", vid)
+	}
+
+	name := fmt.Sprintf("%s.%d", parent, vid)
+	if len(name) > 15 {
+		return nil, fmt.Errorf("sub-interface name %s is longer than 15 characters", name)
+	}
+
+	err := runInNamespace(namespace, func() error {
+		parentLink, err := netlink.LinkByName(parent)
+		if err != nil {
+			return fmt.Errorf("lookup parent %s: %w", parent, err)
+		}
+
+		vlan := &netlink.Vlan{
+			LinkAttrs: netlink.LinkAttrs{
+				Name:        name,
+				ParentIndex: parentLink.Attrs().Index,
+			},
+			VlanId: vid,
+		}
+		if err := netlink.LinkAdd(vlan); err != nil {
+			return fmt.Errorf("add vlan %s: %w", name, err)
+		}
+
+		// Tagged frames only flow while the parent is up
+		if err := netlink.LinkSetUp(parentLink); err != nil {
+			return fmt.Errorf("parent up: %w", err)
+		}
+
+		return netlink.LinkSetUp(vlan)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &VLANInterface{
+		Name:      name,
+		Parent:    parent,
+		VLANID:    vid,
+		Namespace: namespace,
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}, nil
+}
+
+// AssignIP assigns an IP address to the sub-interface and records it
+func (v *VLANInterface) AssignIP(ipCIDR string) error {
+	if err := assignIP(v.Name, ipCIDR, v.Namespace); err != nil {
+		return err
+	}
+
+	v.Addrs = append(v.Addrs, ipCIDR)
+	return nil
+}
+
+// AddNeighbor installs a permanent neighbor entry on the sub-interface and
+// records it
+func (v *VLANInterface) AddNeighbor(ip net.IP, mac net.HardwareAddr) error {
+	if err := AddNeighbor(v.Name, ip, mac, v.Namespace); err != nil {
+		return err
+	}
+
+	v.Neighbors = append(v.Neighbors, Neighbor{IP: ip.String(), MAC: mac.String()})
+	return nil
+}
@@ -1,7 +1,10 @@
 package manager
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
 	"strings"
 
 	"gonett/internal/container/domain"
@@ -78,7 +81,27 @@ func (cm *ContainerManager) ExecCommand(container *domain.Container, cmd []strin
 
 	fmt.Printf("Executing: %s\n", strings.Join(cmd, " "))
 
-	if err := container.Exec(cmd); err != nil {
+	return cm.ExecCommandIO(container, cmd, os.Stdin, os.Stdout, os.Stderr)
+}
+
+// ExecCommandIO executes a command in container with the given standard
+// streams
+func (cm *ContainerManager) ExecCommandIO(container *domain.Container, cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	return cm.ExecCommandContext(context.Background(), container, cmd, stdin, stdout, stderr)
+}
+
+// ExecCommandContext is ExecCommandIO with a command that is killed when
+// ctx is done
+func (cm *ContainerManager) ExecCommandContext(ctx context.Context, container *domain.Container, cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if container.Namespace == nil {
+		return fmt.Errorf("container has no namespace")
+	}
+
+	// Count the exec for the metrics endpoint. The counter is best effort:
+	// failing to update it must not fail the command.
+	cm.containerRepo.CountExec(container.ID)
+
+	if err := container.ExecContext(ctx, cmd, stdin, stdout, stderr); err != nil {
 		return fmt.Errorf("exec command: %w", err)
 	}
 
@@ -89,6 +112,31 @@ func (cm *ContainerManager) ExecCommand(container *domain.Container, cmd []strin
 func (cm *ContainerManager) DeleteContainer(container *domain.Container) error {
 	fmt.Printf("\nDeleting container '%s'...\n", container.Name)
 
+	// Stop background services before their namespace goes away
+	for _, service := range container.Services {
+		if err := service.Stop(); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+
+	// Remove root namespace NAT configuration
+	if container.NAT != nil {
+		restore, err := cm.handOverForward(container)
+		if err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+		if err := container.NAT.Teardown(restore); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+
+	// Hand external interfaces back before their namespace disappears
+	for _, ext := range container.Externals {
+		if err := ext.Restore(); err != nil {
+			fmt.Printf("Warning: failed to restore interface %s: %v\n", ext.Name, err)
+		}
+	}
+
 	// Delete namespace (which will cascade to cleanup)
 	if container.Namespace != nil {
 		if err := container.Namespace.Delete(); err != nil {
@@ -110,6 +158,10 @@ func (cm *ContainerManager) DeleteContainer(container *domain.Container) error {
 		}
 	}
 
+	if err := cm.dropPeerLinks(container); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
 	// Delete from repository
 	if err := cm.containerRepo.Delete(container.ID); err != nil {
 		return fmt.Errorf("delete container: %w", err)
@@ -118,13 +170,97 @@ func (cm *ContainerManager) DeleteContainer(container *domain.Container) error {
 	return nil
 }
 
+// handOverForward decides whether removing a NAT node restores IPv4
+// forwarding. Only the last NAT node left does: while another one, of any
+// lab, still forwards, the setting the first NAT node found is handed over
+// to its record instead, so it is restored once that one goes too.
+func (cm *ContainerManager) handOverForward(container *domain.Container) (bool, error) {
+	containers, err := cm.ListContainers()
+	if err != nil {
+		// Leaving forwarding on is safer than cutting off another lab
+		return false, fmt.Errorf("list containers: %w", err)
+	}
+
+	// The record may have been handed a setting since the caller loaded it
+	var others []*domain.Container
+	for _, c := range containers {
+		switch {
+		case c.ID == container.ID && c.NAT != nil:
+			container.NAT.PrevForward = c.NAT.PrevForward
+		case c.ID != container.ID && c.NAT != nil:
+			others = append(others, c)
+		}
+	}
+	if len(others) == 0 {
+		return true, nil
+	}
+
+	if heir := others[0]; heir.NAT.PrevForward == "1" && container.NAT.PrevForward != "1" {
+		heir.NAT.PrevForward = container.NAT.PrevForward
+		if err := cm.containerRepo.Save(heir); err != nil {
+			return false, fmt.Errorf("save container %s: %w", heir.Name, err)
+		}
+	}
+	return false, nil
+}
+
+// dropPeerLinks removes the copies other containers keep of a deleted
+// container's links, as RemoveLink does, so they are not reported missing.
+// Mirrors using one of the vanished ports are removed with them.
+func (cm *ContainerManager) dropPeerLinks(container *domain.Container) error {
+	if len(container.Veths) == 0 {
+		return nil
+	}
+
+	containers, err := cm.ListContainers()
+	if err != nil {
+		return fmt.Errorf("list containers: %w", err)
+	}
+
+	for _, c := range containers {
+		if c.ID == container.ID {
+			continue
+		}
+
+		changed := false
+		for _, veth := range container.Veths {
+			if !c.HasLink(veth) {
+				continue
+			}
+			for i := range c.Bridges {
+				bridge := &c.Bridges[i]
+				for _, m := range append([]domain.Mirror(nil), bridge.Mirrors...) {
+					if !m.UsesPort(veth.Name) && !m.UsesPort(veth.PeerName) {
+						continue
+					}
+					if err := bridge.RemoveMirror(m.Name); err != nil {
+						fmt.Printf("Warning: %v\n", err)
+						continue
+					}
+					fmt.Printf("  Removed mirror '%s' on %s: its port went away with %s\n", m.Name, c.Name, container.Name)
+				}
+			}
+			c.RemoveVeth(veth)
+			changed = true
+		}
+
+		if changed {
+			if err := cm.containerRepo.Save(c); err != nil {
+				return fmt.Errorf("save container %s: %w", c.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
 // CreateBridgeToContainer adds a bridge to an existing container
-func (cm *ContainerManager) CreateBridgeToContainer(container *domain.Container, name string) (*domain.Bridge, error) {
+func (cm *ContainerManager) CreateBridgeToContainer(container *domain.Container, name string, opts domain.BridgeOptions) (*domain.Bridge, error) {
 	if container.Namespace == nil {
 		return nil, fmt.Errorf("container has no namespace")
 	}
 
-	bridge, err := container.AddBridge(name)
+	bridge, err := container.AddBridgeWithOptions(name, opts)
 	if err != nil {
 		return nil, fmt.Errorf("add bridge: %w", err)
 	}
@@ -173,3 +309,100 @@ func (cm *ContainerManager) AddInterfaceToBridge(container *domain.Container, ve
 
 	return nil
 }
+
+// AddMirror installs a port mirror on the bridge the monitor port belongs to
+func (cm *ContainerManager) AddMirror(container *domain.Container, mirror domain.Mirror) error {
+	bridge := container.BridgeWithPort(mirror.Monitor)
+	if bridge == nil {
+		return fmt.Errorf("monitor port %s is not attached to a bridge in %s", mirror.Monitor, container.Name)
+	}
+
+	if err := bridge.AddMirror(mirror); err != nil {
+		return err
+	}
+
+	if err := cm.containerRepo.Save(container); err != nil {
+		return fmt.Errorf("save container: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveMirror removes a port mirror from whichever bridge holds it
+func (cm *ContainerManager) RemoveMirror(container *domain.Container, name string) error {
+	for i := range container.Bridges {
+		bridge := &container.Bridges[i]
+		if bridge.FindMirror(name) == nil {
+			continue
+		}
+
+		if err := bridge.RemoveMirror(name); err != nil {
+			return err
+		}
+
+		if err := cm.containerRepo.Save(container); err != nil {
+			return fmt.Errorf("save container: %w", err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("mirror %s not found on %s", name, container.Name)
+}
+
+// RemoveLink deletes the veth link an interface of the container belongs
+// to and drops it from every container recording it
+func (cm *ContainerManager) RemoveLink(container *domain.Container, ifName string) error {
+	veth := container.FindVeth(ifName)
+	if veth == nil {
+		return fmt.Errorf("no link %s on %s", ifName, container.Name)
+	}
+
+	containers, err := cm.ListContainers()
+	if err != nil {
+		return err
+	}
+
+	var holders []*domain.Container
+	for _, c := range containers {
+		for _, v := range c.Veths {
+			if v.SameLink(*veth) {
+				holders = append(holders, c)
+				break
+			}
+		}
+	}
+
+	// Mirrors would keep filters pointing at a vanished port
+	for _, c := range holders {
+		for _, bridge := range c.Bridges {
+			for _, m := range bridge.Mirrors {
+				for _, port := range []string{veth.Name, veth.PeerName} {
+					if m.UsesPort(port) {
+						return fmt.Errorf("port %s is used by mirror %s on %s, remove the mirror first", port, m.Name, c.Name)
+					}
+				}
+			}
+		}
+	}
+
+	if err := veth.Delete(); err != nil {
+		return fmt.Errorf("delete veth %s: %w", veth.Name, err)
+	}
+
+	for _, c := range holders {
+		c.RemoveVeth(*veth)
+		if err := cm.containerRepo.Save(c); err != nil {
+			return fmt.Errorf("save container %s: %w", c.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// SetLinkState brings an interface of the container up or down
+func (cm *ContainerManager) SetLinkState(container *domain.Container, ifName string, up bool) error {
+	if up {
+		return domain.SetLinkUp(ifName, container.Namespace)
+	}
+	return domain.SetLinkDown(ifName, container.Namespace)
+}
@@ -89,6 +89,7 @@ func (cr *ContainerRepository) FindByID(containerID string) (*domain.Container,
 	if err := json.Unmarshal(data, &container); err != nil {
 		return nil, err
 	}
+	container.Execs = execCount(container.ID)
 
 	return &container, nil
 }
@@ -115,6 +116,7 @@ func (cr *ContainerRepository) FindByName(name string) (*domain.Container, error
 		}
 
 		if container.Name == name {
+			container.Execs = execCount(container.ID)
 			return &container, nil
 		}
 	}
@@ -172,6 +174,8 @@ func (cr *ContainerRepository) Delete(containerID string) error {
 		}
 	}
 
+	os.Remove(filepath.Join(EXEC_COUNTER_DIR, containerID))
+
 	// Delete container metadata
 	path := filepath.Join(CONTAINER_METADATA_DIR, containerID+".json")
 	return os.Remove(path)
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// EXEC_COUNTER_DIR holds one exec counter file per container, kept apart
+// from the container records so counting an exec never rewrites them
+const EXEC_COUNTER_DIR = "/var/lib/gonett/execs"
+
+// CountExec adds one to the container's exec counter. The file is locked
+// while it is updated so concurrent execs are all counted.
+func (cr *ContainerRepository) CountExec(containerID string) error {
+	if err := os.MkdirAll(EXEC_COUNTER_DIR, 0755); err != nil {
+		return fmt.Errorf("create exec counter dir: %w", err)
+	}
+
+	f, err := os.OpenFile(filepath.Join(EXEC_COUNTER_DIR, containerID), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("open exec counter: %w", err)
+	}
+	defer f.Close()
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("lock exec counter: %w", err)
+	}
+
+	data := make([]byte, 32)
+	n, _ := f.ReadAt(data, 0)
+	count, _ := strconv.Atoi(strings.TrimSpace(string(data[:n])))
+
+	value := strconv.Itoa(count + 1)
+	if _, err := f.WriteAt([]byte(value), 0); err != nil {
+		return fmt.Errorf("write exec counter: %w", err)
+	}
+	return f.Truncate(int64(len(value)))
+}
+
+// execCount reads the container's exec counter, zero if it never ran one
+func execCount(containerID string) int {
+	data, err := os.ReadFile(filepath.Join(EXEC_COUNTER_DIR, containerID))
+	if err != nil {
+		return 0
+	}
+	count, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return count
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// STORE_LOCK_PATH is locked by every process changing the repositories
+const STORE_LOCK_PATH = "/var/lib/gonett/store.lock"
+
+// StoreLock serializes changes to the repositories: a mutex orders the
+// goroutines of one process and an flock on STORE_LOCK_PATH orders gonettd
+// against commands working on the repositories directly. The zero value is
+// unlocked; it implements sync.Locker.
+type StoreLock struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Lock waits for the store. When the lock file cannot be opened, only
+// goroutines of this process are serialized.
+func (l *StoreLock) Lock() {
+	l.mu.Lock()
+
+	if err := os.MkdirAll(filepath.Dir(STORE_LOCK_PATH), 0755); err != nil {
+		return
+	}
+	f, err := os.OpenFile(STORE_LOCK_PATH, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return
+	}
+	l.file = f
+}
+
+// Unlock releases the store
+func (l *StoreLock) Unlock() {
+	if l.file != nil {
+		// Closing the last descriptor drops the flock
+		l.file.Close()
+		l.file = nil
+	}
+	l.mu.Unlock()
+}
@@ -0,0 +1,98 @@
+package daemon
+
+import (
+	"os"
+
+	"gonett/internal/topology"
+)
+
+// DefaultSocket is the Unix socket gonettd listens on
+const DefaultSocket = "/run/gonett/gonettd.sock"
+
+// SocketPath returns the socket named by GONETT_SOCKET, or DefaultSocket
+func SocketPath() string {
+	if path := os.Getenv("GONETT_SOCKET"); path != "" {
+		return path
+	}
+	return DefaultSocket
+}
+
+// ErrorResponse is the body of every failed request
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// BuildResult describes a lab built by POST /v1/build
+type BuildResult struct {
+	Lab     string   `json:"lab"`
+	Nodes   []string `json:"nodes"`
+	Seconds float64  `json:"build_seconds"`
+}
+
+// CleanupResult lists the containers removed by POST /v1/cleanup and the
+// ones that could not be removed
+type CleanupResult struct {
+	Removed []string `json:"removed"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// ExecRequest is the body of POST /v1/containers/{name}/exec
+type ExecRequest struct {
+	Command []string `json:"command"`
+}
+
+// LinkRequest is the body of POST /v1/links. Ports left at zero continue
+// after the ones the nodes already use; the response carries the link with
+// its ports and interface names resolved.
+type LinkRequest struct {
+	NodeA   string `json:"node_a"`
+	NodeB   string `json:"node_b"`
+	IPA     string `json:"ip_a,omitempty"`
+	IPB     string `json:"ip_b,omitempty"`
+	IP6A    string `json:"ip6_a,omitempty"`
+	IP6B    string `json:"ip6_b,omitempty"`
+	PortA   int    `json:"port_a,omitempty"`
+	PortB   int    `json:"port_b,omitempty"`
+	IfNameA string `json:"ifname_a,omitempty"`
+	IfNameB string `json:"ifname_b,omitempty"`
+	MTU     int    `json:"mtu,omitempty"`
+}
+
+// toLink converts the request to a topology link
+func (r LinkRequest) toLink() topology.Link {
+	return topology.Link{
+		NodeA:   r.NodeA,
+		NodeB:   r.NodeB,
+		IPA:     r.IPA,
+		IPB:     r.IPB,
+		IP6A:    r.IP6A,
+		IP6B:    r.IP6B,
+		PortA:   r.PortA,
+		PortB:   r.PortB,
+		IfNameA: r.IfNameA,
+		IfNameB: r.IfNameB,
+		MTU:     r.MTU,
+	}
+}
+
+// linkRequest converts a resolved topology link back to its API form
+func linkRequest(l topology.Link) LinkRequest {
+	return LinkRequest{
+		NodeA:   l.NodeA,
+		NodeB:   l.NodeB,
+		IPA:     l.IPA,
+		IPB:     l.IPB,
+		IP6A:    l.IP6A,
+		IP6B:    l.IP6B,
+		PortA:   l.PortA,
+		PortB:   l.PortB,
+		IfNameA: l.IfNameA,
+		IfNameB: l.IfNameB,
+		MTU:     l.MTU,
+	}
+}
+
+// LinkState is the body of PUT /v1/containers/{name}/links/{iface}/state
+type LinkState struct {
+	Up bool `json:"up"`
+}
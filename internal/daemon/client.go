@@ -0,0 +1,241 @@
+package daemon
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gonett/internal/container/domain"
+)
+
+// dialTimeout bounds how long Dial waits for a daemon to answer
+const dialTimeout = time.Second
+
+// Client talks to gonettd over its Unix socket
+type Client struct {
+	socket string
+	http   *http.Client
+}
+
+// Dial connects to the daemon listening on socket and checks that it
+// answers
+func Dial(socket string) (*Client, error) {
+	c := &Client{
+		socket: socket,
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+	if err := c.do(ctx, http.MethodGet, "/v1/ping", nil, nil); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// do sends a request with an optional JSON (or raw []byte) body and decodes
+// a JSON response into out when it is not nil
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		reader = bytes.NewReader(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return fmt.Errorf("encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, "http://gonettd"+path, reader)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("gonettd: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return responseError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+// responseError turns an error response into an error carrying its message
+func responseError(resp *http.Response) error {
+	var body ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error == "" {
+		return fmt.Errorf("gonettd: %s", resp.Status)
+	}
+	return errors.New(body.Error)
+}
+
+// Containers lists every container the daemon knows
+func (c *Client) Containers() ([]*domain.Container, error) {
+	var containers []*domain.Container
+	err := c.do(context.Background(), http.MethodGet, "/v1/containers", nil, &containers)
+	return containers, err
+}
+
+// Container looks up a container by ID prefix or name
+func (c *Client) Container(target string) (*domain.Container, error) {
+	var container domain.Container
+	if err := c.do(context.Background(), http.MethodGet, "/v1/containers/"+url.PathEscape(target), nil, &container); err != nil {
+		return nil, err
+	}
+	return &container, nil
+}
+
+// Remove deletes a container and returns it
+func (c *Client) Remove(target string) (*domain.Container, error) {
+	var container domain.Container
+	if err := c.do(context.Background(), http.MethodDelete, "/v1/containers/"+url.PathEscape(target), nil, &container); err != nil {
+		return nil, err
+	}
+	return &container, nil
+}
+
+// Build builds a YAML topology
+func (c *Client) Build(topology []byte, autoMAC, staticARP bool) (*BuildResult, error) {
+	query := url.Values{}
+	if autoMAC {
+		query.Set("auto_mac", "true")
+	}
+	if staticARP {
+		query.Set("static_arp", "true")
+	}
+
+	var result BuildResult
+	if err := c.do(context.Background(), http.MethodPost, "/v1/build?"+query.Encode(), topology, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Cleanup removes every container
+func (c *Client) Cleanup() (*CleanupResult, error) {
+	var result CleanupResult
+	if err := c.do(context.Background(), http.MethodPost, "/v1/cleanup", nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// AddLink connects two nodes of a running lab and returns the link with
+// its ports and interface names resolved
+func (c *Client) AddLink(req LinkRequest) (*LinkRequest, error) {
+	var link LinkRequest
+	if err := c.do(context.Background(), http.MethodPost, "/v1/links", req, &link); err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// RemoveLink deletes the link an interface of a container belongs to
+func (c *Client) RemoveLink(target, ifName string) error {
+	path := "/v1/containers/" + url.PathEscape(target) + "/links/" + url.PathEscape(ifName)
+	return c.do(context.Background(), http.MethodDelete, path, nil, nil)
+}
+
+// SetLinkState brings an interface of a container up or down
+func (c *Client) SetLinkState(target, ifName string, up bool) error {
+	path := "/v1/containers/" + url.PathEscape(target) + "/links/" + url.PathEscape(ifName) + "/state"
+	return c.do(context.Background(), http.MethodPut, path, LinkState{Up: up}, nil)
+}
+
+// Exec runs a command in a container, streaming stdin to it and its output
+// to stdout and stderr. A non-zero exit status is returned as *ExitError.
+func (c *Client) Exec(target string, cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	conn, err := net.Dial("unix", c.socket)
+	if err != nil {
+		return fmt.Errorf("gonettd: %w", err)
+	}
+	defer conn.Close()
+
+	body, err := json.Marshal(ExecRequest{Command: cmd})
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, "http://gonettd/v1/containers/"+url.PathEscape(target)+"/exec", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", execProtocol)
+	if err := req.Write(conn); err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer resp.Body.Close()
+		return responseError(resp)
+	}
+
+	// Forward stdin, then half-close so the command sees EOF
+	go func() {
+		if stdin != nil {
+			io.Copy(conn, stdin)
+		}
+		if unixConn, ok := conn.(*net.UnixConn); ok {
+			unixConn.CloseWrite()
+		}
+	}()
+
+	for {
+		kind, payload, err := readFrame(reader)
+		if err != nil {
+			return fmt.Errorf("read output: %w", err)
+		}
+
+		switch kind {
+		case frameStdout:
+			stdout.Write(payload)
+		case frameStderr:
+			stderr.Write(payload)
+		case frameExit:
+			if len(payload) != 4 {
+				return fmt.Errorf("malformed exit frame")
+			}
+			if code := int(int32(binary.BigEndian.Uint32(payload))); code != 0 {
+				return &ExitError{Code: code}
+			}
+			return nil
+		case frameError:
+			return errors.New(string(payload))
+		default:
+			return fmt.Errorf("unknown frame type %d", kind)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package daemon
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"gonett/internal/container/domain"
+	"gonett/internal/metrics"
+	"gonett/internal/topology"
+)
+
+// openAPISpec describes the REST API, served at /api/v1/openapi.json
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// LabSummary is one entry of GET /api/v1/labs
+type LabSummary struct {
+	Name         string   `json:"name"`
+	Nodes        []string `json:"nodes"`
+	BuildSeconds float64  `json:"build_seconds"`
+}
+
+// Lab is the body of GET /api/v1/labs/{lab}
+type Lab struct {
+	Name  string              `json:"name"`
+	Nodes []*domain.Container `json:"nodes"`
+}
+
+// APIExecRequest is the body of POST /api/v1/nodes/{name}/exec
+type APIExecRequest struct {
+	Command []string `json:"command"`
+	Stdin   string   `json:"stdin,omitempty"`
+}
+
+// ExecEvent is one line of the newline-delimited JSON stream answering an
+// exec request: output of the command, then its exit code or an error.
+// Output that is not valid UTF-8 is sent base64-encoded.
+type ExecEvent struct {
+	Stream   string `json:"stream,omitempty"` // stdout or stderr
+	Data     string `json:"data,omitempty"`
+	Encoding string `json:"encoding,omitempty"` // base64, or empty for text
+	ExitCode *int   `json:"exit_code,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// outputEvent wraps a chunk of command output, base64-encoding it when it
+// would not survive as a JSON string
+func outputEvent(stream string, p []byte) ExecEvent {
+	if utf8.Valid(p) {
+		return ExecEvent{Stream: stream, Data: string(p)}
+	}
+	return ExecEvent{Stream: stream, Data: base64.StdEncoding.EncodeToString(p), Encoding: "base64"}
+}
+
+// NewToken returns a random API token
+func NewToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// APIHandler serves the REST API under /api/v1. Every request but the
+// OpenAPI description needs an "Authorization: Bearer <token>" header.
+func (s *Server) APIHandler(token string) http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("GET /api/v1/labs", s.apiListLabs)
+	api.HandleFunc("POST /api/v1/labs", s.apiCreateLab)
+	api.HandleFunc("GET /api/v1/labs/{lab}", s.apiGetLab)
+	api.HandleFunc("PUT /api/v1/labs/{lab}", s.apiReplaceLab)
+	api.HandleFunc("DELETE /api/v1/labs/{lab}", s.apiDeleteLab)
+	api.HandleFunc("GET /api/v1/nodes/{name}", s.handleGet)
+	api.HandleFunc("POST /api/v1/nodes/{name}/exec", s.apiExec)
+	api.HandleFunc("DELETE /api/v1/nodes/{name}/links/{iface}", s.handleRemoveLink)
+	api.HandleFunc("PUT /api/v1/nodes/{name}/links/{iface}/state", s.handleLinkState)
+	api.HandleFunc("POST /api/v1/links", s.handleAddLink)
+	api.Handle("GET /api/v1/metrics", metrics.Handler(s.cm.ListContainers))
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/", requireToken(token, api))
+	mux.HandleFunc("GET /api/v1/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPISpec)
+	})
+	return mux
+}
+
+// requireToken rejects requests without the bearer token
+func requireToken(token string, next http.Handler) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gonett"`)
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// labContainers returns the containers of a lab
+func (s *Server) labContainers(lab string) ([]*domain.Container, error) {
+	containers, err := s.cm.ListContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []*domain.Container
+	for _, c := range containers {
+		if c.Lab == lab {
+			nodes = append(nodes, c)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	return nodes, nil
+}
+
+func (s *Server) apiListLabs(w http.ResponseWriter, r *http.Request) {
+	containers, err := s.cm.ListContainers()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	byName := make(map[string]*LabSummary)
+	labs := []*LabSummary{}
+	for _, c := range containers {
+		lab := byName[c.Lab]
+		if lab == nil {
+			lab = &LabSummary{Name: c.Lab}
+			byName[c.Lab] = lab
+			labs = append(labs, lab)
+		}
+		lab.Nodes = append(lab.Nodes, c.Name)
+		lab.BuildSeconds = c.BuildTime
+	}
+	for _, lab := range labs {
+		sort.Strings(lab.Nodes)
+	}
+	sort.Slice(labs, func(i, j int) bool { return labs[i].Name < labs[j].Name })
+
+	writeJSON(w, http.StatusOK, labs)
+}
+
+func (s *Server) apiGetLab(w http.ResponseWriter, r *http.Request) {
+	lab := r.PathValue("lab")
+	nodes, err := s.labContainers(lab)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(nodes) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("lab '%s' not found", lab))
+		return
+	}
+	writeJSON(w, http.StatusOK, Lab{Name: lab, Nodes: nodes})
+}
+
+// apiCreateLab builds the YAML (or JSON) topology in the body as a new lab
+func (s *Server) apiCreateLab(w http.ResponseWriter, r *http.Request) {
+	topo, opts, err := readTopology(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if status, err := s.checkNewLab(topo); err != nil {
+		writeError(w, status, err)
+		return
+	}
+
+	result, err := s.build(topo, opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Location", "/api/v1/labs/"+result.Lab)
+	writeJSON(w, http.StatusCreated, result)
+}
+
+// apiReplaceLab tears a lab down and builds the topology in the body in
+// its place. The topology takes the lab's name when it has none. There is
+// no rollback once the old lab is gone, so the new topology is checked as
+// far as possible before anything is torn down.
+func (s *Server) apiReplaceLab(w http.ResponseWriter, r *http.Request) {
+	lab := r.PathValue("lab")
+	topo, opts, err := readTopology(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if topo.Name == "" {
+		topo.Name = lab
+	}
+	if topo.LabName() != lab {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("topology names lab '%s', not '%s'", topo.LabName(), lab))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.preflight(topo); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	existing, err := s.labContainers(lab)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if removed := s.remove(existing); len(removed.Errors) > 0 {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("tear down lab: %s", strings.Join(removed.Errors, "; ")))
+		return
+	}
+
+	result, err := s.build(topo, opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// checkNewLab refuses a topology whose lab already exists, with 409, or
+// that fails preflight, with 400. Nothing is built for either, so no half
+// lab is left behind; callers hold s.mu.
+func (s *Server) checkNewLab(topo *topology.Topology) (int, error) {
+	existing, err := s.labContainers(topo.LabName())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if len(existing) > 0 {
+		return http.StatusConflict, fmt.Errorf("lab '%s' already exists", topo.LabName())
+	}
+	if err := s.preflight(topo); err != nil {
+		return http.StatusBadRequest, err
+	}
+	return 0, nil
+}
+
+// preflight checks a topology against the recorded containers before
+// building it; callers hold s.mu
+func (s *Server) preflight(topo *topology.Topology) error {
+	containers, err := s.cm.ListContainers()
+	if err != nil {
+		return err
+	}
+	if err := topology.Preflight(topo, containers); err != nil {
+		return fmt.Errorf("check topology: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) apiDeleteLab(w http.ResponseWriter, r *http.Request) {
+	lab := r.PathValue("lab")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nodes, err := s.labContainers(lab)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(nodes) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("lab '%s' not found", lab))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.remove(nodes))
+}
+
+// execStream writes exec events as newline-delimited JSON, flushing each
+// one so the client sees output as it is produced
+type execStream struct {
+	mu      sync.Mutex
+	enc     *json.Encoder
+	flusher *http.ResponseController
+}
+
+func (e *execStream) send(event ExecEvent) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.enc.Encode(event); err != nil {
+		return err
+	}
+	return e.flusher.Flush()
+}
+
+// streamWriter feeds one output stream of a command into an execStream
+type streamWriter struct {
+	stream *execStream
+	name   string
+}
+
+func (s streamWriter) Write(p []byte) (int, error) {
+	if err := s.stream.send(outputEvent(s.name, p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// apiExec runs a command in a node and streams its output in a chunked
+// response of ExecEvent lines. The command is killed if the client goes away.
+func (s *Server) apiExec(w http.ResponseWriter, r *http.Request) {
+	var req APIExecRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(req.Command) == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("no command given"))
+		return
+	}
+
+	container, err := s.find(r.PathValue("name"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if container.Namespace == nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("container has no namespace"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	stream := &execStream{enc: json.NewEncoder(w), flusher: http.NewResponseController(w)}
+
+	var stdin io.Reader
+	if req.Stdin != "" {
+		stdin = strings.NewReader(req.Stdin)
+	}
+
+	runErr := s.cm.ExecCommandContext(r.Context(), container, req.Command, stdin, streamWriter{stream, "stdout"}, streamWriter{stream, "stderr"})
+
+	code := 0
+	var exitErr *exec.ExitError
+	switch {
+	case runErr == nil:
+	case errors.As(runErr, &exitErr):
+		code = exitErr.ExitCode()
+	default:
+		stream.send(ExecEvent{Error: runErr.Error()})
+		return
+	}
+	stream.send(ExecEvent{ExitCode: &code})
+}
@@ -0,0 +1,198 @@
+package daemon
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	testToken = "secret"
+	testAuth  = "Bearer " + testToken
+)
+
+// apiRequest sends a request with the given Authorization header, if any,
+// to the REST API of a server without repositories. Only routes answered
+// before a repository is read can be exercised this way.
+func apiRequest(t *testing.T, method, path, auth, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	rec := httptest.NewRecorder()
+	(&Server{}).APIHandler(testToken).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAPIAuth(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		auth   string // Authorization header
+		want   int
+	}{
+		{name: "no token", method: "GET", path: "/api/v1/labs", want: http.StatusUnauthorized},
+		{name: "wrong token", method: "GET", path: "/api/v1/labs", auth: "Bearer guess", want: http.StatusUnauthorized},
+		{name: "token without scheme", method: "GET", path: "/api/v1/labs", auth: testToken, want: http.StatusUnauthorized},
+		{name: "exec without token", method: "POST", path: "/api/v1/nodes/h1/exec", want: http.StatusUnauthorized},
+		{name: "delete without token", method: "DELETE", path: "/api/v1/labs/demo", want: http.StatusUnauthorized},
+		{name: "metrics without token", method: "GET", path: "/api/v1/metrics", want: http.StatusUnauthorized},
+		{name: "unknown route without token", method: "GET", path: "/api/v1/nope", want: http.StatusUnauthorized},
+		{name: "spec without token", method: "GET", path: "/api/v1/openapi.json", want: http.StatusOK},
+		{name: "valid token", method: "POST", path: "/api/v1/nodes/h1/exec", auth: testAuth, want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := apiRequest(t, tt.method, tt.path, tt.auth, "{}")
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d (body %q)", rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.want == http.StatusUnauthorized {
+				if got := rec.Header().Get("WWW-Authenticate"); !strings.HasPrefix(got, "Bearer") {
+					t.Errorf("WWW-Authenticate = %q, want a Bearer challenge", got)
+				}
+				assertError(t, rec, "missing or invalid token")
+			}
+		})
+	}
+}
+
+func TestAPIRouting(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+		errMsg string // Substring of the error message, for JSON errors
+	}{
+		{name: "unknown route", method: "GET", path: "/api/v1/nope", want: http.StatusNotFound},
+		{name: "route outside the api", method: "GET", path: "/v1/containers", want: http.StatusNotFound},
+		{name: "wrong method", method: "PATCH", path: "/api/v1/labs", want: http.StatusMethodNotAllowed},
+		{name: "exec is post only", method: "GET", path: "/api/v1/nodes/h1/exec", want: http.StatusMethodNotAllowed},
+		{name: "create with invalid yaml", method: "POST", path: "/api/v1/labs", body: "nodes: [", want: http.StatusBadRequest, errMsg: "parse topology"},
+		{name: "create with unknown key", method: "POST", path: "/api/v1/labs", body: "nodez: {}", want: http.StatusBadRequest, errMsg: "parse topology"},
+		{name: "create with unknown node", method: "POST", path: "/api/v1/labs", body: "links: [{node_a: h1, node_b: h2}]", want: http.StatusBadRequest, errMsg: "unknown node"},
+		{name: "replace under another name", method: "PUT", path: "/api/v1/labs/demo", body: "name: other\nnodes: {h1: {}}", want: http.StatusBadRequest, errMsg: "names lab 'other', not 'demo'"},
+		{name: "exec without command", method: "POST", path: "/api/v1/nodes/h1/exec", body: `{"command": []}`, want: http.StatusBadRequest, errMsg: "no command given"},
+		{name: "exec with unknown field", method: "POST", path: "/api/v1/nodes/h1/exec", body: `{"cmd": ["true"]}`, want: http.StatusBadRequest, errMsg: "decode request"},
+		{name: "exec with malformed json", method: "POST", path: "/api/v1/nodes/h1/exec", body: `{"command":`, want: http.StatusBadRequest, errMsg: "decode request"},
+		{name: "link without nodes", method: "POST", path: "/api/v1/links", body: `{"node_a": "h1"}`, want: http.StatusBadRequest, errMsg: "node_a and node_b are required"},
+		{name: "link state with wrong type", method: "PUT", path: "/api/v1/nodes/h1/links/h1-eth1/state", body: `{"up": "yes"}`, want: http.StatusBadRequest, errMsg: "decode request"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := apiRequest(t, tt.method, tt.path, testAuth, tt.body)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d (body %q)", rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.errMsg != "" {
+				assertError(t, rec, tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestAPIOpenAPISpec(t *testing.T) {
+	rec := apiRequest(t, "GET", "/api/v1/openapi.json", "", "")
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+
+	var spec struct {
+		Paths map[string]map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("decode spec: %v", err)
+	}
+	for path, method := range map[string]string{
+		"/api/v1/labs":              "post",
+		"/api/v1/labs/{lab}":        "put",
+		"/api/v1/nodes/{name}/exec": "post",
+	} {
+		if _, ok := spec.Paths[path][method]; !ok {
+			t.Errorf("spec has no %s %s", method, path)
+		}
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		want   int
+	}{
+		{name: "plain error keeps its status", status: http.StatusInternalServerError, err: fmt.Errorf("boom"), want: http.StatusInternalServerError},
+		{name: "bad request", status: http.StatusBadRequest, err: fmt.Errorf("bad"), want: http.StatusBadRequest},
+		{name: "not found", status: http.StatusInternalServerError, err: errNotFound{"container 'x' not found"}, want: http.StatusNotFound},
+		{name: "wrapped not found", status: http.StatusInternalServerError, err: fmt.Errorf("lookup: %w", errNotFound{"container 'x' not found"}), want: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeError(rec, tt.status, tt.err)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			assertError(t, rec, tt.err.Error())
+		})
+	}
+}
+
+func TestOutputEvent(t *testing.T) {
+	text := outputEvent("stdout", []byte("héllo\n"))
+	if text.Encoding != "" || text.Data != "héllo\n" || text.Stream != "stdout" {
+		t.Errorf("text output = %+v, want it unencoded", text)
+	}
+
+	binary := []byte{0x00, 0xff, 0xfe, 'a', 0xc3} // Invalid UTF-8, cut mid-rune
+	event := outputEvent("stderr", binary)
+	if event.Encoding != "base64" {
+		t.Fatalf("binary output encoding = %q, want base64", event.Encoding)
+	}
+
+	// The event must survive a JSON round trip byte for byte
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded ExecEvent
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	got, err := base64.StdEncoding.DecodeString(decoded.Data)
+	if err != nil {
+		t.Fatalf("decode data: %v", err)
+	}
+	if string(got) != string(binary) {
+		t.Errorf("round trip = %x, want %x", got, binary)
+	}
+}
+
+// assertError checks that the response is a JSON ErrorResponse whose
+// message contains want
+func assertError(t *testing.T, rec *httptest.ResponseRecorder, want string) {
+	t.Helper()
+
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	var resp ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode error response %q: %v", rec.Body.String(), err)
+	}
+	if !strings.Contains(resp.Error, want) {
+		t.Errorf("error = %q, want it to contain %q", resp.Error, want)
+	}
+}
@@ -0,0 +1,475 @@
+package daemon
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"gonett/internal/container/domain"
+	"gonett/internal/container/manager"
+	"gonett/internal/container/repository"
+	"gonett/internal/metrics"
+	"gonett/internal/topology"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxTopologySize bounds the topology file a build request may carry
+const maxTopologySize = 16 << 20
+
+// hangupInterval is how often a running exec checks whether its client hung up
+const hangupInterval = 250 * time.Millisecond
+
+// Server owns the repositories and serves the gonettd API. Requests that
+// change labs are serialized, with each other and with commands changing
+// the repositories directly; reads and execs run concurrently.
+type Server struct {
+	repos *repository.Repositories
+	cm    *manager.ContainerManager
+	mu    repository.StoreLock
+	mux   *http.ServeMux
+}
+
+// NewServer initializes the repositories and registers the API routes
+func NewServer() (*Server, error) {
+	repos, err := repository.InitializeRepositories()
+	if err != nil {
+		return nil, fmt.Errorf("initialize repositories: %w", err)
+	}
+
+	s := &Server{
+		repos: repos,
+		cm: manager.NewContainerManager(
+			repos.ContainerRepo,
+			repos.NamespaceRepo,
+			repos.BridgeRepo,
+			repos.VethRepo,
+		),
+		mux: http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("GET /v1/ping", s.handlePing)
+	s.mux.HandleFunc("GET /v1/containers", s.handleList)
+	s.mux.HandleFunc("GET /v1/containers/{name}", s.handleGet)
+	s.mux.HandleFunc("DELETE /v1/containers/{name}", s.handleRemove)
+	s.mux.HandleFunc("POST /v1/containers/{name}/exec", s.handleExec)
+	s.mux.HandleFunc("DELETE /v1/containers/{name}/links/{iface}", s.handleRemoveLink)
+	s.mux.HandleFunc("PUT /v1/containers/{name}/links/{iface}/state", s.handleLinkState)
+	s.mux.HandleFunc("POST /v1/links", s.handleAddLink)
+	s.mux.HandleFunc("POST /v1/build", s.handleBuild)
+	s.mux.HandleFunc("POST /v1/cleanup", s.handleCleanup)
+	s.mux.Handle("GET /v1/metrics", metrics.Handler(s.cm.ListContainers))
+
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Listen opens the daemon's Unix socket. A socket file left behind by a
+// daemon that is gone is replaced; one that still answers is an error.
+func Listen(socket string) (net.Listener, error) {
+	if _, err := Dial(socket); err == nil {
+		return nil, fmt.Errorf("gonettd is already running on %s", socket)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(socket), 0755); err != nil {
+		return nil, fmt.Errorf("create socket dir: %w", err)
+	}
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("remove stale socket: %w", err)
+	}
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", socket, err)
+	}
+
+	// Members of the socket's group may drive the daemon without root
+	if err := os.Chmod(socket, 0660); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("chmod socket: %w", err)
+	}
+
+	return l, nil
+}
+
+// find looks up a container by ID prefix or name
+func (s *Server) find(target string) (*domain.Container, error) {
+	containers, err := s.cm.ListContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range containers {
+		if strings.HasPrefix(c.ID, target) || c.Name == target {
+			return c, nil
+		}
+	}
+
+	return nil, errNotFound{fmt.Sprintf("container '%s' not found", target)}
+}
+
+// errNotFound is answered with 404 Not Found
+type errNotFound struct{ msg string }
+
+func (e errNotFound) Error() string { return e.msg }
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers with the error's message, using 404 for lookups that
+// found nothing
+func writeError(w http.ResponseWriter, status int, err error) {
+	var notFound errNotFound
+	if errors.As(err, &notFound) {
+		status = http.StatusNotFound
+	}
+	writeJSON(w, status, ErrorResponse{Error: err.Error()})
+}
+
+func decodeJSON(r *http.Request, v any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("decode request: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) handlePing(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]int{"pid": os.Getpid()})
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	containers, err := s.cm.ListContainers()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if containers == nil {
+		containers = []*domain.Container{}
+	}
+	writeJSON(w, http.StatusOK, containers)
+}
+
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
+	container, err := s.find(r.PathValue("name"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, container)
+}
+
+func (s *Server) handleRemove(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	container, err := s.find(r.PathValue("name"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := s.cm.DeleteContainer(container); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, container)
+}
+
+// handleBuild builds the YAML topology in the request body. The auto_mac
+// and static_arp query parameters mirror the build command's flags.
+func (s *Server) handleBuild(w http.ResponseWriter, r *http.Request) {
+	topo, opts, err := readTopology(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if status, err := s.checkNewLab(topo); err != nil {
+		writeError(w, status, err)
+		return
+	}
+
+	result, err := s.build(topo, opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, result)
+}
+
+// readTopology parses the YAML topology in a request body along with the
+// build options in its query
+func readTopology(r *http.Request) (*topology.Topology, topology.Options, error) {
+	opts := topology.Options{
+		AutoSetMACs: r.URL.Query().Get("auto_mac") == "true",
+		StaticARP:   r.URL.Query().Get("static_arp") == "true",
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxTopologySize))
+	if err != nil {
+		return nil, opts, fmt.Errorf("read topology: %w", err)
+	}
+
+	topo, err := topology.Parse(data)
+	if err != nil {
+		return nil, opts, fmt.Errorf("parse topology: %w", err)
+	}
+	return topo, opts, nil
+}
+
+// build builds a topology; callers hold s.mu
+func (s *Server) build(topo *topology.Topology, opts topology.Options) (*BuildResult, error) {
+	start := time.Now()
+	if err := topology.NewBuilderWithRepositories(s.repos, opts).Build(topo); err != nil {
+		return nil, fmt.Errorf("build topology: %w", err)
+	}
+
+	result := &BuildResult{Lab: topo.LabName(), Seconds: time.Since(start).Seconds()}
+	for name := range topo.Nodes {
+		result.Nodes = append(result.Nodes, name)
+	}
+	sort.Strings(result.Nodes)
+	return result, nil
+}
+
+func (s *Server) handleCleanup(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	containers, err := s.cm.ListContainers()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.remove(containers))
+}
+
+// remove deletes containers, carrying on past failures; callers hold s.mu
+func (s *Server) remove(containers []*domain.Container) *CleanupResult {
+	result := &CleanupResult{Removed: []string{}}
+	for _, container := range containers {
+		if err := s.cm.DeleteContainer(container); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", container.Name, err))
+			continue
+		}
+		result.Removed = append(result.Removed, container.Name)
+	}
+	return result
+}
+
+func (s *Server) handleAddLink(w http.ResponseWriter, r *http.Request) {
+	var req LinkRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.NodeA == "" || req.NodeB == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("node_a and node_b are required"))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, err := topology.NewBuilderWithRepositories(s.repos, topology.Options{}).AddLink(req.toLink())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, linkRequest(link))
+}
+
+func (s *Server) handleRemoveLink(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	container, err := s.find(r.PathValue("name"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := s.cm.RemoveLink(container, r.PathValue("iface")); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleLinkState(w http.ResponseWriter, r *http.Request) {
+	var state LinkState
+	if err := decodeJSON(r, &state); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	container, err := s.find(r.PathValue("name"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := s.cm.SetLinkState(container, r.PathValue("iface"), state.Up); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, state)
+}
+
+// handleExec runs a command in a container over an upgraded connection,
+// see execProtocol
+func (s *Server) handleExec(w http.ResponseWriter, r *http.Request) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), execProtocol) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("exec needs an Upgrade: %s request", execProtocol))
+		return
+	}
+
+	var req ExecRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(req.Command) == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("no command given"))
+		return
+	}
+
+	container, err := s.find(r.PathValue("name"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if container.Namespace == nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("container has no namespace"))
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("connection cannot be upgraded"))
+		return
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: %s\r\n\r\n", execProtocol)
+
+	// The command lives as long as the client: it is killed when the
+	// connection hangs up or its output can no longer be delivered
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watchHangup(ctx, conn, cancel)
+	out := &hangupWriter{w: conn, cancel: cancel}
+
+	// Hand the command a pipe rather than the connection, so it does not
+	// wait for the client to close its stdin after exiting
+	stdin, stdinWriter, err := os.Pipe()
+	if err != nil {
+		writeFrame(conn, frameError, []byte(err.Error()))
+		return
+	}
+	go func() {
+		io.Copy(stdinWriter, buf.Reader)
+		stdinWriter.Close()
+	}()
+
+	var mu sync.Mutex
+	err = s.cm.ExecCommandContext(ctx, container, req.Command, stdin,
+		&frameWriter{mu: &mu, w: out, kind: frameStdout},
+		&frameWriter{mu: &mu, w: out, kind: frameStderr},
+	)
+	stdin.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		writeFrame(conn, frameExit, binary.BigEndian.AppendUint32(nil, 0))
+	case errors.As(err, &exitErr):
+		writeFrame(conn, frameExit, binary.BigEndian.AppendUint32(nil, uint32(int32(exitErr.ExitCode()))))
+	default:
+		writeFrame(conn, frameError, []byte(err.Error()))
+	}
+}
+
+// hangupWriter cancels an exec once writing to its client fails
+type hangupWriter struct {
+	w      io.Writer
+	cancel context.CancelFunc
+}
+
+func (h *hangupWriter) Write(p []byte) (int, error) {
+	n, err := h.w.Write(p)
+	if err != nil {
+		h.cancel()
+	}
+	return n, err
+}
+
+// watchHangup cancels an exec when its client closes the connection. A
+// client half-closes once its stdin ends, so end of input alone is no
+// hangup; a full close shows up as POLLHUP on the Unix socket.
+func watchHangup(ctx context.Context, conn net.Conn, cancel context.CancelFunc) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(hangupInterval)
+	defer ticker.Stop()
+	for {
+		hungUp := false
+		raw.Control(func(fd uintptr) {
+			fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLHUP}}
+			if n, err := unix.Poll(fds, 0); err == nil && n > 0 {
+				hungUp = fds[0].Revents&(unix.POLLHUP|unix.POLLERR) != 0
+			}
+		})
+		if hungUp {
+			cancel()
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
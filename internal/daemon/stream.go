@@ -0,0 +1,82 @@
+package daemon
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// execProtocol is the Upgrade token of exec connections. After the 101
+// response the daemon sends frames of a type byte, a big-endian uint32
+// payload length and the payload; the client sends raw stdin bytes and
+// half-closes the connection when its stdin ends.
+const execProtocol = "gonett-exec"
+
+// Frame types of an exec connection
+const (
+	frameStdout byte = 1
+	frameStderr byte = 2
+	frameExit   byte = 3 // Payload: exit code as a big-endian int32
+	frameError  byte = 4 // Payload: why the command could not run
+)
+
+// maxFrame bounds the payload a client accepts in one frame
+const maxFrame = 1 << 20
+
+// ExitError reports a command that ran through the daemon and exited with
+// a non-zero status
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// frameWriter turns writes into frames of one type. Writers of the same
+// connection share a mutex so frames never interleave.
+type frameWriter struct {
+	mu   *sync.Mutex
+	w    io.Writer
+	kind byte
+}
+
+func (f *frameWriter) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := writeFrame(f.w, f.kind, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func writeFrame(w io.Writer, kind byte, payload []byte) error {
+	header := make([]byte, 5)
+	header[0] = kind
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	if _, err := w.Write(append(header, payload...)); err != nil {
+		return fmt.Errorf("write frame: %w", err)
+	}
+	return nil
+}
+
+func readFrame(r *bufio.Reader) (byte, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxFrame {
+		return 0, nil, fmt.Errorf("frame of %d bytes exceeds %d", size, maxFrame)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
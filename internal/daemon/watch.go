@@ -0,0 +1,19 @@
+package daemon
+
+import (
+	"os"
+
+	"gonett/internal/watch"
+)
+
+// Watch logs drift of every lab against the repositories until stop is
+// closed. Checks and repairs hold the server lock so they never race a
+// build or a link change made through the API.
+func (s *Server) Watch(heal bool, stop <-chan struct{}) error {
+	return watch.Watch(watch.Options{
+		Load: s.cm.ListContainers,
+		Heal: heal,
+		Lock: &s.mu,
+		Out:  os.Stdout,
+	}, stop)
+}
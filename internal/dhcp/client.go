@@ -0,0 +1,136 @@
+package dhcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// retransmit is how long the client waits for a reply before resending
+const retransmit = 2 * time.Second
+
+// Lease is the result of a successful DHCP exchange
+type Lease struct {
+	Address   string        // Leased address in CIDR form
+	Router    net.IP        // Default gateway, if offered
+	DNS       []net.IP      // Name servers, if offered
+	Server    net.IP        // Server identifier
+	LeaseTime time.Duration // Lease duration granted by the server
+}
+
+// Acquire runs a DISCOVER/OFFER/REQUEST/ACK exchange on ifname and returns
+// the lease. It only talks DHCP: configuring the address is up to the
+// caller. The lease is never renewed; gonett's server keeps it bound for
+// as long as it runs. It must be called from inside the interface's
+// namespace, with the interface up.
+func Acquire(ifname string, mac net.HardwareAddr, timeout time.Duration) (*Lease, error) {
+	conn, err := listen(ifname, ClientPort)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(timeout)
+	xid := rand.Uint32()
+
+	discover := &Message{
+		Op:     opRequest,
+		XID:    xid,
+		Flags:  flagBroadcast,
+		CHAddr: mac,
+		Options: map[byte][]byte{
+			optMessageType:   {Discover},
+			optParameterList: {optSubnetMask, optRouter, optDNS, optLeaseTime, optServerID},
+		},
+	}
+	offer, err := exchange(conn, discover, Offer, deadline)
+	if err != nil {
+		return nil, fmt.Errorf("discover on %s: %w", ifname, err)
+	}
+
+	serverID := offer.IPOption(optServerID)
+	request := &Message{
+		Op:     opRequest,
+		XID:    xid,
+		Flags:  flagBroadcast,
+		CHAddr: mac,
+		Options: map[byte][]byte{
+			optMessageType:   {Request},
+			optRequestedIP:   offer.YIAddr.To4(),
+			optParameterList: discover.Options[optParameterList],
+		},
+	}
+	if serverID != nil {
+		request.Options[optServerID] = serverID.To4()
+	}
+	ack, err := exchange(conn, request, Ack, deadline)
+	if err != nil {
+		return nil, fmt.Errorf("request %s on %s: %w", offer.YIAddr, ifname, err)
+	}
+
+	mask := net.IPMask(ack.Options[optSubnetMask])
+	if len(mask) != net.IPv4len {
+		mask = ack.YIAddr.DefaultMask()
+	}
+
+	lease := &Lease{
+		Address: (&net.IPNet{IP: ack.YIAddr, Mask: mask}).String(),
+		Router:  ack.IPOption(optRouter),
+		DNS:     parseIPList(ack.Options[optDNS]),
+		Server:  ack.IPOption(optServerID),
+	}
+	if v := ack.Options[optLeaseTime]; len(v) == 4 {
+		lease.LeaseTime = time.Duration(binary.BigEndian.Uint32(v)) * time.Second
+	}
+	// Routers can come as a list; only the first one is used
+	if r := ack.Options[optRouter]; len(r) > 4 {
+		lease.Router = parseIPList(r)[0]
+	}
+
+	return lease, nil
+}
+
+// exchange broadcasts msg until a reply of type want with the same
+// transaction ID arrives or the deadline passes. A NAK ends the exchange.
+func exchange(conn net.PacketConn, msg *Message, want byte, deadline time.Time) (*Message, error) {
+	buf := make([]byte, 1500)
+
+	for time.Now().Before(deadline) {
+		if _, err := conn.WriteTo(msg.Marshal(), broadcast(ServerPort)); err != nil {
+			return nil, fmt.Errorf("send: %w", err)
+		}
+
+		wait := time.Now().Add(retransmit)
+		if wait.After(deadline) {
+			wait = deadline
+		}
+		conn.SetReadDeadline(wait)
+
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if errors.Is(err, net.ErrClosed) {
+				return nil, err
+			}
+			if err != nil {
+				// Timed out: retransmit
+				break
+			}
+
+			reply, err := Unmarshal(buf[:n])
+			if err != nil || reply.Op != opReply || reply.XID != msg.XID {
+				continue
+			}
+			switch reply.Type() {
+			case want:
+				return reply, nil
+			case Nak:
+				return nil, errors.New("server refused the request")
+			}
+		}
+	}
+
+	return nil, errors.New("no reply from a dhcp server")
+}
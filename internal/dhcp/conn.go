@@ -0,0 +1,54 @@
+package dhcp
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// listen opens a UDP socket on port bound to ifname. Binding to the device
+// lets the client send and receive broadcasts before the interface has an
+// address, and keeps a server from answering on other interfaces. The
+// socket belongs to the network namespace of the calling thread.
+func listen(ifname string, port int) (net.PacketConn, error) {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.IPPROTO_UDP)
+	if err != nil {
+		return nil, fmt.Errorf("open udp socket: %w", err)
+	}
+
+	setup := func() error {
+		if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_REUSEADDR, 1); err != nil {
+			return fmt.Errorf("set SO_REUSEADDR: %w", err)
+		}
+		if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_BROADCAST, 1); err != nil {
+			return fmt.Errorf("set SO_BROADCAST: %w", err)
+		}
+		if err := unix.BindToDevice(fd, ifname); err != nil {
+			return fmt.Errorf("bind to %s: %w", ifname, err)
+		}
+		if err := unix.Bind(fd, &unix.SockaddrInet4{Port: port}); err != nil {
+			return fmt.Errorf("bind port %d: %w", port, err)
+		}
+		return nil
+	}
+	if err := setup(); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("dhcp-%s-%d", ifname, port))
+	defer f.Close()
+
+	conn, err := net.FilePacketConn(f)
+	if err != nil {
+		return nil, fmt.Errorf("wrap udp socket: %w", err)
+	}
+	return conn, nil
+}
+
+// broadcast is the limited broadcast destination of port
+func broadcast(port int) *net.UDPAddr {
+	return &net.UDPAddr{IP: net.IPv4bcast, Port: port}
+}
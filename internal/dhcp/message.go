@@ -0,0 +1,191 @@
+package dhcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Ports used by DHCPv4
+const (
+	ServerPort = 67
+	ClientPort = 68
+)
+
+// BOOTP operation codes
+const (
+	opRequest = 1
+	opReply   = 2
+)
+
+// Message types carried in option 53
+const (
+	Discover = 1
+	Offer    = 2
+	Request  = 3
+	Decline  = 4
+	Ack      = 5
+	Nak      = 6
+	Release  = 7
+	Inform   = 8
+)
+
+// Option codes used by the server and client
+const (
+	optPad           = 0
+	optSubnetMask    = 1
+	optRouter        = 3
+	optDNS           = 6
+	optRequestedIP   = 50
+	optLeaseTime     = 51
+	optMessageType   = 53
+	optServerID      = 54
+	optParameterList = 55
+	optEnd           = 255
+)
+
+// flagBroadcast asks the server to broadcast its replies, since the client
+// cannot receive unicast before it has an address
+const flagBroadcast = 0x8000
+
+// headerLen is the fixed BOOTP header length before the magic cookie
+const headerLen = 236
+
+// minMessageLen is the smallest BOOTP message relays are required to accept
+const minMessageLen = 300
+
+var magicCookie = []byte{99, 130, 83, 99}
+
+// Message is a DHCPv4 message
+type Message struct {
+	Op      byte
+	XID     uint32
+	Flags   uint16
+	CIAddr  net.IP // Client address (renewing clients only)
+	YIAddr  net.IP // Address offered to the client
+	SIAddr  net.IP
+	GIAddr  net.IP // Relay agent address
+	CHAddr  net.HardwareAddr
+	Options map[byte][]byte
+}
+
+// Type returns the message type from option 53, or 0 if it is missing
+func (m *Message) Type() byte {
+	if v := m.Options[optMessageType]; len(v) == 1 {
+		return v[0]
+	}
+	return 0
+}
+
+// IPOption returns an option holding a single IPv4 address, or nil
+func (m *Message) IPOption(code byte) net.IP {
+	if v := m.Options[code]; len(v) == 4 {
+		return net.IP(v)
+	}
+	return nil
+}
+
+// Marshal encodes the message in wire format
+func (m *Message) Marshal() []byte {
+	b := make([]byte, headerLen, minMessageLen)
+	b[0] = m.Op
+	b[1] = 1 // Ethernet
+	b[2] = 6 // Hardware address length
+	binary.BigEndian.PutUint32(b[4:], m.XID)
+	binary.BigEndian.PutUint16(b[10:], m.Flags)
+	copy(b[12:16], m.CIAddr.To4())
+	copy(b[16:20], m.YIAddr.To4())
+	copy(b[20:24], m.SIAddr.To4())
+	copy(b[24:28], m.GIAddr.To4())
+	copy(b[28:44], m.CHAddr)
+
+	b = append(b, magicCookie...)
+	// Message type goes first, as some clients expect
+	if t, ok := m.Options[optMessageType]; ok {
+		b = append(b, optMessageType, byte(len(t)))
+		b = append(b, t...)
+	}
+	for code := 1; code < optEnd; code++ {
+		value, ok := m.Options[byte(code)]
+		if !ok || code == optMessageType {
+			continue
+		}
+		b = append(b, byte(code), byte(len(value)))
+		b = append(b, value...)
+	}
+	b = append(b, optEnd)
+
+	for len(b) < minMessageLen {
+		b = append(b, optPad)
+	}
+	return b
+}
+
+// Unmarshal decodes a wire format message
+func Unmarshal(b []byte) (*Message, error) {
+	if len(b) < headerLen+len(magicCookie) {
+		return nil, fmt.Errorf("message too short (%d bytes)", len(b))
+	}
+	if string(b[headerLen:headerLen+4]) != string(magicCookie) {
+		return nil, errors.New("missing dhcp magic cookie")
+	}
+
+	hlen := int(b[2])
+	if hlen > 16 {
+		return nil, fmt.Errorf("invalid hardware address length %d", hlen)
+	}
+
+	m := &Message{
+		Op:      b[0],
+		XID:     binary.BigEndian.Uint32(b[4:]),
+		Flags:   binary.BigEndian.Uint16(b[10:]),
+		CIAddr:  net.IP(append([]byte(nil), b[12:16]...)),
+		YIAddr:  net.IP(append([]byte(nil), b[16:20]...)),
+		SIAddr:  net.IP(append([]byte(nil), b[20:24]...)),
+		GIAddr:  net.IP(append([]byte(nil), b[24:28]...)),
+		CHAddr:  net.HardwareAddr(append([]byte(nil), b[28:28+hlen]...)),
+		Options: make(map[byte][]byte),
+	}
+
+	opts := b[headerLen+4:]
+	for i := 0; i < len(opts); {
+		code := opts[i]
+		if code == optEnd {
+			break
+		}
+		if code == optPad {
+			i++
+			continue
+		}
+		if i+1 >= len(opts) || i+2+int(opts[i+1]) > len(opts) {
+			return nil, fmt.Errorf("truncated option %d", code)
+		}
+		length := int(opts[i+1])
+		m.Options[code] = append(m.Options[code], opts[i+2:i+2+length]...)
+		i += 2 + length
+	}
+
+	if m.Type() == 0 {
+		return nil, errors.New("missing dhcp message type")
+	}
+	return m, nil
+}
+
+// ipList encodes a list of IPv4 addresses as an option value
+func ipList(ips []net.IP) []byte {
+	var b []byte
+	for _, ip := range ips {
+		b = append(b, ip.To4()...)
+	}
+	return b
+}
+
+// parseIPList decodes an option value holding IPv4 addresses
+func parseIPList(b []byte) []net.IP {
+	var ips []net.IP
+	for i := 0; i+4 <= len(b); i += 4 {
+		ips = append(ips, net.IP(append([]byte(nil), b[i:i+4]...)))
+	}
+	return ips
+}
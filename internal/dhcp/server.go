@@ -0,0 +1,259 @@
+package dhcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultLeaseTime is used when a server configuration leaves it unset
+const DefaultLeaseTime = time.Hour
+
+// ServerConfig configures a DHCPv4 server on one interface
+type ServerConfig struct {
+	Interface string   `json:"interface"`
+	Address   string   `json:"address"`    // Server address in CIDR form; its prefix is handed to clients
+	PoolStart string   `json:"pool_start"` // First address of the pool
+	PoolEnd   string   `json:"pool_end"`   // Last address of the pool
+	Router    string   `json:"router,omitempty"`
+	DNS       []string `json:"dns,omitempty"`
+	LeaseTime int      `json:"lease_time,omitempty"` // Seconds told to clients (default one hour); bound leases never expire
+}
+
+// lease is an address handed to a client
+type lease struct {
+	ip      net.IP
+	expires time.Time // Zero for a bound lease, which never expires
+}
+
+// Server answers DHCPv4 requests from a fixed pool. Leases are kept in
+// memory; a client asking again gets its previous address back. Lab hosts
+// take their lease once at build time and never renew it, so an
+// acknowledged lease stays bound for as long as the server runs, until the
+// client releases or declines it; the configured lease time is only what
+// clients are told. Offers not yet requested are reclaimed after a minute.
+type Server struct {
+	cfg       ServerConfig
+	serverIP  net.IP
+	mask      net.IPMask
+	start     uint32
+	end       uint32
+	router    net.IP
+	dns       []net.IP
+	leaseTime time.Duration
+
+	mu     sync.Mutex
+	leases map[string]*lease // By client hardware address
+	conn   net.PacketConn
+}
+
+// NewServer validates cfg and returns a server ready to Serve
+func NewServer(cfg ServerConfig) (*Server, error) {
+	serverIP, subnet, err := net.ParseCIDR(cfg.Address)
+	if err != nil || serverIP.To4() == nil {
+		return nil, fmt.Errorf("server address %q must be an IPv4 CIDR", cfg.Address)
+	}
+
+	start, end := net.ParseIP(cfg.PoolStart).To4(), net.ParseIP(cfg.PoolEnd).To4()
+	if start == nil || end == nil {
+		return nil, fmt.Errorf("invalid pool %s-%s", cfg.PoolStart, cfg.PoolEnd)
+	}
+	if !subnet.Contains(start) || !subnet.Contains(end) {
+		return nil, fmt.Errorf("pool %s-%s is outside %s", cfg.PoolStart, cfg.PoolEnd, subnet)
+	}
+	if ipToUint(start) > ipToUint(end) {
+		return nil, fmt.Errorf("pool start %s is after pool end %s", cfg.PoolStart, cfg.PoolEnd)
+	}
+
+	s := &Server{
+		cfg:       cfg,
+		serverIP:  serverIP.To4(),
+		mask:      subnet.Mask,
+		start:     ipToUint(start),
+		end:       ipToUint(end),
+		leaseTime: time.Duration(cfg.LeaseTime) * time.Second,
+		leases:    make(map[string]*lease),
+	}
+	if s.leaseTime == 0 {
+		s.leaseTime = DefaultLeaseTime
+	}
+
+	if cfg.Router != "" {
+		if s.router = net.ParseIP(cfg.Router).To4(); s.router == nil {
+			return nil, fmt.Errorf("invalid router %q", cfg.Router)
+		}
+	}
+	for _, d := range cfg.DNS {
+		ip := net.ParseIP(d).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("invalid dns server %q", d)
+		}
+		s.dns = append(s.dns, ip)
+	}
+
+	return s, nil
+}
+
+// Serve listens on the configured interface and answers requests until
+// Close is called. It must be called from inside the server's namespace.
+func (s *Server) Serve() error {
+	conn, err := listen(s.cfg.Interface, ServerPort)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+	defer conn.Close()
+
+	log.Printf("dhcp: serving %s-%s on %s", s.cfg.PoolStart, s.cfg.PoolEnd, s.cfg.Interface)
+
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read request: %w", err)
+		}
+
+		req, err := Unmarshal(buf[:n])
+		if err != nil || req.Op != opRequest {
+			continue
+		}
+
+		reply := s.handle(req)
+		if reply == nil {
+			continue
+		}
+		if _, err := conn.WriteTo(reply.Marshal(), broadcast(ClientPort)); err != nil {
+			log.Printf("dhcp: send reply to %s: %v", req.CHAddr, err)
+		}
+	}
+}
+
+// Close stops Serve
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// handle builds the reply to a client message, or nil when none is due
+func (s *Server) handle(req *Message) *Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mac := req.CHAddr.String()
+
+	switch req.Type() {
+	case Discover:
+		ip := s.allocate(mac)
+		if ip == nil {
+			log.Printf("dhcp: pool exhausted, ignoring discover from %s", mac)
+			return nil
+		}
+		return s.reply(req, Offer, ip)
+
+	case Request:
+		// A request naming another server declines our offer
+		if id := req.IPOption(optServerID); id != nil && !id.Equal(s.serverIP) {
+			delete(s.leases, mac)
+			return nil
+		}
+
+		requested := req.IPOption(optRequestedIP)
+		if requested == nil {
+			requested = req.CIAddr
+		}
+		l := s.leases[mac]
+		if l == nil || !l.ip.Equal(requested) {
+			log.Printf("dhcp: nak %s for %s", requested, mac)
+			return s.reply(req, Nak, nil)
+		}
+
+		l.expires = time.Time{}
+		log.Printf("dhcp: ack %s for %s", l.ip, mac)
+		return s.reply(req, Ack, l.ip)
+
+	case Release, Decline:
+		delete(s.leases, mac)
+	}
+
+	return nil
+}
+
+// allocate returns the client's current address or reserves the first free
+// one in the pool, reclaiming stale offers
+func (s *Server) allocate(mac string) net.IP {
+	if l, ok := s.leases[mac]; ok {
+		return l.ip
+	}
+
+	now := time.Now()
+	used := make(map[uint32]bool)
+	for owner, l := range s.leases {
+		if !l.expires.IsZero() && now.After(l.expires) {
+			delete(s.leases, owner)
+			continue
+		}
+		used[ipToUint(l.ip)] = true
+	}
+
+	for n := s.start; n <= s.end; n++ {
+		if used[n] || n == ipToUint(s.serverIP) {
+			continue
+		}
+		// Offers are held briefly until the client requests them
+		ip := uintToIP(n)
+		s.leases[mac] = &lease{ip: ip, expires: now.Add(time.Minute)}
+		return ip
+	}
+	return nil
+}
+
+// reply builds a server reply of the given type
+func (s *Server) reply(req *Message, msgType byte, ip net.IP) *Message {
+	m := &Message{
+		Op:      opReply,
+		XID:     req.XID,
+		Flags:   req.Flags,
+		YIAddr:  ip,
+		GIAddr:  req.GIAddr,
+		CHAddr:  req.CHAddr,
+		Options: map[byte][]byte{optMessageType: {msgType}, optServerID: s.serverIP},
+	}
+	if msgType == Nak {
+		return m
+	}
+
+	leaseTime := make([]byte, 4)
+	binary.BigEndian.PutUint32(leaseTime, uint32(s.leaseTime/time.Second))
+	m.Options[optLeaseTime] = leaseTime
+	m.Options[optSubnetMask] = s.mask
+	if s.router != nil {
+		m.Options[optRouter] = s.router
+	}
+	if len(s.dns) > 0 {
+		m.Options[optDNS] = ipList(s.dns)
+	}
+	return m
+}
+
+func ipToUint(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+func uintToIP(n uint32) net.IP {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, n)
+	return ip
+}
@@ -0,0 +1,229 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Record types and classes answered by the server
+const (
+	TypeA    = 1
+	TypePTR  = 12
+	TypeAAAA = 28
+	ClassIN  = 1
+)
+
+// Response codes
+const (
+	RcodeSuccess  = 0
+	RcodeFormErr  = 1
+	RcodeServFail = 2
+	RcodeNXDomain = 3
+	RcodeRefused  = 5
+)
+
+const headerLen = 12
+
+// Header flag bits
+const (
+	flagQR = 1 << 15
+	flagAA = 1 << 10
+	flagTC = 1 << 9
+	flagRD = 1 << 8
+	flagRA = 1 << 7
+)
+
+// maxUDPLen is the classic DNS over UDP message limit
+const maxUDPLen = 512
+
+// maxNameLen is the longest domain name allowed on the wire, length bytes
+// and the root label included
+const maxNameLen = 255
+
+// Question is the single question of a query
+type Question struct {
+	Name  string // Lower case, without the trailing dot
+	Type  uint16
+	Class uint16
+}
+
+// Query is a parsed DNS query
+type Query struct {
+	ID       uint16
+	Flags    uint16
+	Question Question
+	raw      []byte // Header and question section, echoed in the response
+}
+
+// Answer is a resource record of the answer section
+type Answer struct {
+	Type uint16
+	TTL  uint32
+	IP   net.IP // A and AAAA
+	Name string // PTR target
+}
+
+// ParseQuery decodes a query carrying exactly one question
+func ParseQuery(b []byte) (*Query, error) {
+	if len(b) < headerLen {
+		return nil, errors.New("message too short")
+	}
+
+	q := &Query{
+		ID:    binary.BigEndian.Uint16(b[0:]),
+		Flags: binary.BigEndian.Uint16(b[2:]),
+	}
+	if q.Flags&flagQR != 0 {
+		return nil, errors.New("not a query")
+	}
+	if binary.BigEndian.Uint16(b[4:]) != 1 {
+		return nil, errors.New("expected exactly one question")
+	}
+
+	name, off, err := readName(b, headerLen)
+	if err != nil {
+		return nil, err
+	}
+	if off+4 > len(b) {
+		return nil, errors.New("truncated question")
+	}
+
+	q.Question = Question{
+		Name:  strings.ToLower(name),
+		Type:  binary.BigEndian.Uint16(b[off:]),
+		Class: binary.BigEndian.Uint16(b[off+2:]),
+	}
+	q.raw = b[:off+4]
+	return q, nil
+}
+
+// Response encodes the response to q with the given code and answers. The
+// answer section is truncated, setting TC, if it does not fit in a UDP
+// message.
+func (q *Query) Response(rcode int, answers []Answer, recursion bool) []byte {
+	b := make([]byte, len(q.raw), maxUDPLen)
+	copy(b, q.raw)
+
+	flags := uint16(flagQR|flagAA) | q.Flags&(0xf<<11|flagRD) | uint16(rcode&0xf)
+	if recursion {
+		flags |= flagRA
+	}
+	binary.BigEndian.PutUint16(b[2:], flags)
+	binary.BigEndian.PutUint16(b[4:], 1)
+	binary.BigEndian.PutUint16(b[8:], 0)
+	binary.BigEndian.PutUint16(b[10:], 0)
+
+	count := 0
+	for _, a := range answers {
+		rr := a.encode()
+		if len(b)+len(rr) > maxUDPLen {
+			binary.BigEndian.PutUint16(b[2:], flags|flagTC)
+			break
+		}
+		b = append(b, rr...)
+		count++
+	}
+	binary.BigEndian.PutUint16(b[6:], uint16(count))
+
+	return b
+}
+
+// encode encodes the record with its owner name pointing at the question
+func (a Answer) encode() []byte {
+	var rdata []byte
+	switch a.Type {
+	case TypeA:
+		rdata = a.IP.To4()
+	case TypeAAAA:
+		rdata = a.IP.To16()
+	case TypePTR:
+		rdata = encodeName(a.Name)
+	}
+
+	b := []byte{0xc0, headerLen} // Compression pointer to the question name
+	b = binary.BigEndian.AppendUint16(b, a.Type)
+	b = binary.BigEndian.AppendUint16(b, ClassIN)
+	b = binary.BigEndian.AppendUint32(b, a.TTL)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(rdata)))
+	return append(b, rdata...)
+}
+
+// readName decodes a possibly compressed domain name at off and returns it
+// with the offset following it. Names longer than maxNameLen, reserved label
+// types and pointers that do not point backwards are rejected.
+func readName(b []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1
+	size := 1 // The root label
+
+	for jumps := 0; ; {
+		if off >= len(b) {
+			return "", 0, errors.New("truncated name")
+		}
+		length := int(b[off])
+
+		switch {
+		case length == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return strings.Join(labels, "."), end, nil
+		case length&0xc0 == 0xc0:
+			if off+1 >= len(b) {
+				return "", 0, errors.New("truncated name pointer")
+			}
+			if jumps++; jumps > 10 {
+				return "", 0, errors.New("name compression loop")
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			target := int(binary.BigEndian.Uint16(b[off:]) & 0x3fff)
+			if target >= off {
+				return "", 0, errors.New("name pointer does not point backwards")
+			}
+			off = target
+		case length&0xc0 != 0:
+			return "", 0, fmt.Errorf("reserved label type 0x%02x", length&0xc0)
+		default:
+			if off+1+length > len(b) {
+				return "", 0, errors.New("truncated label")
+			}
+			if size += 1 + length; size > maxNameLen {
+				return "", 0, fmt.Errorf("name longer than %d bytes", maxNameLen)
+			}
+			labels = append(labels, string(b[off+1:off+1+length]))
+			off += 1 + length
+		}
+	}
+}
+
+// encodeName encodes a domain name without compression
+func encodeName(name string) []byte {
+	var b []byte
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" {
+			continue
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+// ReverseName returns the in-addr.arpa or ip6.arpa name of ip
+func ReverseName(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", ip4[3], ip4[2], ip4[1], ip4[0])
+	}
+
+	ip16 := ip.To16()
+	nibbles := make([]string, 0, 32)
+	for i := len(ip16) - 1; i >= 0; i-- {
+		nibbles = append(nibbles, fmt.Sprintf("%x", ip16[i]&0xf), fmt.Sprintf("%x", ip16[i]>>4))
+	}
+	return strings.Join(nibbles, ".") + ".ip6.arpa"
+}
@@ -0,0 +1,135 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+)
+
+// query builds a raw query for name, which is encoded label by label as is
+func query(name []byte, qtype uint16) []byte {
+	b := []byte{0x12, 0x34, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}
+	b = append(b, name...)
+	b = binary.BigEndian.AppendUint16(b, qtype)
+	return binary.BigEndian.AppendUint16(b, ClassIN)
+}
+
+// longName returns a name of n labels of 63 bytes
+func longName(n int) []byte {
+	var b []byte
+	for i := 0; i < n; i++ {
+		b = append(b, 63)
+		b = append(b, strings.Repeat("a", 63)...)
+	}
+	return append(b, 0)
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     []byte
+		want    string
+		wantErr string // Empty when the query must parse
+	}{
+		{name: "valid", raw: query(encodeName("H1.Lab"), TypeA), want: "h1.lab"},
+		{name: "root", raw: query([]byte{0}, TypeA), want: ""},
+		{name: "name of 255 bytes", raw: query(append(longName(3)[:192], append([]byte{61}, strings.Repeat("b", 61)+"\x00"...)...), TypeA), want: strings.Repeat(strings.Repeat("a", 63)+".", 3) + strings.Repeat("b", 61)},
+		{name: "name of 256 bytes", raw: query(append(longName(3)[:192], append([]byte{62}, strings.Repeat("b", 62)+"\x00"...)...), TypeA), wantErr: "longer than 255"},
+		{name: "name over 255 bytes", raw: query(longName(4), TypeA), wantErr: "longer than 255"},
+		{name: "name far over 512 bytes", raw: query(longName(12), TypeA), wantErr: "longer than 255"},
+		{name: "extended label type", raw: query([]byte{0x41, 'a', 0}, TypeA), wantErr: "reserved label type 0x40"},
+		{name: "reserved label type", raw: query([]byte{0x81, 'a', 0}, TypeA), wantErr: "reserved label type 0x80"},
+		{name: "forward pointer", raw: query([]byte{0xc0, 0x20}, TypeA), wantErr: "does not point backwards"},
+		{name: "self pointer", raw: query([]byte{0xc0, headerLen}, TypeA), wantErr: "does not point backwards"},
+		{name: "truncated label", raw: query([]byte{5, 'a'}, TypeA)[:headerLen+2], wantErr: "truncated label"},
+		{name: "truncated question", raw: query(encodeName("h1"), TypeA)[:headerLen+5], wantErr: "truncated question"},
+		{name: "short header", raw: []byte{0, 1, 2}, wantErr: "too short"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := ParseQuery(tt.raw)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("ParseQuery() = %v, want no error", err)
+			case tt.wantErr != "" && err == nil:
+				t.Fatalf("ParseQuery() = %q, want an error containing %q", q.Question.Name, tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Fatalf("ParseQuery() = %v, want an error containing %q", err, tt.wantErr)
+			case tt.wantErr == "" && q.Question.Name != tt.want:
+				t.Fatalf("name = %q, want %q", q.Question.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestResponse(t *testing.T) {
+	q, err := ParseQuery(query(encodeName("h1"), TypeA))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := q.Response(RcodeSuccess, []Answer{{Type: TypeA, TTL: recordTTL, IP: net.ParseIP("10.0.0.1")}}, false)
+	if !bytes.Equal(resp[headerLen:len(q.raw)], q.raw[headerLen:]) {
+		t.Errorf("question not echoed: %x", resp[:len(q.raw)])
+	}
+	if flags := binary.BigEndian.Uint16(resp[2:]); flags&flagQR == 0 || flags&0xf != RcodeSuccess {
+		t.Errorf("flags = %#x, want a successful response", flags)
+	}
+	if count := binary.BigEndian.Uint16(resp[6:]); count != 1 {
+		t.Errorf("answer count = %d, want 1", count)
+	}
+	if !bytes.HasSuffix(resp, []byte{10, 0, 0, 1}) {
+		t.Errorf("response %x does not end with the address", resp)
+	}
+
+	// Answers that do not fit in a UDP message set TC
+	many := make([]Answer, 100)
+	for i := range many {
+		many[i] = Answer{Type: TypeAAAA, TTL: recordTTL, IP: net.ParseIP("fd00::1")}
+	}
+	resp = q.Response(RcodeSuccess, many, false)
+	if len(resp) > maxUDPLen {
+		t.Errorf("response is %d bytes, over %d", len(resp), maxUDPLen)
+	}
+	if flags := binary.BigEndian.Uint16(resp[2:]); flags&flagTC == 0 {
+		t.Errorf("flags = %#x, want TC set", flags)
+	}
+}
+
+// TestHandleMalformed checks that queries whose question cannot be echoed in
+// a UDP response are dropped rather than answered
+func TestHandleMalformed(t *testing.T) {
+	s, err := NewServer(ServerConfig{Address: "127.0.0.1", Lab: "lab", Domain: "lab"}, func() (map[string][]net.IP, error) {
+		return map[string][]net.IP{"h1": {net.ParseIP("10.0.0.1")}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, raw := range [][]byte{
+		query(longName(12), TypeA),
+		query([]byte{0x41, 'a', 0}, TypeA),
+		query([]byte{0xc0, 0x20}, TypeA),
+	} {
+		if resp := s.handle(raw); resp != nil {
+			t.Errorf("handle(%x...) answered %x, want no answer", raw[:16], resp)
+		}
+	}
+
+	resp := s.handle(query(encodeName("h1.lab"), TypeA))
+	if resp == nil || !bytes.HasSuffix(resp, []byte{10, 0, 0, 1}) {
+		t.Errorf("handle(h1.lab) = %x, want the address of h1", resp)
+	}
+}
+
+func TestReverseName(t *testing.T) {
+	if got := ReverseName(net.ParseIP("10.0.1.2")); got != "2.1.0.10.in-addr.arpa" {
+		t.Errorf("ReverseName(10.0.1.2) = %q", got)
+	}
+	if got := ReverseName(net.ParseIP("fd00::1")); !strings.HasPrefix(got, "1.0.0.0.") || !strings.HasSuffix(got, ".0.0.d.f.ip6.arpa") {
+		t.Errorf("ReverseName(fd00::1) = %q", got)
+	}
+}
@@ -0,0 +1,243 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Port is the DNS port
+const Port = 53
+
+// recordTTL is kept short because lab addresses change between builds
+const recordTTL = 5
+
+// reloadInterval is how often the server refreshes its records
+const reloadInterval = 2 * time.Second
+
+// forwardTimeout bounds each upstream query
+const forwardTimeout = 2 * time.Second
+
+// ServerConfig configures a lab DNS server
+type ServerConfig struct {
+	Address string   `json:"address"`           // IP address to listen on
+	Lab     string   `json:"lab"`               // Lab whose nodes are served
+	Domain  string   `json:"domain"`            // Names are answered bare and under this domain
+	Forward []string `json:"forward,omitempty"` // Upstream resolvers for all other names
+}
+
+// Records returns the addresses of every node by node name
+type Records func() (map[string][]net.IP, error)
+
+// zone is a snapshot of the lab's names and addresses
+type zone struct {
+	hosts map[string][]net.IP // By lower case node name
+	ptr   map[string]string   // Reverse name to fully qualified node name
+}
+
+// Server answers A, AAAA and PTR queries for the nodes of a lab and
+// forwards everything else to the configured upstream resolvers
+type Server struct {
+	cfg     ServerConfig
+	records Records
+
+	mu       sync.Mutex
+	zone     *zone
+	loadedAt time.Time
+	conn     net.PacketConn
+}
+
+// NewServer returns a server answering from records
+func NewServer(cfg ServerConfig, records Records) (*Server, error) {
+	if net.ParseIP(cfg.Address) == nil {
+		return nil, fmt.Errorf("invalid listen address %q", cfg.Address)
+	}
+	cfg.Domain = strings.ToLower(strings.Trim(cfg.Domain, "."))
+	return &Server{cfg: cfg, records: records}, nil
+}
+
+// Serve answers queries on UDP port 53 of the configured address until
+// Close is called
+func (s *Server) Serve() error {
+	conn, err := net.ListenPacket("udp", net.JoinHostPort(s.cfg.Address, fmt.Sprint(Port)))
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+	defer conn.Close()
+
+	log.Printf("dns: serving lab %s as .%s on %s", s.cfg.Lab, s.cfg.Domain, s.cfg.Address)
+
+	buf := make([]byte, 4096)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read query: %w", err)
+		}
+
+		query := append([]byte(nil), buf[:n]...)
+		go func() {
+			if resp := s.handle(query); resp != nil {
+				conn.WriteTo(resp, addr)
+			}
+		}()
+	}
+}
+
+// Close stops Serve
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// handle returns the response to a raw query, or nil if it is not worth one.
+// Malformed queries are dropped: their question cannot be echoed safely.
+func (s *Server) handle(raw []byte) []byte {
+	q, err := ParseQuery(raw)
+	if err != nil {
+		return nil
+	}
+	recursion := len(s.cfg.Forward) > 0
+
+	z, err := s.currentZone()
+	if err != nil {
+		log.Printf("dns: load records: %v", err)
+		return q.Response(RcodeServFail, nil, recursion)
+	}
+
+	answers, rcode, local := z.lookup(q.Question, s.cfg.Domain)
+	if local {
+		return q.Response(rcode, answers, recursion)
+	}
+
+	if recursion {
+		resp, err := s.forward(raw)
+		if err == nil {
+			return resp
+		}
+		log.Printf("dns: forward %s: %v", q.Question.Name, err)
+		return q.Response(RcodeServFail, nil, recursion)
+	}
+	if rcode == RcodeNXDomain {
+		return q.Response(RcodeNXDomain, nil, false)
+	}
+	return q.Response(RcodeRefused, nil, false)
+}
+
+// currentZone returns the records, reloading them when they are stale
+func (s *Server) currentZone() (*zone, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.zone != nil && time.Since(s.loadedAt) < reloadInterval {
+		return s.zone, nil
+	}
+
+	hosts, err := s.records()
+	if err != nil {
+		return nil, err
+	}
+
+	z := &zone{hosts: make(map[string][]net.IP), ptr: make(map[string]string)}
+	for name, ips := range hosts {
+		name = strings.ToLower(name)
+		z.hosts[name] = ips
+		for _, ip := range ips {
+			z.ptr[ReverseName(ip)] = name + "." + s.cfg.Domain
+		}
+	}
+
+	s.zone, s.loadedAt = z, time.Now()
+	return z, nil
+}
+
+// lookup answers q from the zone. local is false when the name is not the
+// lab's to answer; rcode then tells whether it could be a lab name at all.
+func (z *zone) lookup(q Question, domain string) (answers []Answer, rcode int, local bool) {
+	name := q.Name
+
+	if strings.HasSuffix(name, ".in-addr.arpa") || strings.HasSuffix(name, ".ip6.arpa") {
+		target, ok := z.ptr[name]
+		if !ok {
+			return nil, RcodeNXDomain, false
+		}
+		if q.Type == TypePTR {
+			answers = append(answers, Answer{Type: TypePTR, TTL: recordTTL, Name: target})
+		}
+		return answers, RcodeSuccess, true
+	}
+
+	inDomain := name == domain || strings.HasSuffix(name, "."+domain)
+	host := strings.TrimSuffix(name, "."+domain)
+
+	ips, ok := z.hosts[host]
+	if !ok {
+		if inDomain {
+			return nil, RcodeNXDomain, true
+		}
+		// Bare names that are not nodes may still resolve upstream
+		return nil, RcodeNXDomain, false
+	}
+
+	for _, ip := range ips {
+		switch {
+		case q.Type == TypeA && ip.To4() != nil:
+			answers = append(answers, Answer{Type: TypeA, TTL: recordTTL, IP: ip})
+		case q.Type == TypeAAAA && ip.To4() == nil:
+			answers = append(answers, Answer{Type: TypeAAAA, TTL: recordTTL, IP: ip})
+		}
+	}
+	return answers, RcodeSuccess, true
+}
+
+// forward relays a raw query to the upstream resolvers in turn
+func (s *Server) forward(raw []byte) ([]byte, error) {
+	var lastErr error
+	for _, upstream := range s.cfg.Forward {
+		addr := upstream
+		if _, _, err := net.SplitHostPort(upstream); err != nil {
+			addr = net.JoinHostPort(upstream, fmt.Sprint(Port))
+		}
+
+		resp, err := exchange(addr, raw)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// exchange sends one query over UDP and returns the raw response
+func exchange(addr string, raw []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("udp", addr, forwardTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(forwardTimeout))
+	if _, err := conn.Write(raw); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
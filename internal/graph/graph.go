@@ -0,0 +1,299 @@
+package graph
+
+import (
+	"sort"
+	"strings"
+
+	"gonett/internal/container/domain"
+)
+
+// Link kinds
+const (
+	LinkVeth   = "veth"
+	LinkBond   = "bond"
+	LinkTunnel = "tunnel"
+)
+
+// Graph is the recorded topology of one or more labs
+type Graph struct {
+	Nodes []Node `json:"nodes"`
+	Links []Link `json:"links"`
+}
+
+// Node is a lab node with its interfaces
+type Node struct {
+	Name       string      `json:"name"`
+	Type       string      `json:"type"`
+	Lab        string      `json:"lab"`
+	Bridge     string      `json:"bridge,omitempty"`    // Bridge of a switch
+	Externals  []string    `json:"externals,omitempty"` // Outside interfaces attached to the bridge
+	Interfaces []Interface `json:"interfaces,omitempty"`
+}
+
+// Interface is a link end, bond, tunnel or VLAN sub-interface of a node
+type Interface struct {
+	Name  string   `json:"name"`
+	Addrs []string `json:"addrs,omitempty"`
+}
+
+// Link connects two nodes
+type Link struct {
+	Kind  string   `json:"kind"`
+	A     Endpoint `json:"a"`
+	B     Endpoint `json:"b"`
+	MTU   int      `json:"mtu,omitempty"`
+	Delay string   `json:"delay,omitempty"` // One-way delay on each end
+
+	BondMode    string `json:"bond_mode,omitempty"`
+	BondMembers int    `json:"bond_members,omitempty"`
+	TunnelKind  string `json:"tunnel_kind,omitempty"` // vxlan, gre or ipip
+	VNI         int    `json:"vni,omitempty"`
+	Key         uint32 `json:"key,omitempty"`
+}
+
+// Endpoint is one end of a link
+type Endpoint struct {
+	Node      string           `json:"node"`
+	Interface string           `json:"interface"`
+	Addrs     []string         `json:"addrs,omitempty"`
+	MAC       string           `json:"mac,omitempty"`
+	VLAN      *domain.PortVLAN `json:"vlan,omitempty"` // VLANs of a switch port
+}
+
+// Build walks the containers' veths, bonds and tunnels into a graph. Each
+// container holds a copy of the links it takes part in, so links are
+// deduplicated. Nodes are sorted by lab and name, links by their A end.
+func Build(containers []*domain.Container) *Graph {
+	sorted := append([]*domain.Container(nil), containers...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Lab != sorted[j].Lab {
+			return sorted[i].Lab < sorted[j].Lab
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	g := &Graph{Nodes: []Node{}, Links: []Link{}}
+	seen := make(map[string]bool)
+
+	for _, c := range sorted {
+		g.Nodes = append(g.Nodes, buildNode(c))
+
+		members := make(map[string]bool) // Bond members are drawn as their bond
+		for _, bond := range c.Bonds {
+			for _, m := range bond.Members {
+				members[m] = true
+			}
+		}
+
+		for _, v := range c.Veths {
+			if members[v.Name] || members[v.PeerName] {
+				continue
+			}
+			key := vethKey(v)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			link := Link{
+				Kind:  LinkVeth,
+				A:     Endpoint{Node: owner(sorted, v.NamespaceA, v, c), Interface: v.Name, Addrs: v.AddrsA, MAC: v.MACA},
+				B:     Endpoint{Node: owner(sorted, v.NamespaceB, v, c), Interface: v.PeerName, Addrs: v.AddrsB, MAC: v.MACB},
+				MTU:   max(v.MTUA, v.MTUB),
+				Delay: v.Delay,
+			}
+			link.A.VLAN = portVLAN(sorted, link.A)
+			link.B.VLAN = portVLAN(sorted, link.B)
+			g.Links = append(g.Links, link)
+		}
+
+		for _, bond := range c.Bonds {
+			peerNode, peerName, ok := strings.Cut(bond.Peer, ":")
+			if !ok {
+				continue
+			}
+			key := pairKey(c.Name+":"+bond.Name, bond.Peer)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			link := Link{
+				Kind:        LinkBond,
+				A:           Endpoint{Node: c.Name, Interface: bond.Name, Addrs: bond.Addrs, MAC: bond.MAC},
+				B:           Endpoint{Node: peerNode, Interface: peerName},
+				MTU:         bond.MTU,
+				BondMode:    bond.Mode,
+				BondMembers: len(bond.Members),
+			}
+			if peer := findBond(sorted, peerNode, peerName); peer != nil {
+				link.B.Addrs, link.B.MAC = peer.Addrs, peer.MAC
+			}
+			link.A.VLAN = portVLAN(sorted, link.A)
+			link.B.VLAN = portVLAN(sorted, link.B)
+			g.Links = append(g.Links, link)
+		}
+
+		for _, tunnel := range c.Tunnels {
+			peerNode, peerName, ok := strings.Cut(tunnel.Peer, ":")
+			if !ok {
+				continue
+			}
+			key := pairKey(c.Name+":"+tunnel.Name, tunnel.Peer)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			link := Link{
+				Kind:       LinkTunnel,
+				A:          Endpoint{Node: c.Name, Interface: tunnel.Name, Addrs: tunnel.Addrs},
+				B:          Endpoint{Node: peerNode, Interface: peerName},
+				MTU:        tunnel.MTU,
+				TunnelKind: tunnel.Kind,
+				VNI:        tunnel.VNI,
+				Key:        tunnel.Key,
+			}
+			if peer := findTunnel(sorted, peerNode, peerName); peer != nil {
+				link.B.Addrs = peer.Addrs
+			}
+			g.Links = append(g.Links, link)
+		}
+	}
+
+	sort.SliceStable(g.Links, func(i, j int) bool {
+		a, b := g.Links[i].A, g.Links[j].A
+		if a.Node != b.Node {
+			return a.Node < b.Node
+		}
+		return a.Interface < b.Interface
+	})
+	return g
+}
+
+func buildNode(c *domain.Container) Node {
+	node := Node{Name: c.Name, Type: c.Type, Lab: c.Lab}
+	if node.Type == "" {
+		node.Type = "host"
+	}
+	if len(c.Bridges) > 0 {
+		node.Bridge = c.Bridges[0].Name
+	}
+	for _, ext := range c.Externals {
+		node.Externals = append(node.Externals, ext.Name)
+	}
+
+	add := func(name string, addrs []string) {
+		node.Interfaces = append(node.Interfaces, Interface{Name: name, Addrs: addrs})
+	}
+	for _, v := range c.Veths {
+		switch {
+		case domain.SameNamespace(v.NamespaceA, c.Namespace):
+			add(v.Name, v.AddrsA)
+		case domain.SameNamespace(v.NamespaceB, c.Namespace):
+			add(v.PeerName, v.AddrsB)
+		}
+	}
+	for _, bond := range c.Bonds {
+		add(bond.Name, bond.Addrs)
+	}
+	for _, tunnel := range c.Tunnels {
+		add(tunnel.Name, tunnel.Addrs)
+	}
+	for _, vlan := range c.VLANs {
+		add(vlan.Name, vlan.Addrs)
+	}
+	sort.Slice(node.Interfaces, func(i, j int) bool { return node.Interfaces[i].Name < node.Interfaces[j].Name })
+
+	return node
+}
+
+// owner names the node a namespace belongs to, preferring nodes of the
+// lab of the container holding the link. NAT nodes live in the root
+// namespace, recorded as nil, so a root namespace end belongs to the NAT
+// node whose records hold the link.
+func owner(containers []*domain.Container, ns *domain.Namespace, v domain.Veth, holder *domain.Container) string {
+	var match string
+	for _, c := range containers {
+		if ns == nil {
+			if c.Namespace == nil && c.HasLink(v) {
+				return c.Name
+			}
+			continue
+		}
+		if !domain.SameNamespace(c.Namespace, ns) {
+			continue
+		}
+		if c.Lab == holder.Lab {
+			return c.Name
+		}
+		if match == "" {
+			match = c.Name
+		}
+	}
+	if match == "" && ns != nil {
+		return ns.Name
+	}
+	return match
+}
+
+// portVLAN returns the VLANs of an endpoint that is a switch port
+func portVLAN(containers []*domain.Container, e Endpoint) *domain.PortVLAN {
+	for _, c := range containers {
+		if c.Name != e.Node {
+			continue
+		}
+		for _, bridge := range c.Bridges {
+			for _, port := range bridge.Ports {
+				if port.Interface == e.Interface {
+					return port.VLAN
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func findBond(containers []*domain.Container, node, name string) *domain.Bond {
+	for _, c := range containers {
+		if c.Name != node {
+			continue
+		}
+		for i := range c.Bonds {
+			if c.Bonds[i].Name == name {
+				return &c.Bonds[i]
+			}
+		}
+	}
+	return nil
+}
+
+func findTunnel(containers []*domain.Container, node, name string) *domain.Tunnel {
+	for _, c := range containers {
+		if c.Name != node {
+			continue
+		}
+		for i := range c.Tunnels {
+			if c.Tunnels[i].Name == name {
+				return &c.Tunnels[i]
+			}
+		}
+	}
+	return nil
+}
+
+// vethKey identifies a veth pair across the copies its nodes hold
+func vethKey(v domain.Veth) string {
+	if v.NamespaceA == nil {
+		return v.Name
+	}
+	return v.NamespaceA.Name + "/" + v.Name
+}
+
+// pairKey identifies a bond or tunnel by both of its "<node>:<name>" ends
+func pairKey(a, b string) string {
+	if b < a {
+		a, b = b, a
+	}
+	return a + "|" + b
+}
@@ -0,0 +1,45 @@
+package graph
+
+import (
+	"testing"
+
+	"gonett/internal/container/domain"
+)
+
+// TestBuildNATOwners checks that root namespace ends are matched to the NAT
+// node recording them, not to whichever NAT node comes first: every NAT node
+// shares the root namespace.
+func TestBuildNATOwners(t *testing.T) {
+	h1 := &domain.Namespace{Name: "h1", Path: "/nonexistent/h1"}
+	h2 := &domain.Namespace{Name: "h2", Path: "/nonexistent/h2"}
+
+	links := []domain.Veth{
+		{Name: "nat1-eth1", PeerName: "h1-eth1", PortA: 1, PortB: 1, NamespaceB: h1},
+		{Name: "nat2-eth1", PeerName: "h2-eth1", PortA: 1, PortB: 1, NamespaceB: h2},
+		{Name: "h1-eth2", PeerName: "h2-eth2", PortA: 2, PortB: 2, NamespaceA: h1, NamespaceB: h2},
+	}
+	containers := []*domain.Container{
+		{Name: "h2", Type: "host", Lab: "lab", Namespace: h2, Veths: []domain.Veth{links[1], links[2]}},
+		{Name: "h1", Type: "host", Lab: "lab", Namespace: h1, Veths: []domain.Veth{links[0], links[2]}},
+		{Name: "nat1", Type: "nat", Lab: "lab", Veths: []domain.Veth{links[0]}},
+		{Name: "nat2", Type: "nat", Lab: "lab", Veths: []domain.Veth{links[1]}},
+		{Name: "other", Type: "nat", Lab: "elsewhere"},
+	}
+
+	g := Build(containers)
+
+	want := map[string]string{
+		"nat1-eth1": "nat1:nat1-eth1 -- h1:h1-eth1",
+		"nat2-eth1": "nat2:nat2-eth1 -- h2:h2-eth1",
+		"h1-eth2":   "h1:h1-eth2 -- h2:h2-eth2",
+	}
+	if len(g.Links) != len(want) {
+		t.Fatalf("built %d links, want %d: %+v", len(g.Links), len(want), g.Links)
+	}
+	for _, link := range g.Links {
+		got := link.A.Node + ":" + link.A.Interface + " -- " + link.B.Node + ":" + link.B.Interface
+		if got != want[link.A.Interface] {
+			t.Errorf("link %s = %s, want %s", link.A.Interface, got, want[link.A.Interface])
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gonett/internal/container/domain"
+)
+
+// Output formats
+const (
+	FormatDOT     = "dot"
+	FormatMermaid = "mermaid"
+	FormatJSON    = "json"
+)
+
+// Write renders the graph in a format
+func Write(w io.Writer, g *Graph, format string) error {
+	switch format {
+	case FormatDOT:
+		return WriteDOT(w, g)
+	case FormatMermaid:
+		return WriteMermaid(w, g)
+	case FormatJSON:
+		out, err := json.MarshalIndent(g, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(out))
+		return err
+	}
+	return fmt.Errorf("unknown format %q (want dot, mermaid or json)", format)
+}
+
+// labs returns the labs of the graph in node order
+func (g *Graph) labs() []string {
+	var labs []string
+	seen := make(map[string]bool)
+	for _, n := range g.Nodes {
+		if !seen[n.Lab] {
+			seen[n.Lab] = true
+			labs = append(labs, n.Lab)
+		}
+	}
+	return labs
+}
+
+// endLabel describes a link end: its interface, addresses and VLANs
+func endLabel(e Endpoint, sep string) string {
+	parts := append([]string{e.Interface}, e.Addrs...)
+	if vlan := vlanLabel(e.VLAN); vlan != "" {
+		parts = append(parts, vlan)
+	}
+	return strings.Join(parts, sep)
+}
+
+func vlanLabel(v *domain.PortVLAN) string {
+	switch {
+	case v == nil:
+		return ""
+	case v.Access > 0:
+		return fmt.Sprintf("access %d", v.Access)
+	case len(v.Trunk) > 0:
+		ids := make([]string, len(v.Trunk))
+		for i, id := range v.Trunk {
+			ids[i] = strconv.Itoa(id)
+		}
+		label := "trunk " + strings.Join(ids, ",")
+		if v.Native > 0 {
+			label += fmt.Sprintf(" native %d", v.Native)
+		}
+		return label
+	}
+	return ""
+}
+
+// paramsLabel describes the parameters of a link
+func paramsLabel(l Link) string {
+	var parts []string
+	switch l.Kind {
+	case LinkBond:
+		parts = append(parts, fmt.Sprintf("bond %s x%d", l.BondMode, l.BondMembers))
+	case LinkTunnel:
+		tunnel := l.TunnelKind
+		if l.VNI > 0 {
+			tunnel += fmt.Sprintf(" vni %d", l.VNI)
+		}
+		if l.Key > 0 {
+			tunnel += fmt.Sprintf(" key %d", l.Key)
+		}
+		parts = append(parts, tunnel)
+	}
+	if l.MTU > 0 {
+		parts = append(parts, fmt.Sprintf("mtu %d", l.MTU))
+	}
+	if l.Delay != "" {
+		parts = append(parts, "delay "+l.Delay)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// WriteDOT renders the graph for Graphviz, with a cluster per lab when it
+// spans several
+func WriteDOT(w io.Writer, g *Graph) error {
+	labs := g.labs()
+	name := "gonett"
+	if len(labs) == 1 {
+		name = labs[0]
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "graph %s {\n", dotQuote(name))
+	b.WriteString("  graph [overlap=false, splines=true];\n")
+	b.WriteString("  node [fontname=\"Helvetica\", fontsize=10];\n")
+	b.WriteString("  edge [fontname=\"Helvetica\", fontsize=8];\n")
+
+	for i, lab := range labs {
+		indent := "  "
+		if len(labs) > 1 {
+			fmt.Fprintf(&b, "  subgraph cluster_%d {\n    label=%s;\n", i, dotQuote(lab))
+			indent = "    "
+		}
+		for _, n := range g.Nodes {
+			if n.Lab != lab {
+				continue
+			}
+			label := n.Name + "\n" + n.Type
+			if len(n.Externals) > 0 {
+				label += "\n+ " + strings.Join(n.Externals, ", ")
+			}
+			fmt.Fprintf(&b, "%s%s [label=%s, shape=%s];\n", indent, dotQuote(n.Name), dotQuote(label), dotShape(n.Type))
+		}
+		if len(labs) > 1 {
+			b.WriteString("  }\n")
+		}
+	}
+
+	for _, l := range g.Links {
+		attrs := []string{
+			"taillabel=" + dotQuote(endLabel(l.A, "\n")),
+			"headlabel=" + dotQuote(endLabel(l.B, "\n")),
+		}
+		if params := paramsLabel(l); params != "" {
+			attrs = append(attrs, "label="+dotQuote(params))
+		}
+		switch l.Kind {
+		case LinkBond:
+			attrs = append(attrs, "style=bold", "penwidth=2")
+		case LinkTunnel:
+			attrs = append(attrs, "style=dashed")
+		}
+		fmt.Fprintf(&b, "  %s -- %s [%s];\n", dotQuote(l.A.Node), dotQuote(l.B.Node), strings.Join(attrs, ", "))
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func dotShape(nodeType string) string {
+	switch nodeType {
+	case "switch":
+		return "box3d"
+	case "nat":
+		return "house"
+	}
+	return "box"
+}
+
+// dotQuote quotes a DOT identifier; newlines become line breaks
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+// WriteMermaid renders the graph as a Mermaid flowchart, with a subgraph per
+// lab when it spans several
+func WriteMermaid(w io.Writer, g *Graph) error {
+	labs := g.labs()
+
+	var b strings.Builder
+	b.WriteString("graph LR\n")
+
+	for _, lab := range labs {
+		indent := "  "
+		if len(labs) > 1 {
+			fmt.Fprintf(&b, "  subgraph %s[%s]\n", mermaidID("lab_"+lab), mermaidQuote(lab))
+			indent = "    "
+		}
+		for _, n := range g.Nodes {
+			if n.Lab != lab {
+				continue
+			}
+			label := mermaidQuote(fmt.Sprintf("%s<br/><small>%s</small>", n.Name, n.Type))
+			id := mermaidID(n.Name)
+			switch n.Type {
+			case "switch":
+				fmt.Fprintf(&b, "%s%s[[%s]]\n", indent, id, label)
+			case "nat":
+				fmt.Fprintf(&b, "%s%s{{%s}}\n", indent, id, label)
+			default:
+				fmt.Fprintf(&b, "%s%s[%s]\n", indent, id, label)
+			}
+		}
+		if len(labs) > 1 {
+			b.WriteString("  end\n")
+		}
+	}
+
+	for _, l := range g.Links {
+		parts := []string{endLabel(l.A, " ")}
+		if params := paramsLabel(l); params != "" {
+			parts = append(parts, params)
+		}
+		parts = append(parts, endLabel(l.B, " "))
+
+		edge := "---"
+		switch l.Kind {
+		case LinkBond:
+			edge = "==="
+		case LinkTunnel:
+			edge = "-.-"
+		}
+		fmt.Fprintf(&b, "  %s %s|%s| %s\n", mermaidID(l.A.Node), edge, mermaidQuote(strings.Join(parts, "<br/>")), mermaidID(l.B.Node))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// mermaidID turns a name into a Mermaid node ID
+func mermaidID(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return "n_" + b.String()
+}
+
+func mermaidQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
@@ -0,0 +1,172 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gonett/internal/container/domain"
+	"gonett/internal/stats"
+)
+
+// ContentType is the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// family is one metric with its help text, type and samples
+type family struct {
+	name    string
+	help    string
+	kind    string // gauge or counter
+	samples []sample
+}
+
+type sample struct {
+	labels []string // Alternating names and values
+	value  float64
+}
+
+// registry collects families in the order they were first used
+type registry struct {
+	families []*family
+	byName   map[string]*family
+}
+
+func (r *registry) add(name, kind, help string, value float64, labels ...string) {
+	f := r.byName[name]
+	if f == nil {
+		f = &family{name: name, help: help, kind: kind}
+		r.families = append(r.families, f)
+		r.byName[name] = f
+	}
+	f.samples = append(f.samples, sample{labels: labels, value: value})
+}
+
+// Write gathers lab, node, interface and qdisc metrics for the containers
+// and writes them in the Prometheus text format
+func Write(w io.Writer, containers []*domain.Container) error {
+	r := &registry{byName: make(map[string]*family)}
+
+	nodes := make(map[string]int)
+	buildTimes := make(map[string]float64)
+	for _, c := range containers {
+		nodes[c.Lab]++
+		if c.BuildTime > buildTimes[c.Lab] {
+			buildTimes[c.Lab] = c.BuildTime
+		}
+	}
+	for _, lab := range sortedKeys(nodes) {
+		r.add("gonett_lab_nodes", "gauge", "Number of nodes in the lab.", float64(nodes[lab]), "lab", lab)
+	}
+	for _, lab := range sortedKeys(nodes) {
+		if buildTimes[lab] > 0 {
+			r.add("gonett_lab_build_duration_seconds", "gauge", "Time the last build of the lab took.", buildTimes[lab], "lab", lab)
+		}
+	}
+
+	sorted := append([]*domain.Container(nil), containers...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	for _, c := range sorted {
+		r.add("gonett_node_execs_total", "counter", "Commands run in the node through gonett exec.", float64(c.Execs), "lab", c.Lab, "node", c.Name, "type", c.Type)
+	}
+
+	// A node that cannot be read is reported as down instead of failing the scrape
+	snap := stats.Collect(containers)
+	for _, c := range sorted {
+		up := 1.0
+		if _, failed := snap.Errors[c.Name]; failed {
+			up = 0
+		}
+		r.add("gonett_node_stats_up", "gauge", "Whether the interface counters of the node could be read.", up, "lab", c.Lab, "node", c.Name)
+	}
+	for _, iface := range snap.Interfaces {
+		labels := []string{"lab", iface.Lab, "node", iface.Node, "interface", iface.Interface}
+		counter := func(name, help string, value uint64) {
+			r.add(name, "counter", help, float64(value), labels...)
+		}
+		counter("gonett_interface_receive_bytes_total", "Bytes received by the interface.", iface.RxBytes)
+		counter("gonett_interface_receive_packets_total", "Packets received by the interface.", iface.RxPackets)
+		counter("gonett_interface_receive_dropped_total", "Received packets dropped by the interface.", iface.RxDropped)
+		counter("gonett_interface_receive_errors_total", "Receive errors on the interface.", iface.RxErrors)
+		counter("gonett_interface_transmit_bytes_total", "Bytes sent by the interface.", iface.TxBytes)
+		counter("gonett_interface_transmit_packets_total", "Packets sent by the interface.", iface.TxPackets)
+		counter("gonett_interface_transmit_dropped_total", "Outgoing packets dropped by the interface.", iface.TxDropped)
+		counter("gonett_interface_transmit_errors_total", "Transmit errors on the interface.", iface.TxErrors)
+
+		for _, q := range iface.Qdiscs {
+			if q.Kind == "noqueue" {
+				continue
+			}
+			qlabels := append(append([]string(nil), labels...), "qdisc", q.Kind, "handle", q.Handle)
+			r.add("gonett_qdisc_backlog_bytes", "gauge", "Bytes queued in the qdisc.", float64(q.Backlog), qlabels...)
+			r.add("gonett_qdisc_backlog_packets", "gauge", "Packets queued in the qdisc.", float64(q.Qlen), qlabels...)
+			r.add("gonett_qdisc_drops_total", "counter", "Packets dropped by the qdisc.", float64(q.Drops), qlabels...)
+			r.add("gonett_qdisc_overlimits_total", "counter", "Times the qdisc went over its limit.", float64(q.Overlimits), qlabels...)
+			r.add("gonett_qdisc_sent_bytes_total", "counter", "Bytes sent through the qdisc.", float64(q.Bytes), qlabels...)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, f := range r.families {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+		for _, s := range f.samples {
+			fmt.Fprintf(bw, "%s%s %s\n", f.name, formatLabels(s.labels), strconv.FormatFloat(s.value, 'g', -1, 64))
+		}
+	}
+	return bw.Flush()
+}
+
+// Handler serves the metrics of the containers returned by list on every scrape
+func Handler(list func() ([]*domain.Container, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		containers, err := list()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var buf strings.Builder
+		if err := Write(&buf, containers); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", ContentType)
+		io.WriteString(w, buf.String())
+	})
+}
+
+// formatLabels renders name/value pairs as {name="value",...}
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(labels[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
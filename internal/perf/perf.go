@@ -0,0 +1,400 @@
+package perf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"gonett/internal/container/domain"
+
+	"golang.org/x/sys/unix"
+)
+
+// Defaults follow iperf3
+const (
+	DefaultPort     = 5201
+	DefaultDuration = 10 * time.Second
+	DefaultUDPRate  = 1_000_000 // bits per second
+	tcpBufferLen    = 128 * 1024
+	udpPayloadLen   = 1448
+	tcpSegmentLen   = 1448 // Typical MSS on a 1500-byte link
+)
+
+// udpHeaderLen is the per-datagram header: stream, sequence number and
+// send timestamp
+const udpHeaderLen = 4 + 8 + 8
+
+// udpDrain is how long the server keeps reading after the clients stop
+const udpDrain = 500 * time.Millisecond
+
+// Options configures a throughput test
+type Options struct {
+	UDP      bool
+	Duration time.Duration // Default 10s
+	Streams  int           // Parallel streams (default 1)
+	Rate     int64         // UDP target rate in bits per second, shared by all streams (default 1 Mbit/s)
+	Port     int           // Server port (default 5201)
+}
+
+// StreamResult is the outcome of one stream
+type StreamResult struct {
+	Stream        int     `json:"stream"`
+	BytesSent     int64   `json:"bytes_sent"`
+	BytesReceived int64   `json:"bytes_received"`
+	Seconds       float64 `json:"seconds"`
+	BitsPerSecond float64 `json:"bits_per_second"`
+	Retransmits   uint32  `json:"retransmits,omitempty"`
+	Packets       int64   `json:"packets,omitempty"`
+	Lost          int64   `json:"lost_packets,omitempty"`
+	JitterMs      float64 `json:"jitter_ms,omitempty"`
+}
+
+// Result is the outcome of a throughput test, measured at the receiver
+type Result struct {
+	Protocol      string         `json:"protocol"`
+	Target        string         `json:"target"`
+	Seconds       float64        `json:"seconds"`
+	BytesSent     int64          `json:"bytes_sent"`
+	BytesReceived int64          `json:"bytes_received"`
+	BitsPerSecond float64        `json:"bits_per_second"`
+	Retransmits   uint32         `json:"retransmits"`            // TCP segments retransmitted by the sender
+	Packets       int64          `json:"packets,omitempty"`      // UDP datagrams sent
+	Lost          int64          `json:"lost_packets,omitempty"` // UDP datagrams never received
+	LossPercent   float64        `json:"loss_percent,omitempty"` // UDP loss, or TCP retransmitted share of segments
+	JitterMs      float64        `json:"jitter_ms,omitempty"`    // UDP interarrival jitter (RFC 3550), averaged over streams
+	Streams       []StreamResult `json:"streams"`
+}
+
+// Run measures throughput from a client namespace to target, served from
+// the server namespace. The sockets are opened inside their namespaces;
+// the transfer itself runs on ordinary goroutines.
+func Run(server, client *domain.Namespace, target net.IP, opts Options) (*Result, error) {
+	if opts.Duration <= 0 {
+		opts.Duration = DefaultDuration
+	}
+	if opts.Streams <= 0 {
+		opts.Streams = 1
+	}
+	if opts.Port == 0 {
+		opts.Port = DefaultPort
+	}
+	if opts.UDP && opts.Rate <= 0 {
+		opts.Rate = DefaultUDPRate
+	}
+
+	addr := net.JoinHostPort(target.String(), strconv.Itoa(opts.Port))
+	if opts.UDP {
+		return runUDP(server, client, addr, opts)
+	}
+	return runTCP(server, client, addr, opts)
+}
+
+// runTCP runs parallel TCP streams, each writing as fast as it can
+func runTCP(server, client *domain.Namespace, addr string, opts Options) (*Result, error) {
+	var ln net.Listener
+	err := server.Run(func() error {
+		var err error
+		ln, err = net.Listen("tcp", addr)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", addr, err)
+	}
+	defer ln.Close()
+
+	streams := make([]StreamResult, opts.Streams)
+	var wg sync.WaitGroup
+
+	// Receivers: one per accepted connection, matched to the stream by the
+	// index the client sends first. Anything else in the lab may connect to
+	// the port too, so connections naming no stream, or one already taken,
+	// are dropped; accepting stops when the listener closes.
+	received := make(chan StreamResult, opts.Streams)
+	var claimMu sync.Mutex
+	claimed := make([]bool, opts.Streams)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var buf [4]byte
+				if _, err := io.ReadFull(conn, buf[:]); err != nil {
+					return
+				}
+				id := int(binary.BigEndian.Uint32(buf[:]))
+				if id < 0 || id >= len(claimed) {
+					return
+				}
+				claimMu.Lock()
+				taken := claimed[id]
+				claimed[id] = true
+				claimMu.Unlock()
+				if taken {
+					return
+				}
+
+				start := time.Now()
+				n, _ := io.Copy(io.Discard, conn)
+				received <- StreamResult{
+					Stream:        id,
+					BytesReceived: n,
+					Seconds:       time.Since(start).Seconds(),
+				}
+			}()
+		}
+	}()
+
+	conns := make([]net.Conn, opts.Streams)
+	for i := range conns {
+		err := client.Run(func() error {
+			var err error
+			conns[i], err = net.DialTimeout("tcp", addr, 5*time.Second)
+			return err
+		})
+		if err != nil {
+			for _, c := range conns[:i] {
+				c.Close()
+			}
+			return nil, fmt.Errorf("connect to %s: %w", addr, err)
+		}
+	}
+
+	deadline := time.Now().Add(opts.Duration)
+	errs := make(chan error, opts.Streams)
+	for i, conn := range conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+
+			buf := make([]byte, tcpBufferLen)
+			binary.BigEndian.PutUint32(buf, uint32(i))
+			if _, err := conn.Write(buf[:4]); err != nil {
+				errs <- err
+				return
+			}
+
+			conn.SetWriteDeadline(deadline)
+			var sent int64
+			for time.Now().Before(deadline) {
+				n, err := conn.Write(buf)
+				sent += int64(n)
+				if err != nil {
+					break
+				}
+			}
+
+			streams[i].Stream = i
+			streams[i].BytesSent = sent
+			streams[i].Retransmits = tcpRetransmits(conn)
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return nil, fmt.Errorf("send: %w", err)
+	default:
+	}
+
+	for i := 0; i < opts.Streams; i++ {
+		select {
+		case r := <-received:
+			streams[r.Stream].BytesReceived = r.BytesReceived
+			streams[r.Stream].Seconds = r.Seconds
+		case <-time.After(5 * time.Second):
+			return nil, errors.New("receiver did not finish")
+		}
+	}
+
+	return summarize("tcp", addr, streams), nil
+}
+
+// tcpRetransmits returns the number of segments the connection retransmitted
+func tcpRetransmits(conn net.Conn) uint32 {
+	tcp, ok := conn.(*net.TCPConn)
+	if !ok {
+		return 0
+	}
+	raw, err := tcp.SyscallConn()
+	if err != nil {
+		return 0
+	}
+
+	var retrans uint32
+	raw.Control(func(fd uintptr) {
+		if info, err := unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO); err == nil {
+			retrans = info.Total_retrans
+		}
+	})
+	return retrans
+}
+
+// udpStream accumulates what the server saw of one UDP stream
+type udpStream struct {
+	packets  int64
+	bytes    int64
+	first    time.Time
+	last     time.Time
+	transit  float64 // Previous relative transit time, seconds
+	jitter   float64 // RFC 3550 interarrival jitter, seconds
+	received bool
+}
+
+// runUDP runs parallel UDP streams paced to the target rate
+func runUDP(server, client *domain.Namespace, addr string, opts Options) (*Result, error) {
+	var pc net.PacketConn
+	err := server.Run(func() error {
+		var err error
+		pc, err = net.ListenPacket("udp", addr)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", addr, err)
+	}
+	defer pc.Close()
+
+	stats := make([]udpStream, opts.Streams)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 65536)
+		for {
+			n, _, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			now := time.Now()
+			if n < udpHeaderLen {
+				continue
+			}
+			id := int(binary.BigEndian.Uint32(buf))
+			if id < 0 || id >= len(stats) {
+				continue
+			}
+			sentAt := time.Unix(0, int64(binary.BigEndian.Uint64(buf[12:])))
+
+			s := &stats[id]
+			transit := now.Sub(sentAt).Seconds()
+			if s.received {
+				d := math.Abs(transit - s.transit)
+				s.jitter += (d - s.jitter) / 16
+			} else {
+				s.first, s.received = now, true
+			}
+			s.transit, s.last = transit, now
+			s.packets++
+			s.bytes += int64(n)
+		}
+	}()
+
+	conns := make([]net.Conn, opts.Streams)
+	for i := range conns {
+		err := client.Run(func() error {
+			var err error
+			conns[i], err = net.Dial("udp", addr)
+			return err
+		})
+		if err != nil {
+			for _, c := range conns[:i] {
+				c.Close()
+			}
+			return nil, fmt.Errorf("connect to %s: %w", addr, err)
+		}
+	}
+
+	// Each stream sends its share of the rate with evenly spaced datagrams
+	interval := time.Duration(float64(time.Second) * float64(udpPayloadLen*8) / (float64(opts.Rate) / float64(opts.Streams)))
+
+	streams := make([]StreamResult, opts.Streams)
+	start := time.Now()
+	deadline := start.Add(opts.Duration)
+	var wg sync.WaitGroup
+	for i, conn := range conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+
+			buf := make([]byte, udpPayloadLen)
+			binary.BigEndian.PutUint32(buf, uint32(i))
+			var seq uint64
+			var sent int64
+			for next := time.Now(); next.Before(deadline); next = next.Add(interval) {
+				if wait := time.Until(next); wait > 0 {
+					time.Sleep(wait)
+				}
+				binary.BigEndian.PutUint64(buf[4:], seq)
+				binary.BigEndian.PutUint64(buf[12:], uint64(time.Now().UnixNano()))
+				// Drops in the local stack count as loss, like on the wire
+				if n, err := conn.Write(buf); err == nil {
+					sent += int64(n)
+				}
+				seq++
+			}
+			streams[i].Stream = i
+			streams[i].BytesSent = sent
+			streams[i].Packets = int64(seq)
+		}()
+	}
+	wg.Wait()
+
+	time.Sleep(udpDrain)
+	pc.Close()
+	<-done
+
+	for i := range streams {
+		s := stats[i]
+		streams[i].BytesReceived = s.bytes
+		streams[i].Seconds = time.Since(start).Seconds() - udpDrain.Seconds()
+		if s.received && s.last.After(s.first) {
+			streams[i].Seconds = s.last.Sub(s.first).Seconds()
+		}
+		streams[i].Lost = streams[i].Packets - s.packets
+		streams[i].JitterMs = s.jitter * 1000
+	}
+
+	return summarize("udp", addr, streams), nil
+}
+
+// summarize computes per-stream rates and the totals
+func summarize(protocol, target string, streams []StreamResult) *Result {
+	r := &Result{Protocol: protocol, Target: target, Streams: streams}
+
+	for i := range streams {
+		s := &streams[i]
+		if s.Seconds > 0 {
+			s.BitsPerSecond = float64(s.BytesReceived*8) / s.Seconds
+		}
+		if s.Seconds > r.Seconds {
+			r.Seconds = s.Seconds
+		}
+		r.BytesSent += s.BytesSent
+		r.BytesReceived += s.BytesReceived
+		r.BitsPerSecond += s.BitsPerSecond
+		r.Retransmits += s.Retransmits
+		r.Packets += s.Packets
+		r.Lost += s.Lost
+		r.JitterMs += s.JitterMs / float64(len(streams))
+	}
+
+	switch {
+	case protocol == "udp" && r.Packets > 0:
+		r.LossPercent = float64(r.Lost) * 100 / float64(r.Packets)
+	case protocol == "tcp" && r.BytesSent > 0:
+		// Approximate the retransmitted share with full-sized segments
+		segments := float64(r.BytesSent) / tcpSegmentLen
+		r.LossPercent = float64(r.Retransmits) * 100 / segments
+	}
+
+	return r
+}
@@ -0,0 +1,156 @@
+package ping
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+
+	"gonett/internal/container/domain"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	icmpEchoRequest   = 8
+	icmpEchoReply     = 0
+	icmpv6EchoRequest = 128
+	icmpv6EchoReply   = 129
+)
+
+// Echo sends one ICMP or ICMPv6 echo request to dst from inside the
+// namespace and waits for the matching reply, returning the round-trip
+// time. Link-local IPv6 destinations need dst.Zone set to the outgoing
+// interface name.
+func Echo(namespace *domain.Namespace, dst net.IPAddr, timeout time.Duration) (time.Duration, error) {
+	ipv6 := dst.IP.To4() == nil
+
+	var fd int
+	var sa unix.Sockaddr
+	err := namespace.Run(func() error {
+		var err error
+		if ipv6 {
+			fd, err = unix.Socket(unix.AF_INET6, unix.SOCK_RAW, unix.IPPROTO_ICMPV6)
+		} else {
+			fd, err = unix.Socket(unix.AF_INET, unix.SOCK_RAW, unix.IPPROTO_ICMP)
+		}
+		if err != nil {
+			return fmt.Errorf("open icmp socket: %w", err)
+		}
+
+		sa, err = sockaddr(dst)
+		return err
+	})
+	if err != nil {
+		if fd > 0 {
+			unix.Close(fd)
+		}
+		return 0, err
+	}
+	defer unix.Close(fd)
+
+	id := uint16(rand.Intn(0xffff))
+	seq := uint16(1)
+
+	request, reply := byte(icmpEchoRequest), byte(icmpEchoReply)
+	if ipv6 {
+		request, reply = icmpv6EchoRequest, icmpv6EchoReply
+	}
+
+	msg := make([]byte, 16)
+	msg[0] = request
+	binary.BigEndian.PutUint16(msg[4:], id)
+	binary.BigEndian.PutUint16(msg[6:], seq)
+	binary.BigEndian.PutUint64(msg[8:], uint64(time.Now().UnixNano()))
+	if !ipv6 {
+		// The kernel fills in the ICMPv6 checksum itself
+		binary.BigEndian.PutUint16(msg[2:], checksum(msg))
+	}
+
+	start := time.Now()
+	if err := unix.Sendto(fd, msg, 0, sa); err != nil {
+		return 0, fmt.Errorf("send echo request: %w", err)
+	}
+
+	deadline := start.Add(timeout)
+	buf := make([]byte, 1500)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return 0, fmt.Errorf("no reply from %s within %s", dst.String(), timeout)
+		}
+		tv := unix.NsecToTimeval(remaining.Nanoseconds())
+		if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+			return 0, fmt.Errorf("set receive timeout: %w", err)
+		}
+
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err == unix.EAGAIN || err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("receive echo reply: %w", err)
+		}
+
+		packet := buf[:n]
+		if !ipv6 {
+			// Raw IPv4 sockets deliver the IP header as well
+			if n < 20 {
+				continue
+			}
+			srcIP := net.IP(packet[12:16])
+			packet = packet[int(packet[0]&0x0f)*4:]
+			if !srcIP.Equal(dst.IP) {
+				continue
+			}
+		}
+
+		if len(packet) < 8 || packet[0] != reply {
+			continue
+		}
+		if binary.BigEndian.Uint16(packet[4:]) != id || binary.BigEndian.Uint16(packet[6:]) != seq {
+			continue
+		}
+
+		return time.Since(start), nil
+	}
+}
+
+// sockaddr converts dst into a socket address, resolving an IPv6 zone to
+// its interface index. Must run inside the namespace owning the interface.
+func sockaddr(dst net.IPAddr) (unix.Sockaddr, error) {
+	if ip4 := dst.IP.To4(); ip4 != nil {
+		sa := &unix.SockaddrInet4{}
+		copy(sa.Addr[:], ip4)
+		return sa, nil
+	}
+
+	sa := &unix.SockaddrInet6{}
+	copy(sa.Addr[:], dst.IP.To16())
+	if dst.Zone != "" {
+		iface, err := net.InterfaceByName(dst.Zone)
+		if err != nil {
+			return nil, fmt.Errorf("resolve zone %s: %w", dst.Zone, err)
+		}
+		sa.ZoneId = uint32(iface.Index)
+	} else if dst.IP.IsLinkLocalUnicast() {
+		return nil, fmt.Errorf("link-local destination %s needs an interface zone", dst.IP)
+	}
+	return sa, nil
+}
+
+// checksum computes the Internet checksum of b
+func checksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,184 @@
+package stats
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"gonett/internal/container/domain"
+)
+
+// Record formats
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// RecordOptions configures a recording. A zero Duration records until stop
+// is closed.
+type RecordOptions struct {
+	Interval time.Duration
+	Duration time.Duration
+	Format   string               // csv (default) or jsonl
+	Select   func(Interface) bool // Interfaces to record (nil records all)
+	Warn     func(string)         // Called when a node stops being readable
+}
+
+// Sample is one recorded row: the counters of one interface at one point
+// in time. Elapsed comes from the monotonic clock, so it never jumps with
+// wall clock adjustments; rates cover the time since the previous sample.
+type Sample struct {
+	Elapsed    float64 `json:"elapsed"` // Seconds since the recording started
+	Time       int64   `json:"time"`    // Wall clock, Unix nanoseconds
+	Lab        string  `json:"lab,omitempty"`
+	Node       string  `json:"node"`
+	Interface  string  `json:"interface"`
+	RxBytes    uint64  `json:"rx_bytes"`
+	RxPackets  uint64  `json:"rx_packets"`
+	RxDropped  uint64  `json:"rx_dropped"`
+	RxErrors   uint64  `json:"rx_errors"`
+	TxBytes    uint64  `json:"tx_bytes"`
+	TxPackets  uint64  `json:"tx_packets"`
+	TxDropped  uint64  `json:"tx_dropped"`
+	TxErrors   uint64  `json:"tx_errors"`
+	QdiscDrops uint64  `json:"qdisc_drops"`
+	QdiscOver  uint64  `json:"qdisc_overlimits"`
+	Backlog    uint32  `json:"qdisc_backlog"`
+	Qlen       uint32  `json:"qdisc_qlen"`
+	RxBps      float64 `json:"rx_bps"`
+	TxBps      float64 `json:"tx_bps"`
+}
+
+var csvHeader = []string{
+	"elapsed", "time", "lab", "node", "interface",
+	"rx_bytes", "rx_packets", "rx_dropped", "rx_errors",
+	"tx_bytes", "tx_packets", "tx_dropped", "tx_errors",
+	"qdisc_drops", "qdisc_overlimits", "qdisc_backlog", "qdisc_qlen",
+	"rx_bps", "tx_bps",
+}
+
+func (s *Sample) csvRecord() []string {
+	u := func(v uint64) string { return strconv.FormatUint(v, 10) }
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	return []string{
+		strconv.FormatFloat(s.Elapsed, 'f', 6, 64), strconv.FormatInt(s.Time, 10), s.Lab, s.Node, s.Interface,
+		u(s.RxBytes), u(s.RxPackets), u(s.RxDropped), u(s.RxErrors),
+		u(s.TxBytes), u(s.TxPackets), u(s.TxDropped), u(s.TxErrors),
+		u(s.QdiscDrops), u(s.QdiscOver), u(uint64(s.Backlog)), u(uint64(s.Qlen)),
+		f(s.RxBps), f(s.TxBps),
+	}
+}
+
+// Record samples the containers' interfaces every interval and writes one
+// row per interface and sample until the duration elapses or stop is
+// closed. It returns the number of sampling rounds written.
+func Record(containers []*domain.Container, w io.Writer, opts RecordOptions, stop <-chan struct{}) (int, error) {
+	if opts.Interval <= 0 {
+		return 0, fmt.Errorf("interval must be positive")
+	}
+
+	var write func(*Sample) error
+	var flush func() error
+	switch opts.Format {
+	case "", FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvHeader); err != nil {
+			return 0, err
+		}
+		write = func(s *Sample) error { return cw.Write(s.csvRecord()) }
+		flush = func() error { cw.Flush(); return cw.Error() }
+	case FormatJSONL:
+		enc := json.NewEncoder(w)
+		write = func(s *Sample) error { return enc.Encode(s) }
+		flush = func() error { return nil }
+	default:
+		return 0, fmt.Errorf("unknown format %q (want csv or jsonl)", opts.Format)
+	}
+
+	start := time.Now()
+	var timeout <-chan time.Time
+	if opts.Duration > 0 {
+		timeout = time.After(opts.Duration)
+	}
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	prev := make(map[string]*Sample)
+	failing := make(map[string]bool)
+	rounds := 0
+	for {
+		snap := Collect(containers)
+		// Warn once per outage rather than on every sample
+		for node := range failing {
+			if _, ok := snap.Errors[node]; !ok {
+				delete(failing, node)
+			}
+		}
+		for _, c := range containers {
+			if msg, ok := snap.Errors[c.Name]; ok && !failing[c.Name] {
+				failing[c.Name] = true
+				if opts.Warn != nil {
+					opts.Warn(fmt.Sprintf("skipped %s: %s", c.Name, msg))
+				}
+			}
+		}
+
+		for _, iface := range snap.Interfaces {
+			if opts.Select != nil && !opts.Select(iface) {
+				continue
+			}
+			s := newSample(iface, snap.Time, start)
+			key := iface.Node + "/" + iface.Interface
+			if p := prev[key]; p != nil && s.Elapsed > p.Elapsed {
+				seconds := s.Elapsed - p.Elapsed
+				s.RxBps = float64(delta(s.RxBytes, p.RxBytes)*8) / seconds
+				s.TxBps = float64(delta(s.TxBytes, p.TxBytes)*8) / seconds
+			}
+			prev[key] = s
+
+			if err := write(s); err != nil {
+				return rounds, fmt.Errorf("write sample: %w", err)
+			}
+		}
+		if err := flush(); err != nil {
+			return rounds, fmt.Errorf("write sample: %w", err)
+		}
+		rounds++
+
+		select {
+		case <-ticker.C:
+		case <-timeout:
+			return rounds, nil
+		case <-stop:
+			return rounds, nil
+		}
+	}
+}
+
+func newSample(iface Interface, at, start time.Time) *Sample {
+	s := &Sample{
+		Elapsed:   at.Sub(start).Seconds(),
+		Time:      at.UnixNano(),
+		Lab:       iface.Lab,
+		Node:      iface.Node,
+		Interface: iface.Interface,
+		RxBytes:   iface.RxBytes,
+		RxPackets: iface.RxPackets,
+		RxDropped: iface.RxDropped,
+		RxErrors:  iface.RxErrors,
+		TxBytes:   iface.TxBytes,
+		TxPackets: iface.TxPackets,
+		TxDropped: iface.TxDropped,
+		TxErrors:  iface.TxErrors,
+		Backlog:   iface.Backlog(),
+	}
+	for _, q := range iface.Qdiscs {
+		s.QdiscDrops += uint64(q.Drops)
+		s.QdiscOver += uint64(q.Overlimits)
+		s.Qlen += q.Qlen
+	}
+	return s
+}
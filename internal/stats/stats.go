@@ -0,0 +1,241 @@
+package stats
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"gonett/internal/container/domain"
+
+	"github.com/vishvananda/netlink"
+)
+
+// Interface holds the kernel counters of one interface of a node
+type Interface struct {
+	Lab       string  `json:"lab,omitempty"`
+	Node      string  `json:"node"`
+	Interface string  `json:"interface"`
+	RxBytes   uint64  `json:"rx_bytes"`
+	RxPackets uint64  `json:"rx_packets"`
+	RxDropped uint64  `json:"rx_dropped"`
+	RxErrors  uint64  `json:"rx_errors"`
+	TxBytes   uint64  `json:"tx_bytes"`
+	TxPackets uint64  `json:"tx_packets"`
+	TxDropped uint64  `json:"tx_dropped"`
+	TxErrors  uint64  `json:"tx_errors"`
+	Qdiscs    []Qdisc `json:"qdiscs,omitempty"`
+}
+
+// Qdisc holds the counters of a queueing discipline attached to an interface
+type Qdisc struct {
+	Kind       string `json:"kind"`
+	Handle     string `json:"handle"`
+	Parent     string `json:"parent"`
+	Bytes      uint64 `json:"bytes"`
+	Packets    uint32 `json:"packets"`
+	Drops      uint32 `json:"drops"`
+	Overlimits uint32 `json:"overlimits"`
+	Requeues   uint32 `json:"requeues"`
+	Backlog    uint32 `json:"backlog"` // Bytes
+	Qlen       uint32 `json:"qlen"`    // Packets
+}
+
+// Snapshot is the state of every collected interface at one point in time
+type Snapshot struct {
+	Time       time.Time         `json:"time"`
+	Interfaces []Interface       `json:"interfaces"`
+	Errors     map[string]string `json:"errors,omitempty"` // Nodes that could not be read
+}
+
+// Collect reads link and qdisc statistics for every interface of the
+// containers. Containers without a namespace only contribute the veth ends
+// recorded on them, not the whole root namespace. A node that cannot be
+// read, for example because its namespace is gone, is left out and its
+// error recorded in Errors so the rest of the lab is still reported.
+func Collect(containers []*domain.Container) *Snapshot {
+	snap := &Snapshot{Time: time.Now()}
+
+	for _, c := range containers {
+		ifaces, err := collectContainer(c)
+		if err != nil {
+			if snap.Errors == nil {
+				snap.Errors = make(map[string]string)
+			}
+			snap.Errors[c.Name] = err.Error()
+			continue
+		}
+		snap.Interfaces = append(snap.Interfaces, ifaces...)
+	}
+
+	sort.SliceStable(snap.Interfaces, func(i, j int) bool {
+		a, b := snap.Interfaces[i], snap.Interfaces[j]
+		if a.Node != b.Node {
+			return a.Node < b.Node
+		}
+		return a.Interface < b.Interface
+	})
+
+	return snap
+}
+
+// Warnings describes the nodes that could not be read, sorted by node
+func (s *Snapshot) Warnings() []string {
+	nodes := make([]string, 0, len(s.Errors))
+	for node := range s.Errors {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	warnings := make([]string, len(nodes))
+	for i, node := range nodes {
+		warnings[i] = fmt.Sprintf("skipped %s: %s", node, s.Errors[node])
+	}
+	return warnings
+}
+
+func collectContainer(c *domain.Container) ([]Interface, error) {
+	// Only the container's own ends live in the root namespace
+	var only map[string]bool
+	if c.Namespace == nil {
+		only = make(map[string]bool)
+		for _, v := range c.Veths {
+			if v.NamespaceA == nil {
+				only[v.Name] = true
+			}
+			if v.NamespaceB == nil {
+				only[v.PeerName] = true
+			}
+		}
+	}
+
+	var ifaces []Interface
+	err := c.Namespace.Run(func() error {
+		links, err := netlink.LinkList()
+		if err != nil {
+			return fmt.Errorf("list links: %w", err)
+		}
+
+		for _, link := range links {
+			attrs := link.Attrs()
+			if attrs.Flags&net.FlagLoopback != 0 || (only != nil && !only[attrs.Name]) {
+				continue
+			}
+
+			iface := Interface{Lab: c.Lab, Node: c.Name, Interface: attrs.Name}
+			if s := attrs.Statistics; s != nil {
+				iface.RxBytes, iface.RxPackets = s.RxBytes, s.RxPackets
+				iface.RxDropped, iface.RxErrors = s.RxDropped, s.RxErrors
+				iface.TxBytes, iface.TxPackets = s.TxBytes, s.TxPackets
+				iface.TxDropped, iface.TxErrors = s.TxDropped, s.TxErrors
+			}
+
+			qdiscs, err := netlink.QdiscList(link)
+			if err != nil {
+				return fmt.Errorf("list qdiscs on %s: %w", attrs.Name, err)
+			}
+			for _, q := range qdiscs {
+				iface.Qdiscs = append(iface.Qdiscs, qdiscStats(q))
+			}
+
+			ifaces = append(ifaces, iface)
+		}
+		return nil
+	})
+
+	return ifaces, err
+}
+
+func qdiscStats(q netlink.Qdisc) Qdisc {
+	attrs := q.Attrs()
+	qs := Qdisc{
+		Kind:   q.Type(),
+		Handle: netlink.HandleStr(attrs.Handle),
+		Parent: netlink.HandleStr(attrs.Parent),
+	}
+	if s := attrs.Statistics; s != nil {
+		if s.Basic != nil {
+			qs.Bytes, qs.Packets = s.Basic.Bytes, s.Basic.Packets
+		}
+		if s.Queue != nil {
+			qs.Drops, qs.Overlimits, qs.Requeues = s.Queue.Drops, s.Queue.Overlimits, s.Queue.Requeues
+			qs.Backlog, qs.Qlen = s.Queue.Backlog, s.Queue.Qlen
+		}
+	}
+	return qs
+}
+
+// Rate is the change of an interface's counters between two snapshots
+type Rate struct {
+	Node      string
+	Interface string
+	RxBps     float64 // Bits per second
+	TxBps     float64
+	RxPps     float64 // Packets per second
+	TxPps     float64
+	Drops     uint64 // Interface and qdisc drops in the interval
+	Backlog   uint32 // Current qdisc backlog in bytes
+}
+
+// Rates computes per-interface rates between prev and s, sorted by total
+// throughput. Interfaces missing from prev are skipped.
+func (s *Snapshot) Rates(prev *Snapshot) []Rate {
+	seconds := s.Time.Sub(prev.Time).Seconds()
+	if seconds <= 0 {
+		return nil
+	}
+
+	before := make(map[string]Interface)
+	for _, iface := range prev.Interfaces {
+		before[iface.Node+"/"+iface.Interface] = iface
+	}
+
+	var rates []Rate
+	for _, cur := range s.Interfaces {
+		old, ok := before[cur.Node+"/"+cur.Interface]
+		if !ok {
+			continue
+		}
+		rates = append(rates, Rate{
+			Node:      cur.Node,
+			Interface: cur.Interface,
+			RxBps:     float64(delta(cur.RxBytes, old.RxBytes)*8) / seconds,
+			TxBps:     float64(delta(cur.TxBytes, old.TxBytes)*8) / seconds,
+			RxPps:     float64(delta(cur.RxPackets, old.RxPackets)) / seconds,
+			TxPps:     float64(delta(cur.TxPackets, old.TxPackets)) / seconds,
+			Drops:     delta(cur.Drops(), old.Drops()),
+			Backlog:   cur.Backlog(),
+		})
+	}
+
+	sort.SliceStable(rates, func(i, j int) bool {
+		return rates[i].RxBps+rates[i].TxBps > rates[j].RxBps+rates[j].TxBps
+	})
+	return rates
+}
+
+// Drops returns the interface's dropped packets, including qdisc drops
+func (i *Interface) Drops() uint64 {
+	drops := i.RxDropped + i.TxDropped
+	for _, q := range i.Qdiscs {
+		drops += uint64(q.Drops)
+	}
+	return drops
+}
+
+// Backlog returns the bytes queued in the interface's qdiscs
+func (i *Interface) Backlog() uint32 {
+	var backlog uint32
+	for _, q := range i.Qdiscs {
+		backlog += q.Backlog
+	}
+	return backlog
+}
+
+// delta tolerates counters that were reset, e.g. by a recreated interface
+func delta(cur, old uint64) uint64 {
+	if cur < old {
+		return cur
+	}
+	return cur - old
+}
@@ -1,26 +1,70 @@
 package topology
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"net"
+	"sort"
+	"strings"
+	"time"
 
 	"gonett/internal/container/domain"
 	"gonett/internal/container/manager"
 	"gonett/internal/container/repository"
+	"gonett/internal/dhcp"
+	"gonett/internal/dns"
 )
 
+// maxIfNameLen is the longest interface name the kernel accepts
+const maxIfNameLen = 15
+
+// defaultDADTimeout bounds how long a build waits for IPv6 DAD
+const defaultDADTimeout = 5 * time.Second
+
+// dhcpTimeout bounds how long a host waits for a DHCP lease
+const dhcpTimeout = 10 * time.Second
+
+// defaultDNSDomain is the search domain of lab DNS names
+const defaultDNSDomain = "lab"
+
+// Options tunes how a topology is built
+type Options struct {
+	// AutoSetMACs assigns every link end a MAC derived from its node index
+	// and port number instead of a random one
+	AutoSetMACs bool
+	// StaticARP installs permanent neighbor entries for every pair of host
+	// addresses sharing a subnet, so no ARP/NDP traffic is needed
+	StaticARP bool
+}
+
 type Builder struct {
 	cm            *manager.ContainerManager
 	containerRepo *repository.ContainerRepository
 	topology      *Topology
+	options       Options
+	nodeIndex     map[string]int
 }
 
 func NewBuilder() (*Builder, error) {
+	return NewBuilderWithOptions(Options{})
+}
+
+// NewBuilderWithOptions creates a builder applying opts to every build
+func NewBuilderWithOptions(opts Options) (*Builder, error) {
 	// Initialize repositories
 	repos, err := repository.InitializeRepositories()
 	if err != nil {
 		return nil, fmt.Errorf("initialize repositories: %w", err)
 	}
 
+	return NewBuilderWithRepositories(repos, opts), nil
+}
+
+// NewBuilderWithRepositories creates a builder on top of already
+// initialized repositories, such as the ones a long-running daemon owns
+func NewBuilderWithRepositories(repos *repository.Repositories, opts Options) *Builder {
 	// Create container manager
 	cm := manager.NewContainerManager(
 		repos.ContainerRepo,
@@ -33,17 +77,29 @@ func NewBuilder() (*Builder, error) {
 		cm:            cm,
 		containerRepo: repos.ContainerRepo,
 		topology:      nil,
-	}, nil
+		options:       opts,
+	}
 }
 
 // Build creates containers for all nodes in the topology
 func (b *Builder) Build(t *Topology) error {
 	b.topology = t // Store topology for later reference
+	start := time.Now()
 
 	// Create containers for each node
 	nodeContainers := make(map[string]*domain.Container)
 
-	for nodeName, node := range t.Nodes {
+	// Sysctls naming interfaces that do not exist yet, per node
+	pendingSysctls := make(map[string]map[string]string)
+
+	// Node indexes feed the derived MAC addresses
+	b.nodeIndex = make(map[string]int)
+	for i, nodeName := range sortedNodeNames(t) {
+		b.nodeIndex[nodeName] = i + 1
+	}
+
+	for _, nodeName := range sortedNodeNames(t) {
+		node := t.Nodes[nodeName]
 		var container *domain.Container
 		var err error
 
@@ -51,7 +107,9 @@ func (b *Builder) Build(t *Topology) error {
 		case NodeHost:
 			container, err = b.buildHost(nodeName)
 		case NodeSwitch:
-			container, err = b.buildSwitch(nodeName)
+			container, err = b.buildSwitch(nodeName, node.Switch, node.External)
+		case NodeNAT:
+			container, err = b.buildNATNode(nodeName)
 		default:
 			return fmt.Errorf("unknown node type: %s", node.Type)
 		}
@@ -60,20 +118,226 @@ func (b *Builder) Build(t *Topology) error {
 			return fmt.Errorf("build node %s: %w", nodeName, err)
 		}
 
+		container.Type = string(node.Type)
+		container.Lab = t.LabName()
+		if err := b.containerRepo.Save(container); err != nil {
+			return fmt.Errorf("save node %s: %w", nodeName, err)
+		}
+
+		// Namespace-wide settings must be in place before interfaces exist
+		if container.Namespace != nil {
+			if t.IPv6.DisableDAD {
+				if err := domain.DisableDAD(container.Namespace); err != nil {
+					return fmt.Errorf("disable dad on %s: %w", nodeName, err)
+				}
+			}
+			if node.Forwarding {
+				if err := domain.EnableForwarding(container.Namespace); err != nil {
+					return fmt.Errorf("enable forwarding on %s: %w", nodeName, err)
+				}
+			}
+		}
+
+		pending, err := b.applySysctls(container, node.Sysctls)
+		if err != nil {
+			return fmt.Errorf("sysctls on %s: %w", nodeName, err)
+		}
+		if len(pending) > 0 {
+			pendingSysctls[nodeName] = pending
+		}
+
 		nodeContainers[nodeName] = container
 	}
 
+	// Resolve ports and interface names for every link end
+	links, err := allocatePorts(t.Links)
+	if err != nil {
+		return fmt.Errorf("allocate ports: %w", err)
+	}
+
+	// Tunnels need their underlay addresses, so build them last
+	sort.SliceStable(links, func(i, j int) bool {
+		return links[i].Type != LinkTunnel && links[j].Type == LinkTunnel
+	})
+
 	// Create links between nodes
-	for _, link := range t.Links {
-		if err := b.buildLink(nodeContainers, link); err != nil {
+	for _, link := range links {
+		var err error
+
+		switch link.Type {
+		case "", LinkVeth:
+			err = b.buildLink(nodeContainers, link)
+		case LinkBond:
+			err = b.buildBondLink(nodeContainers, link)
+		case LinkTunnel:
+			err = b.buildTunnelLink(nodeContainers, link)
+		default:
+			return fmt.Errorf("unknown link type: %s", link.Type)
+		}
+
+		if err != nil {
 			return fmt.Errorf("build link %s-%s: %w", link.NodeA, link.NodeB, err)
 		}
 	}
 
+	// Apply the sysctls that referred to link interfaces
+	for _, nodeName := range sortedNodeNames(t) {
+		if err := b.applyPendingSysctls(nodeContainers[nodeName], pendingSysctls[nodeName]); err != nil {
+			return fmt.Errorf("sysctls on %s: %w", nodeName, err)
+		}
+	}
+
+	// Mirror switch ports now that every port is attached
+	if err := b.setupMirrors(nodeContainers); err != nil {
+		return fmt.Errorf("mirror: %w", err)
+	}
+
+	// Start DHCP servers, then let DHCP hosts obtain their addresses
+	if err := b.startDHCPServers(nodeContainers); err != nil {
+		return fmt.Errorf("dhcp server: %w", err)
+	}
+	if err := b.runDHCPClients(nodeContainers); err != nil {
+		return fmt.Errorf("dhcp: %w", err)
+	}
+
+	// Wait until IPv6 addresses leave the tentative state
+	if t.IPv6.WaitDAD && !t.IPv6.DisableDAD {
+		if err := b.waitDAD(nodeContainers); err != nil {
+			return err
+		}
+	}
+
+	// Pre-populate neighbor tables now that every address is assigned
+	if b.options.StaticARP {
+		if err := b.installStaticARP(nodeContainers); err != nil {
+			return fmt.Errorf("static arp: %w", err)
+		}
+	}
+
+	// Install static routes
+	for _, route := range t.Routes {
+		if err := b.buildRoute(nodeContainers, route); err != nil {
+			return fmt.Errorf("route %s on %s: %w", route.Destination, route.Node, err)
+		}
+	}
+
+	// Configure NAT gateways now that every address is assigned
+	if err := b.setupNAT(nodeContainers); err != nil {
+		return fmt.Errorf("setup nat: %w", err)
+	}
+
+	// Start the lab DNS server last so it can sit behind the NAT node
+	if t.DNS != nil {
+		if err := b.startDNS(nodeContainers); err != nil {
+			return fmt.Errorf("dns: %w", err)
+		}
+	}
+
+	// Record the build duration on every node of the lab
+	buildTime := time.Since(start).Seconds()
+	for _, nodeName := range sortedNodeNames(t) {
+		container := nodeContainers[nodeName]
+		container.BuildTime = buildTime
+		if err := b.containerRepo.Save(container); err != nil {
+			return fmt.Errorf("save node %s: %w", nodeName, err)
+		}
+	}
+
 	fmt.Println("\n✓ Topology built successfully!")
 	return nil
 }
 
+// AddLink connects two nodes of an existing lab with a new veth link and
+// returns it with its ports and interface names resolved. Ports left at
+// zero continue after the highest port a node already uses.
+func (b *Builder) AddLink(link Link) (Link, error) {
+	if link.Type != "" && link.Type != LinkVeth {
+		return Link{}, fmt.Errorf("only veth links can be added to a running lab")
+	}
+
+	containers, err := b.cm.ListContainers()
+	if err != nil {
+		return Link{}, err
+	}
+
+	nodeContainers := make(map[string]*domain.Container)
+	for _, c := range containers {
+		if c.Name == link.NodeA || c.Name == link.NodeB {
+			nodeContainers[c.Name] = c
+		}
+	}
+	for _, name := range []string{link.NodeA, link.NodeB} {
+		if nodeContainers[name] == nil {
+			return Link{}, fmt.Errorf("node %s not found", name)
+		}
+	}
+	lab := nodeContainers[link.NodeA].Lab
+	if nodeContainers[link.NodeB].Lab != lab {
+		return Link{}, fmt.Errorf("%s and %s belong to different labs", link.NodeA, link.NodeB)
+	}
+
+	// Rebuild enough of the lab's topology for attachEnd and derived MACs
+	b.topology = NewTopology()
+	for _, c := range containers {
+		if c.Lab != lab {
+			continue
+		}
+		nodeType := NodeType(c.Type)
+		if nodeType == "" {
+			nodeType = NodeHost
+		}
+		b.topology.Nodes[c.Name] = Node{Name: c.Name, Type: nodeType}
+	}
+	b.nodeIndex = make(map[string]int)
+	for i, nodeName := range sortedNodeNames(b.topology) {
+		b.nodeIndex[nodeName] = i + 1
+	}
+
+	if link.PortA == 0 {
+		link.PortA = nextPort(nodeContainers[link.NodeA])
+	}
+	if link.PortB == 0 {
+		link.PortB = nextPort(nodeContainers[link.NodeB])
+		if link.NodeA == link.NodeB && link.PortB == link.PortA {
+			link.PortB++
+		}
+	}
+
+	links, err := allocatePorts([]Link{link})
+	if err != nil {
+		return Link{}, err
+	}
+
+	if err := b.buildLink(nodeContainers, links[0]); err != nil {
+		return Link{}, fmt.Errorf("build link %s-%s: %w", link.NodeA, link.NodeB, err)
+	}
+	return links[0], nil
+}
+
+// nextPort returns the port after the highest one a container's links use
+func nextPort(c *domain.Container) int {
+	highest := 0
+	for _, v := range c.Veths {
+		if domain.SameNamespace(v.NamespaceA, c.Namespace) && v.PortA > highest {
+			highest = v.PortA
+		}
+		if domain.SameNamespace(v.NamespaceB, c.Namespace) && v.PortB > highest {
+			highest = v.PortB
+		}
+	}
+	for _, bond := range c.Bonds {
+		if bond.Port > highest {
+			highest = bond.Port
+		}
+	}
+	for _, t := range c.Tunnels {
+		if t.Port > highest {
+			highest = t.Port
+		}
+	}
+	return highest + 1
+}
+
 // buildHost creates a container for a host node
 func (b *Builder) buildHost(name string) (*domain.Container, error) {
 	fmt.Printf("\n  Creating host '%s'...\n", name)
@@ -88,7 +352,7 @@ func (b *Builder) buildHost(name string) (*domain.Container, error) {
 }
 
 // buildSwitch creates a container for a switch node with a bridge
-func (b *Builder) buildSwitch(name string) (*domain.Container, error) {
+func (b *Builder) buildSwitch(name string, opts *SwitchOptions, externals []ExternalInterface) (*domain.Container, error) {
 	fmt.Printf("\n  Creating switch '%s'...\n", name)
 
 	// Create container
@@ -98,15 +362,694 @@ func (b *Builder) buildSwitch(name string) (*domain.Container, error) {
 	}
 
 	// Create bridge inside the switch container
-	bridge, err := b.cm.CreateBridgeToContainer(container, fmt.Sprintf("%s-br0", name))
+	bridge, err := b.cm.CreateBridgeToContainer(container, fmt.Sprintf("%s-br0", name), bridgeOptions(opts))
 	if err != nil {
 		return nil, fmt.Errorf("create bridge: %w", err)
 	}
 
+	// Attach interfaces from outside the lab to the bridge
+	for _, ext := range externals {
+		attached, err := domain.AttachExternalInterface(ext.Name, ext.IfName, ext.Mode, ext.Namespace, container.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("attach external interface %s: %w", ext.Name, err)
+		}
+
+		// Record it right away so teardown restores it even if the build fails later
+		container.Externals = append(container.Externals, *attached)
+		if err := b.containerRepo.Save(container); err != nil {
+			return nil, fmt.Errorf("save container: %w", err)
+		}
+
+		for i := range container.Bridges {
+			if err := container.Bridges[i].AttachInterfaceByName(attached.Name, nil); err != nil {
+				return nil, fmt.Errorf("attach %s to bridge: %w", attached.Name, err)
+			}
+		}
+		fmt.Printf("    External interface %s attached (%s)\n", attached.Name, attached.Mode)
+	}
+
 	fmt.Printf("  ✓ Switch '%s' created with bridge '%s'\n", name, bridge.Name)
 	return container, nil
 }
 
+// bridgeOptions converts switch options into domain bridge options
+func bridgeOptions(opts *SwitchOptions) domain.BridgeOptions {
+	if opts == nil {
+		return domain.BridgeOptions{}
+	}
+	return domain.BridgeOptions{
+		STP:           opts.STP,
+		ForwardDelay:  uint32(opts.ForwardDelay),
+		VLANFiltering: opts.VLANFiltering,
+		AgeingTime:    uint32(opts.AgeingTime),
+		IGMPSnooping:  opts.IGMPSnooping,
+	}
+}
+
+// portVLAN converts a link VLAN configuration into a domain port VLAN
+func portVLAN(vlan *VLAN) *domain.PortVLAN {
+	if vlan == nil {
+		return nil
+	}
+	return &domain.PortVLAN{
+		Access: vlan.Access,
+		Trunk:  vlan.Trunk,
+		Native: vlan.Native,
+	}
+}
+
+// applySysctls sets a node's sysctls and records them on the container.
+// Keys whose /proc/sys entry does not exist yet, typically per-interface
+// keys of link ends, are returned to be applied after the links are built.
+func (b *Builder) applySysctls(container *domain.Container, sysctls map[string]string) (map[string]string, error) {
+	if len(sysctls) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(sysctls))
+	for key := range sysctls {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pending := make(map[string]string)
+	for _, key := range keys {
+		err := container.SetSysctl(key, sysctls[key])
+		if errors.Is(err, fs.ErrNotExist) {
+			pending[key] = sysctls[key]
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("    Sysctl %s = %s\n", key, sysctls[key])
+	}
+
+	if err := b.containerRepo.Save(container); err != nil {
+		return nil, fmt.Errorf("save container: %w", err)
+	}
+
+	return pending, nil
+}
+
+// applyPendingSysctls sets the sysctls deferred by applySysctls; by now
+// every key has to exist
+func (b *Builder) applyPendingSysctls(container *domain.Container, sysctls map[string]string) error {
+	pending, err := b.applySysctls(container, sysctls)
+	if err != nil {
+		return err
+	}
+	for key := range pending {
+		return fmt.Errorf("unknown sysctl %s", key)
+	}
+	return nil
+}
+
+// setupMirrors installs the port mirrors configured on switch nodes
+func (b *Builder) setupMirrors(nodeContainers map[string]*domain.Container) error {
+	for _, nodeName := range sortedNodeNames(b.topology) {
+		for _, mirror := range b.topology.Nodes[nodeName].Mirrors {
+			m := domain.Mirror{
+				Name:      mirror.Name,
+				Sources:   mirror.Sources,
+				Monitor:   mirror.Monitor,
+				Direction: mirror.Direction,
+			}
+			if err := b.cm.AddMirror(nodeContainers[nodeName], m); err != nil {
+				return fmt.Errorf("%s on %s: %w", mirror.Name, nodeName, err)
+			}
+			fmt.Printf("  ✓ Mirror '%s' on %s: %s -> %s\n", mirror.Name, nodeName, strings.Join(mirror.Sources, ","), mirror.Monitor)
+		}
+	}
+	return nil
+}
+
+// startDHCPServers starts a DHCP server service inside every node
+// configured with one
+func (b *Builder) startDHCPServers(nodeContainers map[string]*domain.Container) error {
+	for _, name := range sortedNodeNames(b.topology) {
+		node := b.topology.Nodes[name]
+		if node.DHCPServer == nil {
+			continue
+		}
+		if node.Type != NodeHost {
+			return fmt.Errorf("%s: dhcp servers only run on hosts", name)
+		}
+
+		container := nodeContainers[name]
+		ifName, address := portAddress(container, node.DHCPServer.Interface)
+		if address == "" {
+			return fmt.Errorf("%s: dhcp server needs a link end with a static IPv4 address", name)
+		}
+
+		cfg := dhcp.ServerConfig{
+			Interface: ifName,
+			Address:   address,
+			PoolStart: node.DHCPServer.PoolStart,
+			PoolEnd:   node.DHCPServer.PoolEnd,
+			Router:    node.DHCPServer.Router,
+			DNS:       node.DHCPServer.DNS,
+			LeaseTime: node.DHCPServer.LeaseTime,
+		}
+		// Catch configuration errors here rather than in the service log
+		if _, err := dhcp.NewServer(cfg); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		config, err := json.Marshal(cfg)
+		if err != nil {
+			return fmt.Errorf("%s: encode config: %w", name, err)
+		}
+		service, err := container.StartService("dhcpd", string(config))
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if err := b.containerRepo.Save(container); err != nil {
+			return fmt.Errorf("save %s: %w", name, err)
+		}
+
+		fmt.Printf("  ✓ DHCP server on %s:%s serving %s-%s (pid %d)\n",
+			name, ifName, cfg.PoolStart, cfg.PoolEnd, service.PID)
+	}
+
+	return nil
+}
+
+// portAddress returns the interface a service listens on and its IPv4
+// address: the named interface, or the lowest numbered port with an IPv4
+// address
+func portAddress(container *domain.Container, ifName string) (string, string) {
+	best, bestPort, bestAddr := "", 0, ""
+	for _, v := range container.Veths {
+		for _, end := range []struct {
+			name  string
+			port  int
+			ns    *domain.Namespace
+			addrs []string
+		}{
+			{v.Name, v.PortA, v.NamespaceA, v.AddrsA},
+			{v.PeerName, v.PortB, v.NamespaceB, v.AddrsB},
+		} {
+			if !domain.SameNamespace(end.ns, container.Namespace) {
+				continue
+			}
+			if ifName != "" && end.name != ifName {
+				continue
+			}
+			addr := firstIPv4(end.addrs)
+			if addr == "" {
+				continue
+			}
+			if best == "" || end.port < bestPort {
+				best, bestPort, bestAddr = end.name, end.port, addr
+			}
+		}
+	}
+	return best, bestAddr
+}
+
+// firstIPv4 returns the first IPv4 CIDR in addrs
+func firstIPv4(addrs []string) string {
+	for _, addr := range addrs {
+		if ip, _, err := net.ParseCIDR(addr); err == nil && ip.To4() != nil {
+			return addr
+		}
+	}
+	return ""
+}
+
+// runDHCPClients obtains a lease for every link end of a DHCP host that
+// has no static IPv4 address, assigns it and installs the offered default
+// route
+func (b *Builder) runDHCPClients(nodeContainers map[string]*domain.Container) error {
+	for _, name := range sortedNodeNames(b.topology) {
+		node := b.topology.Nodes[name]
+		if !node.DHCP {
+			continue
+		}
+		if node.Type != NodeHost {
+			return fmt.Errorf("%s: dhcp is only supported on hosts", name)
+		}
+
+		container := nodeContainers[name]
+		for i := range container.Veths {
+			v := &container.Veths[i]
+			if domain.SameNamespace(v.NamespaceA, container.Namespace) && firstIPv4(v.AddrsA) == "" {
+				if err := b.acquireLease(container, v, v.Name); err != nil {
+					return fmt.Errorf("%s: %w", name, err)
+				}
+			}
+			if domain.SameNamespace(v.NamespaceB, container.Namespace) && firstIPv4(v.AddrsB) == "" {
+				if err := b.acquireLease(container, v, v.PeerName); err != nil {
+					return fmt.Errorf("%s: %w", name, err)
+				}
+			}
+		}
+	}
+
+	syncVethCopies(nodeContainers)
+	for _, name := range sortedNodeNames(b.topology) {
+		if err := b.containerRepo.Save(nodeContainers[name]); err != nil {
+			return fmt.Errorf("save %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// acquireLease runs the DHCP client on one veth end of a container and
+// records the lease
+func (b *Builder) acquireLease(container *domain.Container, veth *domain.Veth, ifName string) error {
+	if err := domain.SetLinkUp(ifName, container.Namespace); err != nil {
+		return err
+	}
+	mac, err := domain.HardwareAddr(ifName, container.Namespace)
+	if err != nil {
+		return err
+	}
+
+	var lease *dhcp.Lease
+	err = container.Namespace.Run(func() error {
+		var err error
+		lease, err = dhcp.Acquire(ifName, mac, dhcpTimeout)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := veth.AssignIP(ifName, lease.Address, container.Namespace); err != nil {
+		return fmt.Errorf("assign leased address: %w", err)
+	}
+
+	record := domain.DHCPLease{
+		Interface:  ifName,
+		Address:    lease.Address,
+		Server:     lease.Server.String(),
+		LeaseTime:  int(lease.LeaseTime / time.Second),
+		ObtainedAt: time.Now().Format(time.RFC3339),
+	}
+	for _, dns := range lease.DNS {
+		record.DNS = append(record.DNS, dns.String())
+	}
+	if lease.Router != nil {
+		record.Router = lease.Router.String()
+	}
+	container.Leases = append(container.Leases, record)
+	fmt.Printf("    DHCP lease %s on %s:%s from %s\n", lease.Address, container.Name, ifName, record.Server)
+
+	if lease.Router != nil && !container.HasDefaultRoute(lease.Router) {
+		route := domain.Route{Destination: "default", Gateway: record.Router}
+		if err := container.AddRoute(route); err != nil {
+			return fmt.Errorf("default route via %s: %w", record.Router, err)
+		}
+		fmt.Printf("    Default route via %s installed on %s\n", record.Router, container.Name)
+	}
+
+	return nil
+}
+
+// startDNS starts the lab DNS server on its node and points every host's
+// resolv.conf at it
+func (b *Builder) startDNS(nodeContainers map[string]*domain.Container) error {
+	opts := *b.topology.DNS
+	if opts.Domain == "" {
+		opts.Domain = defaultDNSDomain
+	}
+
+	name := opts.Node
+	if name == "" {
+		for _, n := range sortedNodeNames(b.topology) {
+			if b.topology.Nodes[n].Type == NodeNAT {
+				name = n
+				break
+			}
+		}
+	}
+	if name == "" {
+		return fmt.Errorf("no dns node given and the topology has no nat node")
+	}
+
+	container := nodeContainers[name]
+	var address string
+	switch b.topology.Nodes[name].Type {
+	case NodeNAT:
+		if container.NAT != nil {
+			address = container.NAT.Gateway().String()
+		}
+	case NodeHost:
+		if _, cidr := portAddress(container, ""); cidr != "" {
+			ip, _, _ := net.ParseCIDR(cidr)
+			address = ip.String()
+		}
+	default:
+		return fmt.Errorf("%s: dns only runs on hosts and nat nodes", name)
+	}
+	if address == "" {
+		return fmt.Errorf("%s has no IPv4 address to serve dns on", name)
+	}
+
+	cfg := dns.ServerConfig{
+		Address: address,
+		Lab:     b.topology.LabName(),
+		Domain:  opts.Domain,
+		Forward: opts.Forward,
+	}
+	config, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("encode config: %w", err)
+	}
+	service, err := container.StartService("dns", string(config))
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if err := b.containerRepo.Save(container); err != nil {
+		return fmt.Errorf("save %s: %w", name, err)
+	}
+	fmt.Printf("  ✓ DNS server for .%s on %s (%s, pid %d)\n", opts.Domain, name, address, service.PID)
+
+	resolver := domain.Resolver{Nameservers: []string{address}, Search: []string{opts.Domain}}
+	for _, n := range sortedNodeNames(b.topology) {
+		host := nodeContainers[n]
+		if b.topology.Nodes[n].Type != NodeHost {
+			continue
+		}
+		if err := host.SetResolver(resolver); err != nil {
+			return fmt.Errorf("resolv.conf on %s: %w", n, err)
+		}
+		if err := b.containerRepo.Save(host); err != nil {
+			return fmt.Errorf("save %s: %w", n, err)
+		}
+	}
+
+	return nil
+}
+
+// mac returns the derived MAC address of a link end, or nil when MACs are
+// left to the kernel
+func (b *Builder) mac(node string, port int) net.HardwareAddr {
+	if !b.options.AutoSetMACs {
+		return nil
+	}
+	return domain.DeriveMAC(b.nodeIndex[node], port)
+}
+
+// neighborEnd is an addressed host interface taking part in static ARP
+type neighborEnd struct {
+	node   string
+	ifName string
+	addrs  []string
+	mac    net.HardwareAddr
+	add    func(ip net.IP, mac net.HardwareAddr) error
+}
+
+// installStaticARP installs a permanent neighbor entry on every host
+// interface for each address of another host in the same subnet
+func (b *Builder) installStaticARP(nodeContainers map[string]*domain.Container) error {
+	var ends []neighborEnd
+	for _, name := range sortedNodeNames(b.topology) {
+		if b.topology.Nodes[name].Type != NodeHost {
+			continue
+		}
+		hostEnds, err := hostNeighborEnds(name, nodeContainers[name])
+		if err != nil {
+			return err
+		}
+		ends = append(ends, hostEnds...)
+	}
+
+	fmt.Println("  Installing static neighbor entries...")
+	for _, local := range ends {
+		installed := 0
+		for _, remote := range ends {
+			if remote.node == local.node {
+				continue
+			}
+			for _, addr := range remote.addrs {
+				ip, _, err := net.ParseCIDR(addr)
+				if err != nil || !onLink(local.addrs, ip) {
+					continue
+				}
+				if err := local.add(ip, remote.mac); err != nil {
+					return fmt.Errorf("%s: %w", local.node, err)
+				}
+				installed++
+			}
+		}
+		if installed > 0 {
+			fmt.Printf("    %d entries on %s:%s\n", installed, local.node, local.ifName)
+		}
+	}
+
+	syncVethCopies(nodeContainers)
+	for _, name := range sortedNodeNames(b.topology) {
+		if err := b.containerRepo.Save(nodeContainers[name]); err != nil {
+			return fmt.Errorf("save %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// hostNeighborEnds returns the addressed Ethernet interfaces of a host:
+// its veth ends, bonds and VLAN sub-interfaces
+func hostNeighborEnds(node string, c *domain.Container) ([]neighborEnd, error) {
+	var ends []neighborEnd
+	appendEnd := func(ifName string, addrs []string, add func(net.IP, net.HardwareAddr) error) error {
+		if len(addrs) == 0 {
+			return nil
+		}
+		mac, err := domain.HardwareAddr(ifName, c.Namespace)
+		if err != nil {
+			return fmt.Errorf("%s: %w", node, err)
+		}
+		ends = append(ends, neighborEnd{node: node, ifName: ifName, addrs: addrs, mac: mac, add: add})
+		return nil
+	}
+
+	for i := range c.Veths {
+		v := &c.Veths[i]
+		if domain.SameNamespace(v.NamespaceA, c.Namespace) {
+			if err := appendEnd(v.Name, v.AddrsA, func(ip net.IP, mac net.HardwareAddr) error {
+				return v.AddNeighbor(v.Name, c.Namespace, ip, mac)
+			}); err != nil {
+				return nil, err
+			}
+		}
+		if domain.SameNamespace(v.NamespaceB, c.Namespace) {
+			if err := appendEnd(v.PeerName, v.AddrsB, func(ip net.IP, mac net.HardwareAddr) error {
+				return v.AddNeighbor(v.PeerName, c.Namespace, ip, mac)
+			}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for i := range c.Bonds {
+		bond := &c.Bonds[i]
+		if err := appendEnd(bond.Name, bond.Addrs, bond.AddNeighbor); err != nil {
+			return nil, err
+		}
+	}
+	for i := range c.VLANs {
+		vlan := &c.VLANs[i]
+		if err := appendEnd(vlan.Name, vlan.Addrs, vlan.AddNeighbor); err != nil {
+			return nil, err
+		}
+	}
+
+	return ends, nil
+}
+
+// onLink reports whether ip falls inside the subnet of one of addrs
+func onLink(addrs []string, ip net.IP) bool {
+	for _, addr := range addrs {
+		_, subnet, err := net.ParseCIDR(addr)
+		if err == nil && subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// syncVethCopies copies the addresses and neighbor entries of every veth
+// end from the container owning that end to the other container recording
+// the same pair
+func syncVethCopies(nodeContainers map[string]*domain.Container) {
+	type key struct{ name, namespace string }
+	keyOf := func(v *domain.Veth) key {
+		if v.NamespaceA == nil {
+			return key{name: v.Name}
+		}
+		return key{v.Name, v.NamespaceA.Path}
+	}
+
+	endsA := make(map[key]domain.Veth)
+	endsB := make(map[key]domain.Veth)
+	for _, c := range nodeContainers {
+		for i := range c.Veths {
+			v := &c.Veths[i]
+			if domain.SameNamespace(v.NamespaceA, c.Namespace) {
+				endsA[keyOf(v)] = *v
+			}
+			if domain.SameNamespace(v.NamespaceB, c.Namespace) {
+				endsB[keyOf(v)] = *v
+			}
+		}
+	}
+
+	for _, c := range nodeContainers {
+		for i := range c.Veths {
+			v := &c.Veths[i]
+			if owner, ok := endsA[keyOf(v)]; ok {
+				v.AddrsA, v.NeighborsA = owner.AddrsA, owner.NeighborsA
+			}
+			if owner, ok := endsB[keyOf(v)]; ok {
+				v.AddrsB, v.NeighborsB = owner.AddrsB, owner.NeighborsB
+			}
+		}
+	}
+}
+
+// waitDAD waits for duplicate address detection to finish on every node
+func (b *Builder) waitDAD(nodeContainers map[string]*domain.Container) error {
+	timeout := time.Duration(b.topology.IPv6.DADTimeout) * time.Second
+	if timeout == 0 {
+		timeout = defaultDADTimeout
+	}
+
+	fmt.Println("  Waiting for IPv6 duplicate address detection...")
+	for _, name := range sortedNodeNames(b.topology) {
+		container := nodeContainers[name]
+		if container.Namespace == nil {
+			continue
+		}
+		if err := domain.WaitDAD(container.Namespace, timeout); err != nil {
+			return fmt.Errorf("dad on %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// buildRoute installs a static route on a node and records it
+func (b *Builder) buildRoute(nodeContainers map[string]*domain.Container, route Route) error {
+	container := nodeContainers[route.Node]
+	if container == nil {
+		return fmt.Errorf("unknown node %s", route.Node)
+	}
+
+	r := domain.Route{Destination: route.Destination, Gateway: route.Gateway, Device: route.Device}
+	if err := container.AddRoute(r); err != nil {
+		return err
+	}
+	if err := b.containerRepo.Save(container); err != nil {
+		return fmt.Errorf("save container: %w", err)
+	}
+
+	fmt.Printf("    Route %s installed on %s\n", r, route.Node)
+	return nil
+}
+
+// buildNATNode records a NAT node. It has no namespace of its own: its link
+// end stays in the root namespace.
+func (b *Builder) buildNATNode(name string) (*domain.Container, error) {
+	fmt.Printf("\n  Creating NAT '%s'...\n", name)
+
+	container := domain.NewContainer(name, false)
+	if err := b.containerRepo.Save(container); err != nil {
+		return nil, fmt.Errorf("save container: %w", err)
+	}
+
+	fmt.Printf("  ✓ NAT '%s' created\n", name)
+	return container, nil
+}
+
+// setupNAT enables masquerading for every NAT node and installs a default
+// route through it on hosts sharing its subnet
+func (b *Builder) setupNAT(nodeContainers map[string]*domain.Container) error {
+	for _, name := range sortedNodeNames(b.topology) {
+		node := b.topology.Nodes[name]
+		if node.Type != NodeNAT {
+			continue
+		}
+
+		container := nodeContainers[name]
+		ifName, address := natEnd(container)
+		if address == "" {
+			return fmt.Errorf("nat %s needs a link with an address on its end", name)
+		}
+
+		nat, err := domain.SetupNAT(ifName, address)
+		if err != nil {
+			return fmt.Errorf("nat %s: %w", name, err)
+		}
+		container.NAT = nat
+		if err := b.containerRepo.Save(container); err != nil {
+			return fmt.Errorf("save nat %s: %w", name, err)
+		}
+		fmt.Printf("  ✓ NAT %s masquerading %s via %s\n", name, nat.Subnet, ifName)
+
+		_, subnet, _ := net.ParseCIDR(nat.Subnet)
+		gateway := nat.Gateway()
+
+		for _, hostName := range sortedNodeNames(b.topology) {
+			if b.topology.Nodes[hostName].Type != NodeHost {
+				continue
+			}
+
+			host := nodeContainers[hostName]
+			if host.HasDefaultRoute(gateway) || !hasAddressIn(host, subnet) {
+				continue
+			}
+
+			route := domain.Route{Destination: "default", Gateway: gateway.String()}
+			if err := host.AddRoute(route); err != nil {
+				return fmt.Errorf("default route on %s: %w", hostName, err)
+			}
+			if err := b.containerRepo.Save(host); err != nil {
+				return fmt.Errorf("save %s: %w", hostName, err)
+			}
+			fmt.Printf("    Default route via %s installed on %s\n", gateway, hostName)
+		}
+	}
+
+	return nil
+}
+
+// natEnd returns the root namespace interface of a NAT node and its address
+func natEnd(container *domain.Container) (string, string) {
+	for _, v := range container.Veths {
+		if v.NamespaceA == nil && len(v.AddrsA) > 0 {
+			return v.Name, v.AddrsA[0]
+		}
+		if v.NamespaceB == nil && len(v.AddrsB) > 0 {
+			return v.PeerName, v.AddrsB[0]
+		}
+	}
+	return "", ""
+}
+
+// hasAddressIn reports whether the container has an address inside subnet
+func hasAddressIn(container *domain.Container, subnet *net.IPNet) bool {
+	for _, addr := range container.Addresses() {
+		ip, _, err := net.ParseCIDR(addr)
+		if err == nil && subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedNodeNames returns the topology's node names in a stable order
+func sortedNodeNames(t *Topology) []string {
+	names := make([]string, 0, len(t.Nodes))
+	for name := range t.Nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // buildLink creates a veth pair connecting two nodes
 func (b *Builder) buildLink(nodeContainers map[string]*domain.Container, link Link) error {
 	containerA := nodeContainers[link.NodeA]
@@ -116,27 +1059,61 @@ func (b *Builder) buildLink(nodeContainers map[string]*domain.Container, link Li
 		return fmt.Errorf("missing container for link %s-%s", link.NodeA, link.NodeB)
 	}
 
-	// Generate interface names
-	ifNameA := fmt.Sprintf("veth-%s-%s", link.NodeA, link.NodeB)
+	fmt.Printf("  Creating link %s:%s <--> %s:%s\n", link.NodeA, link.IfNameA, link.NodeB, link.IfNameB)
 
-	fmt.Printf("  Creating link %s <--> %s\n", link.NodeA, link.NodeB)
-
-	// Create veth pair connecting both containers
-	veth, err := containerA.AddVeth(containerA.Namespace, containerB.Namespace, ifNameA)
+	// Create veth pair with each end directly inside its container
+	veth, err := domain.CreateVethPair(
+		domain.VethEnd{Name: link.IfNameA, Port: link.PortA, Namespace: containerA.Namespace, MAC: b.mac(link.NodeA, link.PortA), MTU: link.MTU},
+		domain.VethEnd{Name: link.IfNameB, Port: link.PortB, Namespace: containerB.Namespace, MAC: b.mac(link.NodeB, link.PortB), MTU: link.MTU},
+	)
 	if err != nil {
 		return fmt.Errorf("create veth pair: %w", err)
 	}
 
-	// Move each veth end to its target namespace
-	if err := veth.MoveEndToNamespace(veth.Name, containerA.Namespace); err != nil {
-		return fmt.Errorf("move veth name end: %w", err)
+	// Delay the traffic leaving each end
+	if link.Delay != "" {
+		delay, err := time.ParseDuration(link.Delay)
+		if err != nil {
+			return fmt.Errorf("parse delay %q: %w", link.Delay, err)
+		}
+		if err := domain.SetLinkDelay(veth.Name, delay, containerA.Namespace); err != nil {
+			return err
+		}
+		if err := domain.SetLinkDelay(veth.PeerName, delay, containerB.Namespace); err != nil {
+			return err
+		}
+		veth.Delay = link.Delay
+		fmt.Printf("    Delay %s on both ends\n", link.Delay)
+	}
+
+	nodeA := b.getNodeByName(link.NodeA)
+	nodeB := b.getNodeByName(link.NodeB)
+
+	// Attach switch ends to bridges and assign host addresses
+	if err := b.attachEnd(containerA, nodeA, veth.Name, link.VLANA, []string{link.IPA, link.IP6A}, func(ip string) error {
+		return veth.AssignIP(veth.Name, ip, containerA.Namespace)
+	}); err != nil {
+		return err
+	}
+	if err := b.attachEnd(containerB, nodeB, veth.PeerName, link.VLANB, []string{link.IPB, link.IP6B}, func(ip string) error {
+		return veth.AssignIP(veth.PeerName, ip, containerB.Namespace)
+	}); err != nil {
+		return err
+	}
+
+	// Create VLAN sub-interfaces on top of the link ends
+	if err := b.buildSubInterfaces(containerA, nodeA, veth.Name, link.SubInterfacesA); err != nil {
+		return fmt.Errorf("sub-interfaces on %s: %w", link.NodeA, err)
 	}
-	if err := veth.MoveEndToNamespace(veth.PeerName, containerB.Namespace); err != nil {
-		return fmt.Errorf("move veth peer end: %w", err)
+	if err := b.buildSubInterfaces(containerB, nodeB, veth.PeerName, link.SubInterfacesB); err != nil {
+		return fmt.Errorf("sub-interfaces on %s: %w", link.NodeB, err)
 	}
 
-	// Also add to containerB's veths
-	containerB.Veths = append(containerB.Veths, *veth)
+	// Record the fully configured veth on both containers
+	containerA.Veths = append(containerA.Veths, *veth)
+	if containerB != containerA {
+		containerB.Veths = append(containerB.Veths, *veth)
+	}
 
 	// Save both containers
 	if err := b.containerRepo.Save(containerA); err != nil {
@@ -146,50 +1123,372 @@ func (b *Builder) buildLink(nodeContainers map[string]*domain.Container, link Li
 		return fmt.Errorf("save container B: %w", err)
 	}
 
-	// Now attach to bridges if needed (veths are already in namespaces)
-	// If node B is a switch, attach the peer end to its bridge
-	nodeB := b.getNodeByName(link.NodeB)
-	if nodeB != nil && nodeB.Type == NodeSwitch {
-		// Find the bridge in containerB
-		for i := range containerB.Bridges {
-			bridge := &containerB.Bridges[i]
-			if err := bridge.AttachInterfaceByName(veth.PeerName); err != nil {
-				return fmt.Errorf("attach peer to bridge: %w", err)
+	fmt.Printf("  ✓ Link created: %s <--> %s\n", link.NodeA, link.NodeB)
+	return nil
+}
+
+// buildBondLink creates the member veth pairs of a bonded link and
+// aggregates them with a bond device on each end
+func (b *Builder) buildBondLink(nodeContainers map[string]*domain.Container, link Link) error {
+	containerA := nodeContainers[link.NodeA]
+	containerB := nodeContainers[link.NodeB]
+
+	if containerA == nil || containerB == nil {
+		return fmt.Errorf("missing container for link %s-%s", link.NodeA, link.NodeB)
+	}
+
+	opts := BondOptions{}
+	if link.Bond != nil {
+		opts = *link.Bond
+	}
+	if opts.Members == 0 {
+		opts.Members = 2
+	}
+	if opts.Mode == "" {
+		opts.Mode = "active-backup"
+	}
+
+	fmt.Printf("  Creating %s bond %s:%s <--> %s:%s (%d members)\n",
+		opts.Mode, link.NodeA, link.IfNameA, link.NodeB, link.IfNameB, opts.Members)
+
+	bondA, err := domain.CreateBond(link.IfNameA, opts.Mode, opts.HashPolicy, containerA.Namespace)
+	if err != nil {
+		return fmt.Errorf("create bond on %s: %w", link.NodeA, err)
+	}
+	bondB, err := domain.CreateBond(link.IfNameB, opts.Mode, opts.HashPolicy, containerB.Namespace)
+	if err != nil {
+		return fmt.Errorf("create bond on %s: %w", link.NodeB, err)
+	}
+
+	bondA.Port, bondA.Peer = link.PortA, link.NodeB+":"+link.IfNameB
+	bondB.Port, bondB.Peer = link.PortB, link.NodeA+":"+link.IfNameA
+
+	// Members take over the bond's MTU when enslaved
+	if link.MTU > 0 {
+		if err := bondA.SetMTU(link.MTU); err != nil {
+			return fmt.Errorf("bond on %s: %w", link.NodeA, err)
+		}
+		if err := bondB.SetMTU(link.MTU); err != nil {
+			return fmt.Errorf("bond on %s: %w", link.NodeB, err)
+		}
+	}
+
+	// Members take over the bond's address, so only the bonds get one
+	if mac := b.mac(link.NodeA, link.PortA); mac != nil {
+		if err := bondA.SetHardwareAddr(mac); err != nil {
+			return fmt.Errorf("bond on %s: %w", link.NodeA, err)
+		}
+	}
+	if mac := b.mac(link.NodeB, link.PortB); mac != nil {
+		if err := bondB.SetHardwareAddr(mac); err != nil {
+			return fmt.Errorf("bond on %s: %w", link.NodeB, err)
+		}
+	}
+
+	// Create member veth pairs and enslave each end to its bond
+	for i := 0; i < opts.Members; i++ {
+		memberA := fmt.Sprintf("%s-%d", bondA.Name, i)
+		memberB := fmt.Sprintf("%s-%d", bondB.Name, i)
+		for _, name := range []string{memberA, memberB} {
+			if len(name) > maxIfNameLen {
+				return fmt.Errorf("bond member name %q is longer than %d characters", name, maxIfNameLen)
 			}
 		}
+
+		veth, err := domain.CreateVethPair(
+			domain.VethEnd{Name: memberA, Namespace: containerA.Namespace},
+			domain.VethEnd{Name: memberB, Namespace: containerB.Namespace},
+		)
+		if err != nil {
+			return fmt.Errorf("create bond member %d: %w", i, err)
+		}
+
+		if err := bondA.Enslave(veth.Name); err != nil {
+			return fmt.Errorf("enslave on %s: %w", link.NodeA, err)
+		}
+		if err := bondB.Enslave(veth.PeerName); err != nil {
+			return fmt.Errorf("enslave on %s: %w", link.NodeB, err)
+		}
+
+		containerA.Veths = append(containerA.Veths, *veth)
+		if containerB != containerA {
+			containerB.Veths = append(containerB.Veths, *veth)
+		}
 	}
 
-	// If node A is a switch, attach the name end to its bridge
 	nodeA := b.getNodeByName(link.NodeA)
-	if nodeA != nil && nodeA.Type == NodeSwitch {
-		// Find the bridge in containerA
-		for i := range containerA.Bridges {
-			bridge := &containerA.Bridges[i]
-			if err := bridge.AttachInterfaceByName(veth.Name); err != nil {
-				return fmt.Errorf("attach name to bridge: %w", err)
-			}
+	nodeB := b.getNodeByName(link.NodeB)
+
+	// Attach switch ends to bridges and assign host addresses
+	if err := b.attachEnd(containerA, nodeA, bondA.Name, link.VLANA, []string{link.IPA, link.IP6A}, bondA.AssignIP); err != nil {
+		return err
+	}
+	if err := b.attachEnd(containerB, nodeB, bondB.Name, link.VLANB, []string{link.IPB, link.IP6B}, bondB.AssignIP); err != nil {
+		return err
+	}
+
+	// Create VLAN sub-interfaces on top of the bonds
+	if err := b.buildSubInterfaces(containerA, nodeA, bondA.Name, link.SubInterfacesA); err != nil {
+		return fmt.Errorf("sub-interfaces on %s: %w", link.NodeA, err)
+	}
+	if err := b.buildSubInterfaces(containerB, nodeB, bondB.Name, link.SubInterfacesB); err != nil {
+		return fmt.Errorf("sub-interfaces on %s: %w", link.NodeB, err)
+	}
+
+	containerA.Bonds = append(containerA.Bonds, *bondA)
+	containerB.Bonds = append(containerB.Bonds, *bondB)
+
+	// Save both containers
+	if err := b.containerRepo.Save(containerA); err != nil {
+		return fmt.Errorf("save container A: %w", err)
+	}
+	if err := b.containerRepo.Save(containerB); err != nil {
+		return fmt.Errorf("save container B: %w", err)
+	}
+
+	fmt.Printf("  ✓ Bond created: %s <--> %s\n", link.NodeA, link.NodeB)
+	return nil
+}
+
+// buildTunnelLink creates a tunnel device on each node pointing at the
+// other node's underlay address
+func (b *Builder) buildTunnelLink(nodeContainers map[string]*domain.Container, link Link) error {
+	containerA := nodeContainers[link.NodeA]
+	containerB := nodeContainers[link.NodeB]
+
+	if containerA == nil || containerB == nil {
+		return fmt.Errorf("missing container for link %s-%s", link.NodeA, link.NodeB)
+	}
+	if link.Tunnel == nil {
+		return fmt.Errorf("tunnel link without tunnel options")
+	}
+
+	opts := *link.Tunnel
+	if opts.MTU == 0 {
+		opts.MTU = link.MTU
+	}
+	if opts.LocalA == "" || opts.LocalB == "" {
+		return fmt.Errorf("tunnel link requires underlay addresses on both nodes")
+	}
+
+	nodeA := b.getNodeByName(link.NodeA)
+	nodeB := b.getNodeByName(link.NodeB)
+
+	// Only VXLAN carries Ethernet frames that a bridge can forward
+	for _, node := range []*Node{nodeA, nodeB} {
+		if node != nil && node.Type == NodeSwitch && opts.Kind != domain.TunnelVXLAN {
+			return fmt.Errorf("%s tunnels cannot be attached to switch %s", opts.Kind, node.Name)
 		}
 	}
 
-	// Assign IP addresses if provided and node is a host
-	if link.IPA != "" && nodeA != nil && nodeA.Type == NodeHost {
-		if err := veth.AssignIP(veth.Name, link.IPA, containerA.Namespace); err != nil {
-			return fmt.Errorf("assign IP to %s: %w", link.NodeA, err)
+	fmt.Printf("  Creating %s tunnel %s:%s <--> %s:%s over %s <--> %s\n",
+		opts.Kind, link.NodeA, link.IfNameA, link.NodeB, link.IfNameB, opts.LocalA, opts.LocalB)
+
+	tunnelA, err := domain.CreateTunnel(domain.TunnelConfig{
+		Name:    link.IfNameA,
+		Kind:    opts.Kind,
+		Local:   opts.LocalA,
+		Remote:  opts.LocalB,
+		VNI:     opts.VNI,
+		Key:     opts.Key,
+		UDPPort: opts.UDPPort,
+		MTU:     opts.MTU,
+	}, containerA.Namespace)
+	if err != nil {
+		return fmt.Errorf("create tunnel on %s: %w", link.NodeA, err)
+	}
+
+	tunnelB, err := domain.CreateTunnel(domain.TunnelConfig{
+		Name:    link.IfNameB,
+		Kind:    opts.Kind,
+		Local:   opts.LocalB,
+		Remote:  opts.LocalA,
+		VNI:     opts.VNI,
+		Key:     opts.Key,
+		UDPPort: opts.UDPPort,
+		MTU:     opts.MTU,
+	}, containerB.Namespace)
+	if err != nil {
+		return fmt.Errorf("create tunnel on %s: %w", link.NodeB, err)
+	}
+
+	tunnelA.Port, tunnelA.Peer = link.PortA, link.NodeB+":"+link.IfNameB
+	tunnelB.Port, tunnelB.Peer = link.PortB, link.NodeA+":"+link.IfNameA
+
+	// Attach switch ends to bridges and assign host addresses
+	if err := b.attachEnd(containerA, nodeA, tunnelA.Name, link.VLANA, []string{link.IPA, link.IP6A}, tunnelA.AssignIP); err != nil {
+		return err
+	}
+	if err := b.attachEnd(containerB, nodeB, tunnelB.Name, link.VLANB, []string{link.IPB, link.IP6B}, tunnelB.AssignIP); err != nil {
+		return err
+	}
+
+	containerA.Tunnels = append(containerA.Tunnels, *tunnelA)
+	containerB.Tunnels = append(containerB.Tunnels, *tunnelB)
+
+	// Save both containers
+	if err := b.containerRepo.Save(containerA); err != nil {
+		return fmt.Errorf("save container A: %w", err)
+	}
+	if err := b.containerRepo.Save(containerB); err != nil {
+		return fmt.Errorf("save container B: %w", err)
+	}
+
+	fmt.Printf("  ✓ Tunnel created: %s <--> %s (mtu %d)\n", link.NodeA, link.NodeB, tunnelA.MTU)
+	return nil
+}
+
+// attachEnd attaches a link end to the node's bridges when the node is a
+// switch, or assigns its address when the node is a host
+func (b *Builder) attachEnd(container *domain.Container, node *Node, ifName string, vlan *VLAN, ips []string, assignIP func(string) error) error {
+	if node == nil {
+		return nil
+	}
+
+	switch node.Type {
+	case NodeSwitch:
+		for i := range container.Bridges {
+			bridge := &container.Bridges[i]
+			if err := bridge.AttachInterfaceByName(ifName, portVLAN(vlan)); err != nil {
+				return fmt.Errorf("attach %s to bridge: %w", ifName, err)
+			}
+		}
+	case NodeHost, NodeNAT:
+		// Unaddressed ends still carry traffic, e.g. on a monitor host
+		if err := domain.SetLinkUp(ifName, container.Namespace); err != nil {
+			return err
 		}
-		fmt.Printf("    IP %s assigned to %s\n", link.IPA, link.NodeA)
+		for _, ip := range ips {
+			if ip == "" {
+				continue
+			}
+			if err := assignIP(ip); err != nil {
+				return fmt.Errorf("assign IP to %s: %w", node.Name, err)
+			}
+			fmt.Printf("    IP %s assigned to %s\n", ip, node.Name)
+		}
+	}
+
+	return nil
+}
+
+// buildSubInterfaces creates 802.1Q sub-interfaces on a host interface and
+// assigns their addresses
+func (b *Builder) buildSubInterfaces(container *domain.Container, node *Node, parent string, subs []SubInterface) error {
+	if len(subs) == 0 {
+		return nil
+	}
+	if node == nil || node.Type != NodeHost {
+		return fmt.Errorf("sub-interfaces are only supported on hosts")
 	}
 
-	if link.IPB != "" && nodeB != nil && nodeB.Type == NodeHost {
-		if err := veth.AssignIP(veth.PeerName, link.IPB, containerB.Namespace); err != nil {
-			return fmt.Errorf("assign IP to %s: %w", link.NodeB, err)
+	for _, sub := range subs {
+		vlan, err := container.AddVLANInterface(parent, sub.VLAN)
+		if err != nil {
+			return err
+		}
+
+		for _, ip := range []string{sub.IP, sub.IP6} {
+			if ip == "" {
+				continue
+			}
+			if err := vlan.AssignIP(ip); err != nil {
+				return fmt.Errorf("assign IP to %s: %w", vlan.Name, err)
+			}
 		}
-		fmt.Printf("    IP %s assigned to %s\n", link.IPB, link.NodeB)
+		fmt.Printf("    Sub-interface %s created on %s\n", vlan.Name, container.Name)
 	}
 
-	fmt.Printf("  ✓ Link created: %s <--> %s\n", link.NodeA, link.NodeB)
 	return nil
 }
 
+// allocatePorts resolves the port number and interface name of every link
+// end. Explicit ports are reserved first so automatically assigned ports
+// never collide with them, which also allows parallel links between the
+// same pair of nodes.
+func allocatePorts(links []Link) ([]Link, error) {
+	used := make(map[string]map[int]bool)
+	reserve := func(node string, port int) error {
+		if used[node] == nil {
+			used[node] = make(map[int]bool)
+		}
+		if used[node][port] {
+			return fmt.Errorf("port %d on %s is used by more than one link", port, node)
+		}
+		used[node][port] = true
+		return nil
+	}
+
+	for _, link := range links {
+		if link.PortA < 0 || link.PortB < 0 {
+			return nil, fmt.Errorf("link %s-%s: negative port number", link.NodeA, link.NodeB)
+		}
+		if link.PortA > 0 {
+			if err := reserve(link.NodeA, link.PortA); err != nil {
+				return nil, err
+			}
+		}
+		if link.PortB > 0 {
+			if err := reserve(link.NodeB, link.PortB); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	next := func(node string) int {
+		port := 1
+		for used[node][port] {
+			port++
+		}
+		reserve(node, port)
+		return port
+	}
+
+	resolved := make([]Link, len(links))
+	ifNames := make(map[string]map[string]bool)
+	for i, link := range links {
+		if link.PortA == 0 {
+			link.PortA = next(link.NodeA)
+		}
+		if link.PortB == 0 {
+			link.PortB = next(link.NodeB)
+		}
+		prefix := "eth"
+		if link.Type == LinkBond {
+			prefix = "bond"
+		}
+		if link.Type == LinkTunnel && link.Tunnel != nil {
+			prefix = link.Tunnel.Kind
+		}
+		if link.IfNameA == "" {
+			link.IfNameA = fmt.Sprintf("%s-%s%d", link.NodeA, prefix, link.PortA)
+		}
+		if link.IfNameB == "" {
+			link.IfNameB = fmt.Sprintf("%s-%s%d", link.NodeB, prefix, link.PortB)
+		}
+
+		for _, end := range []struct{ node, ifName string }{
+			{link.NodeA, link.IfNameA},
+			{link.NodeB, link.IfNameB},
+		} {
+			if len(end.ifName) > maxIfNameLen {
+				return nil, fmt.Errorf("interface name %q on %s is longer than %d characters", end.ifName, end.node, maxIfNameLen)
+			}
+			if ifNames[end.node] == nil {
+				ifNames[end.node] = make(map[string]bool)
+			}
+			if ifNames[end.node][end.ifName] {
+				return nil, fmt.Errorf("interface %s on %s is used by more than one link", end.ifName, end.node)
+			}
+			ifNames[end.node][end.ifName] = true
+		}
+
+		resolved[i] = link
+	}
+
+	return resolved, nil
+}
+
 // getNodeByName helper to retrieve a node from topology
 func (b *Builder) getNodeByName(name string) *Node {
 	// This is a temporary implementation - in a real scenario, topology would be stored in Builder
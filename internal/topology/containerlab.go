@@ -0,0 +1,511 @@
+package topology
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultContainerlabImage is the image exported hosts run under containerlab
+const DefaultContainerlabImage = "alpine:latest"
+
+// clabSpecialNodes are endpoint node names containerlab reserves for
+// interfaces outside the lab's containers
+var clabSpecialNodes = map[string]bool{"host": true, "mgmt-net": true, "macvlan": true}
+
+// clabIgnoredKeys are node keys dropped without a warning: every namespace
+// node is the same plain Linux host whatever its image
+var clabIgnoredKeys = map[string]bool{"kind": true, "image": true, "labels": true, "group": true, "exec": true, "sysctls": true}
+
+// forwardingSysctls enable routing on a node
+var forwardingSysctls = map[string]string{"net.ipv4.ip_forward": "1", "net.ipv6.conf.all.forwarding": "1"}
+
+type clabFile struct {
+	Name     string `yaml:"name"`
+	Topology struct {
+		Defaults map[string]any            `yaml:"defaults"`
+		Nodes    map[string]map[string]any `yaml:"nodes"`
+		Links    []map[string]any          `yaml:"links"`
+	} `yaml:"topology"`
+}
+
+// clabEnd is a link end of an imported topology
+type clabEnd struct {
+	link int
+	a    bool
+}
+
+// IsContainerlab reports whether YAML data is a containerlab topology,
+// which nests its nodes under a topology key
+func IsContainerlab(data []byte) bool {
+	var top map[string]any
+	if err := yaml.Unmarshal(data, &top); err != nil {
+		return false
+	}
+	_, hasTopology := top["topology"]
+	_, hasNodes := top["nodes"]
+	return hasTopology && !hasNodes
+}
+
+// LoadContainerlab reads a containerlab topology file, see ImportContainerlab
+func LoadContainerlab(path string) (*Topology, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read containerlab file: %w", err)
+	}
+
+	t, warnings, err := ImportContainerlab(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("import %s: %w", path, err)
+	}
+	return t, warnings, nil
+}
+
+// ImportContainerlab converts a containerlab topology into a topology.
+// bridge and ovs-bridge nodes become switches and every other kind a host;
+// veth links keep their interface names. Addresses, routes and sysctls set
+// by "ip addr add", "ip route add" and "sysctl -w" exec commands are
+// carried over. Images, startup configs and other container settings have
+// no namespace equivalent and are dropped, with a warning for each one that
+// changes behavior.
+func ImportContainerlab(data []byte) (*Topology, []string, error) {
+	var file clabFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, nil, fmt.Errorf("parse containerlab topology: %w", err)
+	}
+	if len(file.Topology.Nodes) == 0 {
+		return nil, nil, fmt.Errorf("containerlab topology has no nodes")
+	}
+
+	var warnings []string
+	warnf := func(format string, args ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	t := NewTopology()
+	t.Name = file.Name
+
+	defaultKind, _ := file.Topology.Defaults["kind"].(string)
+	names := make([]string, 0, len(file.Topology.Nodes))
+	for name := range file.Topology.Nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	skipped := make(map[string]bool)
+	for _, name := range names {
+		fields := file.Topology.Nodes[name]
+		kind, _ := fields["kind"].(string)
+		if kind == "" {
+			kind = defaultKind
+		}
+
+		node := Node{Name: name, Type: NodeHost}
+		switch kind {
+		case "bridge", "ovs-bridge":
+			node.Type = NodeSwitch
+		case "linux", "":
+		case "host", "ext-container":
+			warnf("node %s: kind %s has no namespace equivalent, skipped", name, kind)
+			skipped[name] = true
+			continue
+		default:
+			warnf("node %s: kind %s runs as a plain Linux host", name, kind)
+		}
+
+		var ignored []string
+		for key := range fields {
+			if !clabIgnoredKeys[key] {
+				ignored = append(ignored, key)
+			}
+		}
+		if len(ignored) > 0 {
+			sort.Strings(ignored)
+			warnf("node %s: ignoring %s", name, strings.Join(ignored, ", "))
+		}
+
+		if sysctls, ok := fields["sysctls"].(map[string]any); ok {
+			for key, value := range sysctls {
+				setNodeSysctl(&node, key, fmt.Sprint(value))
+			}
+		}
+		t.Nodes[name] = node
+	}
+
+	// Link ends by "<node>:<interface>", for addresses set by exec commands
+	ends := make(map[string]clabEnd)
+	ports := make(map[string]bool) // "<node>:<port>" taken by eth<n> ends
+	for i, fields := range file.Topology.Links {
+		linkType, _ := fields["type"].(string)
+		if linkType != "" && linkType != "veth" {
+			warnf("link %d: type %s is not supported, skipped", i+1, linkType)
+			continue
+		}
+
+		endpoints, err := clabEndpoints(fields["endpoints"])
+		if err != nil {
+			return nil, nil, fmt.Errorf("link %d: %w", i+1, err)
+		}
+		if clabSpecialNodes[endpoints[0][0]] || clabSpecialNodes[endpoints[1][0]] || skipped[endpoints[0][0]] || skipped[endpoints[1][0]] {
+			warnf("link %d (%s:%s-%s:%s): endpoints outside the lab are not supported, skipped", i+1,
+				endpoints[0][0], endpoints[0][1], endpoints[1][0], endpoints[1][1])
+			continue
+		}
+
+		link := Link{
+			NodeA:   endpoints[0][0],
+			IfNameA: endpoints[0][1],
+			NodeB:   endpoints[1][0],
+			IfNameB: endpoints[1][1],
+		}
+		// eth<n> ends keep n as their port number
+		if port := containerlabPort(link.IfNameA); port > 0 && !ports[fmt.Sprintf("%s:%d", link.NodeA, port)] {
+			link.PortA = port
+			ports[fmt.Sprintf("%s:%d", link.NodeA, port)] = true
+		}
+		if port := containerlabPort(link.IfNameB); port > 0 && !ports[fmt.Sprintf("%s:%d", link.NodeB, port)] {
+			link.PortB = port
+			ports[fmt.Sprintf("%s:%d", link.NodeB, port)] = true
+		}
+		if mtu, ok := fields["mtu"].(int); ok {
+			link.MTU = mtu
+		}
+		for key := range fields {
+			if key != "endpoints" && key != "type" && key != "mtu" {
+				warnf("link %d: ignoring %s", i+1, key)
+			}
+		}
+
+		ends[link.NodeA+":"+link.IfNameA] = clabEnd{link: len(t.Links), a: true}
+		ends[link.NodeB+":"+link.IfNameB] = clabEnd{link: len(t.Links), a: false}
+		t.AddLinkConfig(link)
+	}
+
+	// Carry over addresses, routes and sysctls from exec commands
+	for _, name := range names {
+		if skipped[name] {
+			continue
+		}
+		commands, _ := file.Topology.Nodes[name]["exec"].([]any)
+		for _, command := range commands {
+			cmd := fmt.Sprint(command)
+			if err := applyClabExec(t, ends, name, cmd); err != nil {
+				warnf("node %s: ignoring exec %q: %v", name, cmd, err)
+			}
+		}
+	}
+
+	if err := t.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return t, warnings, nil
+}
+
+// clabEndpoints reads the two endpoints of a link, written "node:interface"
+// or as {node, interface} maps
+func clabEndpoints(value any) ([2][2]string, error) {
+	var ends [2][2]string
+
+	list, ok := value.([]any)
+	if !ok || len(list) != 2 {
+		return ends, fmt.Errorf("want two endpoints")
+	}
+	for i, end := range list {
+		switch e := end.(type) {
+		case string:
+			node, iface, ok := strings.Cut(e, ":")
+			if !ok || node == "" || iface == "" {
+				return ends, fmt.Errorf("endpoint %q: want node:interface", e)
+			}
+			ends[i] = [2]string{node, iface}
+		case map[string]any:
+			node, _ := e["node"].(string)
+			iface, _ := e["interface"].(string)
+			if node == "" || iface == "" {
+				return ends, fmt.Errorf("endpoint %d: want node and interface", i+1)
+			}
+			ends[i] = [2]string{node, iface}
+		default:
+			return ends, fmt.Errorf("endpoint %d: unexpected %T", i+1, end)
+		}
+	}
+	return ends, nil
+}
+
+// applyClabExec applies an exec command configuring an address, a route or a
+// sysctl. "ip link set ... up" is accepted and dropped: links come up anyway.
+func applyClabExec(t *Topology, ends map[string]clabEnd, node, cmd string) error {
+	args := strings.Fields(cmd)
+	if len(args) > 0 && args[0] == "sudo" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("empty command")
+	}
+
+	if args[0] == "sysctl" {
+		for _, arg := range args[1:] {
+			if key, value, ok := strings.Cut(arg, "="); ok {
+				n := t.Nodes[node]
+				setNodeSysctl(&n, key, value)
+				t.Nodes[node] = n
+				return nil
+			}
+		}
+		return fmt.Errorf("no key=value")
+	}
+
+	if args[0] != "ip" {
+		return fmt.Errorf("not an ip or sysctl command")
+	}
+	args = args[1:]
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		args = args[1:] // Family flags follow from the addresses
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("incomplete command")
+	}
+
+	object, action, rest := args[0], args[1], args[2:]
+	option := func(name string) string {
+		for i := 0; i+1 < len(rest); i++ {
+			if rest[i] == name {
+				return rest[i+1]
+			}
+		}
+		return ""
+	}
+
+	switch {
+	case object == "link" && action == "set":
+		return nil
+	case strings.HasPrefix("address", object) && action == "add" && len(rest) > 0:
+		ip, _, err := net.ParseCIDR(rest[0])
+		if err != nil {
+			return err
+		}
+		end, ok := ends[node+":"+option("dev")]
+		if !ok {
+			return fmt.Errorf("%s is not a link end", option("dev"))
+		}
+		return setEndAddress(&t.Links[end.link], end.a, rest[0], ip.To4() == nil)
+	case strings.HasPrefix("route", object) && action == "add" && len(rest) > 0:
+		dst := rest[0]
+		if dst == "0.0.0.0/0" || dst == "::/0" {
+			dst = "default"
+		}
+		route := Route{Node: node, Destination: dst, Gateway: option("via"), Device: option("dev")}
+		if route.Gateway == "" && route.Device == "" {
+			return fmt.Errorf("route without gateway or device")
+		}
+		t.Routes = append(t.Routes, route)
+		return nil
+	}
+	return fmt.Errorf("unsupported ip command")
+}
+
+// setEndAddress sets the IPv4 or IPv6 address of a link end; each end has
+// room for one of each
+func setEndAddress(link *Link, a bool, cidr string, v6 bool) error {
+	field := map[[2]bool]*string{
+		{true, false}:  &link.IPA,
+		{false, false}: &link.IPB,
+		{true, true}:   &link.IP6A,
+		{false, true}:  &link.IP6B,
+	}[[2]bool{a, v6}]
+	if *field != "" {
+		return fmt.Errorf("interface already has address %s", *field)
+	}
+	*field = cidr
+	return nil
+}
+
+// setNodeSysctl records a sysctl; the forwarding sysctls turn the node into
+// a router instead
+func setNodeSysctl(node *Node, key, value string) {
+	key = strings.ReplaceAll(key, "/", ".")
+	if _, ok := forwardingSysctls[key]; ok && value == "1" {
+		node.Forwarding = true
+		return
+	}
+	if node.Sysctls == nil {
+		node.Sysctls = make(map[string]string)
+	}
+	node.Sysctls[key] = value
+}
+
+type clabExportFile struct {
+	Name     string `yaml:"name"`
+	Topology struct {
+		Nodes map[string]clabExportNode `yaml:"nodes"`
+		Links []clabExportLink          `yaml:"links"`
+	} `yaml:"topology"`
+}
+
+type clabExportNode struct {
+	Kind    string            `yaml:"kind"`
+	Image   string            `yaml:"image,omitempty"`
+	Sysctls map[string]string `yaml:"sysctls,omitempty"`
+	Exec    []string          `yaml:"exec,omitempty"`
+}
+
+type clabExportLink struct {
+	Endpoints []string `yaml:"endpoints,flow"`
+	MTU       int      `yaml:"mtu,omitempty"`
+}
+
+// ExportContainerlab writes the topology as a containerlab topology: hosts
+// become linux nodes running image (DefaultContainerlabImage when empty)
+// with exec commands for their addresses, sub-interfaces and routes, and
+// switches become bridge nodes. It returns a warning for every setting
+// containerlab cannot express, such as NAT nodes, bonds, tunnels, VLAN
+// ports and link delays.
+func (t *Topology) ExportContainerlab(image string) ([]byte, []string, error) {
+	if image == "" {
+		image = DefaultContainerlabImage
+	}
+	links, err := allocatePorts(t.Links)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var warnings []string
+	warnf := func(format string, args ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	var file clabExportFile
+	file.Name = t.LabName()
+	file.Topology.Nodes = make(map[string]clabExportNode)
+	file.Topology.Links = []clabExportLink{}
+
+	exec := make(map[string][]string)
+	for _, name := range sortedNodeNames(t) {
+		node := t.Nodes[name]
+		switch node.Type {
+		case NodeSwitch:
+			file.Topology.Nodes[name] = clabExportNode{Kind: "bridge"}
+			warnf("switch %s: containerlab expects a bridge named %s on the host", name, name)
+			if node.Switch != nil || len(node.Mirrors) > 0 || len(node.External) > 0 {
+				warnf("switch %s: bridge options, mirrors and external interfaces are not exported", name)
+			}
+		case NodeNAT:
+			warnf("nat node %s is not exported", name)
+		default:
+			export := clabExportNode{Kind: "linux", Image: image}
+			for key, value := range node.Sysctls {
+				if export.Sysctls == nil {
+					export.Sysctls = make(map[string]string)
+				}
+				export.Sysctls[key] = value
+			}
+			if node.Forwarding {
+				if export.Sysctls == nil {
+					export.Sysctls = make(map[string]string)
+				}
+				for key, value := range forwardingSysctls {
+					export.Sysctls[key] = value
+				}
+			}
+			if node.DHCP || node.DHCPServer != nil {
+				warnf("host %s: dhcp is not exported", name)
+			}
+			file.Topology.Nodes[name] = export
+		}
+	}
+
+	hostEnd := func(node, ifName, ip, ip6 string, subs []SubInterface) {
+		if t.Nodes[node].Type != NodeHost {
+			return
+		}
+		for _, addr := range []string{ip, ip6} {
+			if addr != "" {
+				exec[node] = append(exec[node], fmt.Sprintf("ip addr add %s dev %s", addr, ifName))
+			}
+		}
+		for _, sub := range subs {
+			vlan := fmt.Sprintf("%s.%d", ifName, sub.VLAN)
+			exec[node] = append(exec[node],
+				fmt.Sprintf("ip link add link %s name %s type vlan id %d", ifName, vlan, sub.VLAN),
+				fmt.Sprintf("ip link set %s up", vlan))
+			for _, addr := range []string{sub.IP, sub.IP6} {
+				if addr != "" {
+					exec[node] = append(exec[node], fmt.Sprintf("ip addr add %s dev %s", addr, vlan))
+				}
+			}
+		}
+	}
+
+	for _, link := range links {
+		desc := fmt.Sprintf("%s:%s-%s:%s", link.NodeA, link.IfNameA, link.NodeB, link.IfNameB)
+		if link.Type != "" && link.Type != LinkVeth {
+			warnf("link %s: %s links are not exported", desc, link.Type)
+			continue
+		}
+		if t.Nodes[link.NodeA].Type == NodeNAT || t.Nodes[link.NodeB].Type == NodeNAT {
+			continue
+		}
+		if link.Delay != "" {
+			warnf("link %s: delay %s is not exported (use containerlab tools netem)", desc, link.Delay)
+		}
+		if link.VLANA != nil || link.VLANB != nil {
+			warnf("link %s: switch port VLANs are not exported", desc)
+		}
+
+		file.Topology.Links = append(file.Topology.Links, clabExportLink{
+			Endpoints: []string{link.NodeA + ":" + link.IfNameA, link.NodeB + ":" + link.IfNameB},
+			MTU:       link.MTU,
+		})
+		hostEnd(link.NodeA, link.IfNameA, link.IPA, link.IP6A, link.SubInterfacesA)
+		hostEnd(link.NodeB, link.IfNameB, link.IPB, link.IP6B, link.SubInterfacesB)
+	}
+
+	for _, route := range t.Routes {
+		if t.Nodes[route.Node].Type != NodeHost {
+			continue
+		}
+		cmd := "ip route add " + route.Destination
+		if ip := net.ParseIP(route.Gateway); ip != nil && ip.To4() == nil {
+			cmd = "ip -6 route add " + route.Destination
+		}
+		if route.Gateway != "" {
+			cmd += " via " + route.Gateway
+		}
+		if route.Device != "" {
+			cmd += " dev " + route.Device
+		}
+		exec[route.Node] = append(exec[route.Node], cmd)
+	}
+
+	for name, commands := range exec {
+		node := file.Topology.Nodes[name]
+		node.Exec = commands
+		file.Topology.Nodes[name] = node
+	}
+	if t.DNS != nil {
+		warnf("lab dns is not exported")
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(file); err != nil {
+		return nil, nil, fmt.Errorf("encode containerlab topology: %w", err)
+	}
+	return buf.Bytes(), warnings, nil
+}
+
+// containerlabPort returns the port number of an "eth<n>" interface name
+func containerlabPort(ifName string) int {
+	n, err := strconv.Atoi(strings.TrimPrefix(ifName, "eth"))
+	if err != nil || !strings.HasPrefix(ifName, "eth") || n < 1 {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,125 @@
+package topology
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+
+	"gonett/internal/container/domain"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadFile reads a topology from a YAML file
+func LoadFile(path string) (*Topology, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read topology file: %w", err)
+	}
+
+	t, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return t, nil
+}
+
+// Parse decodes a YAML topology. Nodes are keyed by name:
+//
+//	nodes:
+//	  h1: {type: host}
+//	  s1: {type: switch}
+//	links:
+//	  - {node_a: h1, node_b: s1, ip_a: 10.0.0.1/24}
+//
+// Unknown keys are rejected so typos do not silently drop settings.
+func Parse(data []byte) (*Topology, error) {
+	t := NewTopology()
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(t); err != nil {
+		return nil, err
+	}
+
+	for name, node := range t.Nodes {
+		node.Name = name
+		if node.Type == "" {
+			node.Type = NodeHost
+		}
+		t.Nodes[name] = node
+	}
+
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Marshal encodes the topology in the YAML format Parse reads
+func (t *Topology) Marshal() ([]byte, error) {
+	data, err := yaml.Marshal(t)
+	if err != nil {
+		return nil, fmt.Errorf("encode topology: %w", err)
+	}
+	return data, nil
+}
+
+// Validate checks that node types are known and that links and routes only
+// refer to existing nodes
+func (t *Topology) Validate() error {
+	for _, name := range sortedNodeNames(t) {
+		switch t.Nodes[name].Type {
+		case NodeHost, NodeSwitch, NodeNAT:
+		default:
+			return fmt.Errorf("node %s: unknown type %q", name, t.Nodes[name].Type)
+		}
+		if len(t.Nodes[name].Mirrors) > 0 && t.Nodes[name].Type != NodeSwitch {
+			return fmt.Errorf("node %s: mirrors need a switch node", name)
+		}
+		for _, ext := range t.Nodes[name].External {
+			switch ext.Mode {
+			case "", domain.ExternalMove, domain.ExternalMacvlan:
+			case domain.ExternalIPVlan:
+				return fmt.Errorf("node %s: external %s: ipvlan children share their parent's MAC and cannot be bridged, use macvlan", name, ext.Name)
+			default:
+				return fmt.Errorf("node %s: external %s: unknown mode %q", name, ext.Name, ext.Mode)
+			}
+		}
+	}
+
+	for i, link := range t.Links {
+		for _, node := range []string{link.NodeA, link.NodeB} {
+			if _, ok := t.Nodes[node]; !ok {
+				return fmt.Errorf("link %d (%s-%s): unknown node %q", i+1, link.NodeA, link.NodeB, node)
+			}
+		}
+		if link.Delay != "" {
+			if d, err := time.ParseDuration(link.Delay); err != nil || d < 0 {
+				return fmt.Errorf("link %d (%s-%s): invalid delay %q", i+1, link.NodeA, link.NodeB, link.Delay)
+			}
+			// netem is only set up on plain veth ends
+			if link.Type == LinkBond || link.Type == LinkTunnel {
+				return fmt.Errorf("link %d (%s-%s): delay is only supported on veth links, not %s", i+1, link.NodeA, link.NodeB, link.Type)
+			}
+		}
+		if link.Bond != nil && link.Bond.Members < 0 {
+			return fmt.Errorf("link %d (%s-%s): invalid bond member count %d", i+1, link.NodeA, link.NodeB, link.Bond.Members)
+		}
+	}
+
+	for _, route := range t.Routes {
+		if _, ok := t.Nodes[route.Node]; !ok {
+			return fmt.Errorf("route %s: unknown node %q", route.Destination, route.Node)
+		}
+	}
+
+	if t.DNS != nil && t.DNS.Node != "" {
+		if _, ok := t.Nodes[t.DNS.Node]; !ok {
+			return fmt.Errorf("dns: unknown node %q", t.DNS.Node)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,415 @@
+package topology
+
+import (
+	"container/heap"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GraphML import modes
+const (
+	GraphMLRouters  = "router" // Every node is a router; links are routed /30 subnets
+	GraphMLSwitches = "switch" // Every node is an STP switch; hosts share one subnet
+)
+
+// fibreDelayPerKm is the propagation delay of light in optical fibre,
+// about two thirds of its speed in vacuum
+const fibreDelayPerKm = 5 * time.Microsecond
+
+// maxGraphMLRouters bounds router mode to the /24 LANs of 172.16.0.0/12
+const maxGraphMLRouters = 4096
+
+// GraphMLOptions controls how a GraphML graph maps onto a topology
+type GraphMLOptions struct {
+	Name    string // Lab name (defaults to the graph's Network attribute)
+	Mode    string // GraphMLRouters (default) or GraphMLSwitches
+	Hosts   int    // Hosts attached to every node (1 when zero)
+	NoHosts bool   // Attach no hosts
+	NoDelay bool   // Ignore coordinates instead of deriving link delays
+}
+
+type graphMLDoc struct {
+	Keys  []graphMLKey `xml:"key"`
+	Graph struct {
+		Data  []graphMLData `xml:"data"`
+		Nodes []struct {
+			ID   string        `xml:"id,attr"`
+			Data []graphMLData `xml:"data"`
+		} `xml:"node"`
+		Edges []struct {
+			Source string        `xml:"source,attr"`
+			Target string        `xml:"target,attr"`
+			Data   []graphMLData `xml:"data"`
+		} `xml:"edge"`
+	} `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	Name string `xml:"attr.name,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// graphMLNode is a node of the imported graph
+type graphMLNode struct {
+	name     string
+	label    string
+	lat, lon float64
+	located  bool
+}
+
+// graphMLEdge is a link of the imported graph with its routing weight
+type graphMLEdge struct {
+	a, b   int
+	delay  time.Duration
+	ipA    netip.Addr // Addresses of the routed /30 between the ends
+	ipB    netip.Addr
+	weight int64
+}
+
+// LoadGraphML reads a GraphML file into a topology, see ImportGraphML
+func LoadGraphML(path string, opts GraphMLOptions) (*Topology, map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read graphml file: %w", err)
+	}
+
+	t, labels, err := ImportGraphML(data, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("import %s: %w", path, err)
+	}
+	return t, labels, nil
+}
+
+// ImportGraphML maps a GraphML graph, such as one from the Internet Topology
+// Zoo, onto a topology. Nodes become routers r1..rN (or switches s1..sN) in
+// document order, each with hosts attached. Links between nodes with
+// Latitude and Longitude get the fibre propagation delay of the great
+// circle distance between them.
+//
+// In router mode every link is a /30 from 10.0.0.0/8, every router serves a
+// /24 from 172.16.0.0/12 to its hosts (through a switch sw<n> when it has
+// several) and static routes follow the shortest paths by delay, so every
+// host reaches every other one. In switch mode the switches run STP and
+// hosts share 10.0.0.0/16.
+//
+// The returned map gives the graph label of every node that has one.
+func ImportGraphML(data []byte, opts GraphMLOptions) (*Topology, map[string]string, error) {
+	var doc graphMLDoc
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("parse graphml: %w", err)
+	}
+
+	switch opts.Mode {
+	case "":
+		opts.Mode = GraphMLRouters
+	case GraphMLRouters, GraphMLSwitches:
+	default:
+		return nil, nil, fmt.Errorf("unknown mode %q (want router or switch)", opts.Mode)
+	}
+	hosts := opts.Hosts
+	if hosts == 0 {
+		hosts = 1
+	}
+	if opts.NoHosts {
+		hosts = 0
+	}
+
+	// Data keys are matched by attribute name, falling back to the key ID
+	names := make(map[string]string)
+	for _, key := range doc.Keys {
+		names[key.ID] = strings.ToLower(key.Name)
+	}
+	attrs := func(data []graphMLData) map[string]string {
+		values := make(map[string]string)
+		for _, d := range data {
+			name := names[d.Key]
+			if name == "" {
+				name = strings.ToLower(d.Key)
+			}
+			values[name] = strings.TrimSpace(d.Value)
+		}
+		return values
+	}
+
+	if len(doc.Graph.Nodes) == 0 {
+		return nil, nil, fmt.Errorf("graph has no nodes")
+	}
+	if opts.Mode == GraphMLRouters && len(doc.Graph.Nodes) > maxGraphMLRouters {
+		return nil, nil, fmt.Errorf("%d nodes exceed the %d routers router mode can address", len(doc.Graph.Nodes), maxGraphMLRouters)
+	}
+
+	prefix := "r"
+	if opts.Mode == GraphMLSwitches {
+		prefix = "s"
+	}
+
+	nodes := make([]graphMLNode, len(doc.Graph.Nodes))
+	index := make(map[string]int)
+	labels := make(map[string]string)
+	for i, n := range doc.Graph.Nodes {
+		values := attrs(n.Data)
+		node := graphMLNode{name: fmt.Sprintf("%s%d", prefix, i+1), label: values["label"]}
+
+		lat, errLat := strconv.ParseFloat(values["latitude"], 64)
+		lon, errLon := strconv.ParseFloat(values["longitude"], 64)
+		if errLat == nil && errLon == nil {
+			node.lat, node.lon, node.located = lat, lon, true
+		}
+
+		if _, dup := index[n.ID]; dup {
+			return nil, nil, fmt.Errorf("duplicate node id %q", n.ID)
+		}
+		index[n.ID] = i
+		nodes[i] = node
+		if node.label != "" {
+			labels[node.name] = node.label
+		}
+	}
+
+	var edges []graphMLEdge
+	for _, e := range doc.Graph.Edges {
+		a, okA := index[e.Source]
+		b, okB := index[e.Target]
+		if !okA || !okB {
+			return nil, nil, fmt.Errorf("edge %s-%s: unknown node", e.Source, e.Target)
+		}
+		if a == b {
+			continue // Self-loops carry no traffic
+		}
+
+		edge := graphMLEdge{a: a, b: b}
+		if !opts.NoDelay && nodes[a].located && nodes[b].located {
+			km := greatCircleKm(nodes[a].lat, nodes[a].lon, nodes[b].lat, nodes[b].lon)
+			edge.delay = time.Duration(km * float64(fibreDelayPerKm)).Round(time.Microsecond)
+		}
+		edge.weight = edge.delay.Microseconds() + 1 // Hops break ties
+		edges = append(edges, edge)
+	}
+
+	t := NewTopology()
+	t.Name = opts.Name
+	if t.Name == "" {
+		t.Name = labName(attrs(doc.Graph.Data)["network"])
+	}
+
+	if opts.Mode == GraphMLSwitches {
+		importSwitches(t, nodes, edges, hosts)
+		return t, labels, nil
+	}
+	if err := importRouters(t, nodes, edges, hosts); err != nil {
+		return nil, nil, err
+	}
+	return t, labels, nil
+}
+
+// importSwitches adds every node as an STP switch with hosts on one subnet
+func importSwitches(t *Topology, nodes []graphMLNode, edges []graphMLEdge, hosts int) {
+	for _, n := range nodes {
+		t.AddSwitchWithOptions(n.name, SwitchOptions{STP: true, ForwardDelay: 4})
+	}
+	for _, e := range edges {
+		t.AddLinkConfig(Link{NodeA: nodes[e.a].name, NodeB: nodes[e.b].name, Delay: delayString(e.delay)})
+	}
+
+	addr := netip.MustParseAddr("10.0.0.0")
+	for i, n := range nodes {
+		for k := 1; k <= hosts; k++ {
+			addr = addr.Next()
+			host := hostName(i, k, hosts)
+			t.AddHost(host)
+			t.AddLinkWithIPs(host, n.name, addr.String()+"/16", "")
+		}
+	}
+}
+
+// importRouters adds every node as a router with a LAN of hosts, addresses
+// the links and installs shortest path routes between the LANs
+func importRouters(t *Topology, nodes []graphMLNode, edges []graphMLEdge, hosts int) error {
+	linkNet := netip.MustParseAddr("10.0.0.0")
+	for i := range edges {
+		e := &edges[i]
+		if !linkNet.Is4() || linkNet.As4()[0] != 10 {
+			return fmt.Errorf("%d links exceed the /30 subnets of 10.0.0.0/8", len(edges))
+		}
+		e.ipA = linkNet.Next()
+		e.ipB = e.ipA.Next()
+		for range 4 {
+			linkNet = linkNet.Next()
+		}
+
+		t.AddLinkConfig(Link{
+			NodeA: nodes[e.a].name,
+			NodeB: nodes[e.b].name,
+			IPA:   e.ipA.String() + "/30",
+			IPB:   e.ipB.String() + "/30",
+			Delay: delayString(e.delay),
+		})
+	}
+
+	lans := make([]string, len(nodes))
+	for i, n := range nodes {
+		t.AddRouter(n.name)
+		if hosts == 0 {
+			continue
+		}
+
+		lan := netip.AddrFrom4([4]byte{172, byte(16 + i/256), byte(i % 256), 0})
+		lans[i] = lan.String() + "/24"
+		gateway := lan.Next()
+
+		// A single host hangs off the router; several share a switch
+		lanPeer := ""
+		if hosts > 1 {
+			lanPeer = fmt.Sprintf("sw%d", i+1)
+			t.AddSwitch(lanPeer)
+			t.AddLinkWithIPs(n.name, lanPeer, gateway.String()+"/24", "")
+		}
+
+		addr := gateway
+		for k := 1; k <= hosts; k++ {
+			addr = addr.Next()
+			host := hostName(i, k, hosts)
+			t.AddHost(host)
+			if lanPeer == "" {
+				t.AddLinkWithIPs(n.name, host, gateway.String()+"/24", addr.String()+"/24")
+			} else {
+				t.AddLinkWithIPs(host, lanPeer, addr.String()+"/24", "")
+			}
+			t.AddRoute(host, "default", gateway.String())
+		}
+	}
+
+	// Route every LAN along the shortest paths by delay
+	adjacent := make([][]int, len(nodes))
+	for i, e := range edges {
+		adjacent[e.a] = append(adjacent[e.a], i)
+		adjacent[e.b] = append(adjacent[e.b], i)
+	}
+	for src := range nodes {
+		firstHop := shortestPaths(src, edges, adjacent)
+		for dst := range nodes {
+			if dst == src || lans[dst] == "" || firstHop[dst] < 0 {
+				continue
+			}
+			e := edges[firstHop[dst]]
+			gateway := e.ipB
+			if e.b == src {
+				gateway = e.ipA
+			}
+			t.AddRoute(nodes[src].name, lans[dst], gateway.String())
+		}
+	}
+
+	return nil
+}
+
+// shortestPaths runs Dijkstra from src and returns, for every node, the
+// edge leaving src on a shortest path to it (-1 when unreachable)
+func shortestPaths(src int, edges []graphMLEdge, adjacent [][]int) []int {
+	dist := make([]int64, len(adjacent))
+	firstHop := make([]int, len(adjacent))
+	for i := range dist {
+		dist[i] = math.MaxInt64
+		firstHop[i] = -1
+	}
+	dist[src] = 0
+
+	queue := &pathQueue{{node: src}}
+	for queue.Len() > 0 {
+		item := heap.Pop(queue).(pathItem)
+		if item.dist > dist[item.node] {
+			continue
+		}
+		for _, i := range adjacent[item.node] {
+			e := edges[i]
+			next := e.b
+			if next == item.node {
+				next = e.a
+			}
+			d := item.dist + e.weight
+			if d >= dist[next] {
+				continue
+			}
+			dist[next] = d
+			if item.node == src {
+				firstHop[next] = i
+			} else {
+				firstHop[next] = firstHop[item.node]
+			}
+			heap.Push(queue, pathItem{node: next, dist: d})
+		}
+	}
+	return firstHop
+}
+
+type pathItem struct {
+	node int
+	dist int64
+}
+
+// pathQueue is a min-heap of nodes by distance
+type pathQueue []pathItem
+
+func (q pathQueue) Len() int           { return len(q) }
+func (q pathQueue) Less(i, j int) bool { return q[i].dist < q[j].dist }
+func (q pathQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *pathQueue) Push(x any)        { *q = append(*q, x.(pathItem)) }
+func (q *pathQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// greatCircleKm returns the haversine distance between two coordinates
+func greatCircleKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusKm = 6371.0
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := rad(lat2 - lat1)
+	dLon := rad(lon2 - lon1)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(lat1))*math.Cos(rad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// delayString formats a link delay, leaving links without one undelayed
+func delayString(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// hostName names the k-th host of node i: "h<i>" or "h<i>-<k>"
+func hostName(i, k, hosts int) string {
+	if hosts == 1 {
+		return fmt.Sprintf("h%d", i+1)
+	}
+	return fmt.Sprintf("h%d-%d", i+1, k)
+}
+
+// labName turns a network name into a lab name
+func labName(network string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(network) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case b.Len() > 0 && !strings.HasSuffix(b.String(), "-"):
+			b.WriteByte('-')
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
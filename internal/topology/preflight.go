@@ -0,0 +1,53 @@
+package topology
+
+import (
+	"fmt"
+	"net"
+
+	"gonett/internal/container/domain"
+)
+
+// Preflight checks, without touching the kernel, what Build would only find
+// out once nodes exist: that link ports and interface names resolve, that
+// addresses and routes parse, and that no node name is taken by a container
+// of another lab. Containers of the topology's own lab are ignored, since
+// a rebuild replaces them.
+func Preflight(t *Topology, containers []*domain.Container) error {
+	if _, err := allocatePorts(t.Links); err != nil {
+		return fmt.Errorf("allocate ports: %w", err)
+	}
+
+	for i, link := range t.Links {
+		for _, ip := range []string{link.IPA, link.IPB, link.IP6A, link.IP6B} {
+			if ip == "" {
+				continue
+			}
+			if _, _, err := net.ParseCIDR(ip); err != nil {
+				return fmt.Errorf("link %d (%s-%s): invalid address %q", i+1, link.NodeA, link.NodeB, ip)
+			}
+		}
+	}
+
+	for _, route := range t.Routes {
+		if route.Gateway != "" && net.ParseIP(route.Gateway) == nil {
+			return fmt.Errorf("route %s on %s: invalid gateway %q", route.Destination, route.Node, route.Gateway)
+		}
+		if route.Destination == "default" {
+			if route.Gateway == "" {
+				return fmt.Errorf("route default on %s: default route requires a gateway", route.Node)
+			}
+			continue
+		}
+		if _, _, err := net.ParseCIDR(route.Destination); err != nil {
+			return fmt.Errorf("route on %s: invalid destination %q", route.Node, route.Destination)
+		}
+	}
+
+	for _, c := range containers {
+		if _, ok := t.Nodes[c.Name]; ok && c.Lab != t.LabName() {
+			return fmt.Errorf("node %s already exists in lab '%s'", c.Name, c.Lab)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package topology
+
+import (
+	"strings"
+	"testing"
+
+	"gonett/internal/container/domain"
+)
+
+func TestPreflight(t *testing.T) {
+	existing := []*domain.Container{
+		{Name: "h1", Lab: "demo"},
+		{Name: "r1", Lab: "other"},
+	}
+
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string // Empty when the topology must pass
+	}{
+		{name: "valid", yaml: "name: demo\nnodes: {h1: {}, s1: {type: switch}}\nlinks: [{node_a: h1, node_b: s1, ip_a: 10.0.0.1/24, ip6_a: fd00::1/64}]\nroutes: [{node: h1, destination: default, gateway: 10.0.0.254}]"},
+		{name: "own lab's nodes are replaced", yaml: "name: demo\nnodes: {h1: {}}"},
+		{name: "node of another lab", yaml: "name: demo\nnodes: {r1: {}}", wantErr: "node r1 already exists in lab 'other'"},
+		{name: "address without prefix", yaml: "nodes: {h1: {}, h2: {}}\nlinks: [{node_a: h1, node_b: h2, ip_b: 10.0.0.2}]", wantErr: `invalid address "10.0.0.2"`},
+		{name: "bad ipv6 address", yaml: "nodes: {h1: {}, h2: {}}\nlinks: [{node_a: h1, node_b: h2, ip6_a: fd00::zz/64}]", wantErr: "invalid address"},
+		{name: "duplicate port", yaml: "nodes: {h1: {}, h2: {}, h3: {}}\nlinks: [{node_a: h1, node_b: h2, port_a: 1}, {node_a: h1, node_b: h3, port_a: 1}]", wantErr: "port 1 on h1 is used by more than one link"},
+		{name: "interface name too long", yaml: "nodes: {h1: {}, h2: {}}\nlinks: [{node_a: h1, node_b: h2, ifname_a: averyveryverylongname}]", wantErr: "longer than"},
+		{name: "bad route gateway", yaml: "nodes: {h1: {}}\nroutes: [{node: h1, destination: 10.1.0.0/16, gateway: nope}]", wantErr: `invalid gateway "nope"`},
+		{name: "default route without gateway", yaml: "nodes: {h1: {}}\nroutes: [{node: h1, destination: default}]", wantErr: "requires a gateway"},
+		{name: "bad route destination", yaml: "nodes: {h1: {}}\nroutes: [{node: h1, destination: 10.1.0.0}]", wantErr: `invalid destination "10.1.0.0"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			topo, err := Parse([]byte(tt.yaml))
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+
+			err = Preflight(topo, existing)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("Preflight() = %v, want no error", err)
+			case tt.wantErr != "" && err == nil:
+				t.Fatalf("Preflight() passed, want an error containing %q", tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Fatalf("Preflight() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
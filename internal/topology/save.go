@@ -0,0 +1,683 @@
+package topology
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"gonett/internal/container/domain"
+	"gonett/internal/dhcp"
+	"gonett/internal/dns"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// defaultMTU is the MTU the kernel gives new veths
+const defaultMTU = 1500
+
+// liveState is what the kernel currently holds in a node's namespace
+type liveState struct {
+	addrs  map[string][]string // Global addresses by interface
+	mtu    map[string]int
+	routes []domain.Route // Routes added by hand or by gonett, not by the kernel
+}
+
+func readLiveState(ns *domain.Namespace) (*liveState, error) {
+	state := &liveState{
+		addrs: make(map[string][]string),
+		mtu:   make(map[string]int),
+	}
+
+	err := ns.Run(func() error {
+		links, err := netlink.LinkList()
+		if err != nil {
+			return fmt.Errorf("list links: %w", err)
+		}
+		names := make(map[int]string)
+		for _, link := range links {
+			names[link.Attrs().Index] = link.Attrs().Name
+			state.mtu[link.Attrs().Name] = link.Attrs().MTU
+		}
+
+		addrs, err := netlink.AddrList(nil, netlink.FAMILY_ALL)
+		if err != nil {
+			return fmt.Errorf("list addresses: %w", err)
+		}
+		for _, addr := range addrs {
+			if addr.Scope != unix.RT_SCOPE_UNIVERSE || addr.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			name := names[addr.LinkIndex]
+			state.addrs[name] = append(state.addrs[name], addr.IPNet.String())
+		}
+
+		routes, err := netlink.RouteList(nil, netlink.FAMILY_ALL)
+		if err != nil {
+			return fmt.Errorf("list routes: %w", err)
+		}
+		for _, r := range routes {
+			if r.Protocol != unix.RTPROT_BOOT && r.Protocol != unix.RTPROT_STATIC {
+				continue
+			}
+			route := domain.Route{Destination: "default"}
+			if r.Dst != nil {
+				if ones, _ := r.Dst.Mask.Size(); ones > 0 {
+					route.Destination = r.Dst.String()
+				}
+			}
+			if r.Gw != nil {
+				route.Gateway = r.Gw.String()
+			} else {
+				route.Device = names[r.LinkIndex]
+			}
+			state.routes = append(state.routes, route)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// saver rebuilds a topology from the containers of a lab
+type saver struct {
+	topo       *Topology
+	containers []*domain.Container
+	live       map[string]*liveState // nil for nodes whose namespace could not be read
+	leased     map[string]bool       // "<node>:<interface>" ends addressed through DHCP
+	warnings   []string
+}
+
+// FromContainers rebuilds the topology of a running lab from the records of
+// its containers. Addresses, MTUs and routes are read from the kernel, so
+// changes made by hand since the build are kept; the recorded values are
+// used for nodes whose namespace cannot be read. Settings that cannot be
+// recovered are reported as warnings.
+func FromContainers(lab string, containers []*domain.Container) (*Topology, []string, error) {
+	s := &saver{
+		topo:   &Topology{Name: lab, Nodes: make(map[string]Node), Links: []Link{}},
+		live:   make(map[string]*liveState),
+		leased: make(map[string]bool),
+	}
+	for _, c := range containers {
+		if c.Lab == lab {
+			s.containers = append(s.containers, c)
+		}
+	}
+	if len(s.containers) == 0 {
+		return nil, nil, fmt.Errorf("lab %s has no nodes", lab)
+	}
+	sort.Slice(s.containers, func(i, j int) bool { return s.containers[i].Name < s.containers[j].Name })
+
+	for _, c := range s.containers {
+		state, err := readLiveState(c.Namespace)
+		if err != nil {
+			s.warnf("%s: %v, using recorded state", c.Name, err)
+		} else {
+			s.live[c.Name] = state
+		}
+		for _, lease := range c.Leases {
+			s.leased[c.Name+":"+lease.Interface] = true
+		}
+	}
+
+	for _, c := range s.containers {
+		if err := s.addNode(c); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", c.Name, err)
+		}
+	}
+	s.addLinks()
+	if err := s.trimPorts(); err != nil {
+		return nil, nil, err
+	}
+	for _, c := range s.containers {
+		s.addRoutes(c)
+	}
+	for _, c := range s.containers {
+		if err := s.addServices(c); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", c.Name, err)
+		}
+	}
+
+	if err := s.topo.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("saved topology is invalid: %w", err)
+	}
+	return s.topo, s.warnings, nil
+}
+
+func (s *saver) warnf(format string, args ...any) {
+	s.warnings = append(s.warnings, fmt.Sprintf(format, args...))
+}
+
+func (s *saver) addNode(c *domain.Container) error {
+	node := Node{Type: NodeType(c.Type), Sysctls: c.Sysctls}
+	if node.Type == "" {
+		node.Type = NodeHost
+	}
+	node.DHCP = len(c.Leases) > 0
+
+	switch node.Type {
+	case NodeHost:
+		if s.live[c.Name] == nil {
+			break
+		}
+		forward, err := domain.GetSysctl(c.Namespace, "net.ipv4.ip_forward")
+		if err != nil {
+			return err
+		}
+		node.Forwarding = forward == "1"
+
+		// DisableDAD is set on every host, so any host tells
+		if accept, err := domain.GetSysctl(c.Namespace, "net.ipv6.conf.default.accept_dad"); err == nil && accept == "0" {
+			s.topo.IPv6.DisableDAD = true
+		}
+	case NodeSwitch:
+		if len(c.Bridges) == 0 {
+			break
+		}
+		bridge := c.Bridges[0]
+		opts := SwitchOptions{
+			STP:           bridge.Options.STP,
+			ForwardDelay:  int(bridge.Options.ForwardDelay),
+			VLANFiltering: bridge.Options.VLANFiltering,
+			AgeingTime:    int(bridge.Options.AgeingTime),
+			IGMPSnooping:  bridge.Options.IGMPSnooping,
+		}
+		if opts != (SwitchOptions{}) {
+			node.Switch = &opts
+		}
+		for _, m := range bridge.Mirrors {
+			node.Mirrors = append(node.Mirrors, Mirror{Name: m.Name, Sources: m.Sources, Monitor: m.Monitor, Direction: m.Direction})
+		}
+	}
+
+	for _, ext := range c.Externals {
+		e := ExternalInterface{Name: ext.Parent, Namespace: ext.OriginNamespace}
+		if e.Name == "" {
+			e.Name = ext.Name
+		}
+		if ext.Mode != domain.ExternalMove {
+			e.Mode = ext.Mode
+		}
+		if ext.Name != e.Name {
+			e.IfName = ext.Name
+		}
+		node.External = append(node.External, e)
+	}
+
+	s.topo.Nodes[c.Name] = node
+	return nil
+}
+
+// owner names the lab node holding the end of a veth that lives in ns. NAT
+// nodes all share the root namespace, recorded as nil, so a root end
+// belongs to the NAT node whose records hold the link.
+func (s *saver) owner(ns *domain.Namespace, v domain.Veth) *domain.Container {
+	for _, c := range s.containers {
+		if ns == nil {
+			if c.Namespace == nil && c.HasLink(v) {
+				return c
+			}
+			continue
+		}
+		if domain.SameNamespace(c.Namespace, ns) {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *saver) container(name string) *domain.Container {
+	for _, c := range s.containers {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// addrs returns the addresses of an interface, live when the node's
+// namespace could be read
+func (s *saver) addrs(c *domain.Container, ifName string, recorded []string) []string {
+	if state := s.live[c.Name]; state != nil {
+		return state.addrs[ifName]
+	}
+	return recorded
+}
+
+// mtu returns the MTU of an interface, live when the node's namespace could
+// be read
+func (s *saver) mtu(c *domain.Container, ifName string, recorded int) int {
+	if state := s.live[c.Name]; state != nil && state.mtu[ifName] > 0 {
+		return state.mtu[ifName]
+	}
+	return recorded
+}
+
+// splitAddrs picks one IPv4 and one IPv6 address for a link end, as a
+// topology holds, and warns about the rest
+func (s *saver) splitAddrs(node, ifName string, addrs []string) (string, string) {
+	var ip, ip6 string
+	for _, addr := range addrs {
+		parsed, _, err := net.ParseCIDR(addr)
+		if err != nil {
+			continue
+		}
+		switch {
+		case parsed.To4() != nil && ip == "":
+			ip = addr
+		case parsed.To4() == nil && ip6 == "":
+			ip6 = addr
+		default:
+			s.warnf("%s:%s: extra address %s not saved", node, ifName, addr)
+		}
+	}
+	if s.leased[node+":"+ifName] {
+		ip = ""
+	}
+	return ip, ip6
+}
+
+// linkMTU returns the MTU of a link from the MTUs of its ends, 0 for the
+// kernel default
+func (s *saver) linkMTU(link Link, mtuA, mtuB int) int {
+	if mtuA != mtuB {
+		s.warnf("link %s-%s: ends have MTU %d and %d, saving %d", link.NodeA, link.NodeB, mtuA, mtuB, max(mtuA, mtuB))
+	}
+	mtu := max(mtuA, mtuB)
+	if mtu == defaultMTU {
+		return 0
+	}
+	return mtu
+}
+
+func (s *saver) addLinks() {
+	seen := make(map[string]bool)
+
+	for _, c := range s.containers {
+		members := make(map[string]bool) // Bond members are saved as their bond
+		for _, bond := range c.Bonds {
+			for _, m := range bond.Members {
+				members[m] = true
+			}
+		}
+
+		for _, v := range c.Veths {
+			if members[v.Name] || members[v.PeerName] {
+				continue
+			}
+			key := v.Name
+			if v.NamespaceA != nil {
+				key = v.NamespaceA.Name + "/" + v.Name
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			a, b := s.owner(v.NamespaceA, v), s.owner(v.NamespaceB, v)
+			if a == nil || b == nil {
+				s.warnf("%s: veth %s-%s leaves the lab, not saved", c.Name, v.Name, v.PeerName)
+				continue
+			}
+			s.addVeth(v, a, b)
+		}
+
+		for _, bond := range c.Bonds {
+			s.addBond(c, bond, seen)
+		}
+		for _, tunnel := range c.Tunnels {
+			s.addTunnel(c, tunnel, seen)
+		}
+	}
+
+	sort.SliceStable(s.topo.Links, func(i, j int) bool {
+		a, b := s.topo.Links[i], s.topo.Links[j]
+		if a.NodeA != b.NodeA {
+			return a.NodeA < b.NodeA
+		}
+		return a.PortA < b.PortA
+	})
+	s.topo.Links = orderLinks(s.topo.Links)
+}
+
+// orderLinks puts links in an order in which the ports of every node come
+// up in increasing order, the order the builder numbered them in, so their
+// port numbers can be left out. Links that fit no such order keep theirs.
+func orderLinks(links []Link) []Link {
+	remaining := append([]Link(nil), links...)
+	ordered := make([]Link, 0, len(links))
+	for len(remaining) > 0 {
+		lowest := make(map[string]int)
+		for _, l := range remaining {
+			for _, end := range []struct {
+				node string
+				port int
+			}{{l.NodeA, l.PortA}, {l.NodeB, l.PortB}} {
+				if p, ok := lowest[end.node]; !ok || end.port < p {
+					lowest[end.node] = end.port
+				}
+			}
+		}
+
+		pick := 0
+		for i, l := range remaining {
+			if l.PortA == lowest[l.NodeA] && l.PortB == lowest[l.NodeB] {
+				pick = i
+				break
+			}
+		}
+		ordered = append(ordered, remaining[pick])
+		remaining = append(remaining[:pick], remaining[pick+1:]...)
+	}
+	return ordered
+}
+
+func (s *saver) addVeth(v domain.Veth, a, b *domain.Container) {
+	link := Link{
+		NodeA:   a.Name,
+		NodeB:   b.Name,
+		PortA:   v.PortA,
+		PortB:   v.PortB,
+		IfNameA: v.Name,
+		IfNameB: v.PeerName,
+		Delay:   v.Delay,
+	}
+	link.IPA, link.IP6A = s.splitAddrs(a.Name, v.Name, s.addrs(a, v.Name, v.AddrsA))
+	link.IPB, link.IP6B = s.splitAddrs(b.Name, v.PeerName, s.addrs(b, v.PeerName, v.AddrsB))
+	link.MTU = s.linkMTU(link, s.mtu(a, v.Name, v.MTUA), s.mtu(b, v.PeerName, v.MTUB))
+	link.VLANA = savedPortVLAN(a, v.Name)
+	link.VLANB = savedPortVLAN(b, v.PeerName)
+	link.SubInterfacesA = s.subInterfaces(a, v.Name)
+	link.SubInterfacesB = s.subInterfaces(b, v.PeerName)
+
+	s.topo.Links = append(s.topo.Links, link)
+}
+
+func (s *saver) addBond(c *domain.Container, bond domain.Bond, seen map[string]bool) {
+	peerNode, peerName, ok := strings.Cut(bond.Peer, ":")
+	if !ok {
+		return
+	}
+	key := pairKey(c.Name+":"+bond.Name, bond.Peer)
+	if seen[key] {
+		return
+	}
+	seen[key] = true
+
+	peerContainer := s.container(peerNode)
+	peer := findBond(peerContainer, peerName)
+	if peer == nil {
+		s.warnf("%s: bond %s has no peer %s in the lab, not saved", c.Name, bond.Name, bond.Peer)
+		return
+	}
+
+	link := Link{
+		Type:    LinkBond,
+		NodeA:   c.Name,
+		NodeB:   peerNode,
+		PortA:   bond.Port,
+		PortB:   peer.Port,
+		IfNameA: bond.Name,
+		IfNameB: peer.Name,
+		Bond:    &BondOptions{Members: len(bond.Members), Mode: bond.Mode, HashPolicy: bond.HashPolicy},
+	}
+	link.IPA, link.IP6A = s.splitAddrs(c.Name, bond.Name, s.addrs(c, bond.Name, bond.Addrs))
+	link.IPB, link.IP6B = s.splitAddrs(peerNode, peer.Name, s.addrs(peerContainer, peer.Name, peer.Addrs))
+	link.MTU = s.linkMTU(link, s.mtu(c, bond.Name, bond.MTU), s.mtu(peerContainer, peer.Name, peer.MTU))
+	link.VLANA = savedPortVLAN(c, bond.Name)
+	link.VLANB = savedPortVLAN(peerContainer, peer.Name)
+	link.SubInterfacesA = s.subInterfaces(c, bond.Name)
+	link.SubInterfacesB = s.subInterfaces(peerContainer, peer.Name)
+
+	s.topo.Links = append(s.topo.Links, link)
+}
+
+func (s *saver) addTunnel(c *domain.Container, tunnel domain.Tunnel, seen map[string]bool) {
+	peerNode, peerName, ok := strings.Cut(tunnel.Peer, ":")
+	if !ok {
+		return
+	}
+	key := pairKey(c.Name+":"+tunnel.Name, tunnel.Peer)
+	if seen[key] {
+		return
+	}
+	seen[key] = true
+
+	peerContainer := s.container(peerNode)
+	peer := findTunnel(peerContainer, peerName)
+	if peer == nil {
+		s.warnf("%s: tunnel %s has no peer %s in the lab, not saved", c.Name, tunnel.Name, tunnel.Peer)
+		return
+	}
+
+	link := Link{
+		Type:    LinkTunnel,
+		NodeA:   c.Name,
+		NodeB:   peerNode,
+		PortA:   tunnel.Port,
+		PortB:   peer.Port,
+		IfNameA: tunnel.Name,
+		IfNameB: peer.Name,
+		Tunnel: &TunnelOptions{
+			Kind:    tunnel.Kind,
+			LocalA:  tunnel.Local,
+			LocalB:  peer.Local,
+			VNI:     tunnel.VNI,
+			Key:     tunnel.Key,
+			UDPPort: tunnel.UDPPort,
+			MTU:     s.mtu(c, tunnel.Name, tunnel.MTU),
+		},
+	}
+	if link.Tunnel.UDPPort == domain.DefaultVXLANPort {
+		link.Tunnel.UDPPort = 0
+	}
+	link.IPA, link.IP6A = s.splitAddrs(c.Name, tunnel.Name, s.addrs(c, tunnel.Name, tunnel.Addrs))
+	link.IPB, link.IP6B = s.splitAddrs(peerNode, peer.Name, s.addrs(peerContainer, peer.Name, peer.Addrs))
+
+	s.topo.Links = append(s.topo.Links, link)
+}
+
+// subInterfaces returns the 802.1Q sub-interfaces of a link end
+func (s *saver) subInterfaces(c *domain.Container, parent string) []SubInterface {
+	var subs []SubInterface
+	for _, vlan := range c.VLANs {
+		if vlan.Parent != parent {
+			continue
+		}
+		sub := SubInterface{VLAN: vlan.VLANID}
+		sub.IP, sub.IP6 = s.splitAddrs(c.Name, vlan.Name, s.addrs(c, vlan.Name, vlan.Addrs))
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+// trimPorts drops the port numbers and interface names the builder would
+// pick by itself, keeping the saved file close to a hand-written one
+func (s *saver) trimPorts() error {
+	links := s.topo.Links
+	want := make([][2]int, len(links))
+	for i, link := range links {
+		want[i] = [2]int{link.PortA, link.PortB}
+	}
+	if !samePorts(links, want) {
+		return fmt.Errorf("recorded ports of lab %s conflict", s.topo.Name)
+	}
+
+	// Leave out one port at a time while the builder still numbers every
+	// link as it is now
+	for i := range links {
+		for _, port := range []*int{&links[i].PortA, &links[i].PortB} {
+			saved := *port
+			*port = 0
+			if !samePorts(links, want) {
+				*port = saved
+			}
+		}
+	}
+
+	for i := range links {
+		link := &links[i]
+		if link.IfNameA == defaultIfName(*link, link.NodeA, want[i][0]) {
+			link.IfNameA = ""
+		}
+		if link.IfNameB == defaultIfName(*link, link.NodeB, want[i][1]) {
+			link.IfNameB = ""
+		}
+	}
+	return nil
+}
+
+// samePorts reports whether the builder gives links the wanted ports
+func samePorts(links []Link, want [][2]int) bool {
+	allocated, err := allocatePorts(links)
+	if err != nil {
+		return false
+	}
+	for i, link := range allocated {
+		if link.PortA != want[i][0] || link.PortB != want[i][1] {
+			return false
+		}
+	}
+	return true
+}
+
+// defaultIfName is the interface name the builder gives a link end without
+// one
+func defaultIfName(link Link, node string, port int) string {
+	prefix := "eth"
+	if link.Type == LinkBond {
+		prefix = "bond"
+	}
+	if link.Type == LinkTunnel && link.Tunnel != nil {
+		prefix = link.Tunnel.Kind
+	}
+	return fmt.Sprintf("%s-%s%d", node, prefix, port)
+}
+
+// addRoutes saves the static routes of a host. Default routes the build
+// installs by itself, through a NAT node or a DHCP lease, are left out.
+func (s *saver) addRoutes(c *domain.Container) {
+	if s.topo.Nodes[c.Name].Type != NodeHost {
+		return
+	}
+
+	routes := c.Routes
+	if state := s.live[c.Name]; state != nil {
+		routes = state.routes
+	}
+
+	implicit := make(map[string]bool)
+	for _, lease := range c.Leases {
+		implicit[lease.Router] = true
+	}
+	for _, other := range s.containers {
+		if other.NAT != nil {
+			implicit[other.NAT.Gateway().String()] = true
+		}
+	}
+
+	for _, r := range routes {
+		if r.Destination == "default" && implicit[r.Gateway] {
+			continue
+		}
+		// Keep the device of a recorded route through a gateway
+		if r.Device == "" {
+			for _, recorded := range c.Routes {
+				if recorded.Destination == r.Destination && recorded.Gateway == r.Gateway {
+					r.Device = recorded.Device
+				}
+			}
+		}
+		s.topo.Routes = append(s.topo.Routes, Route{Node: c.Name, Destination: r.Destination, Gateway: r.Gateway, Device: r.Device})
+	}
+}
+
+// addServices saves the DHCP and DNS servers of a node from the
+// configuration their processes run with
+func (s *saver) addServices(c *domain.Container) error {
+	for _, service := range c.Services {
+		config, err := service.Config()
+		if err != nil {
+			s.warnf("%s: %v, its configuration is not saved", c.Name, err)
+			continue
+		}
+
+		switch service.Name {
+		case "dhcpd":
+			var cfg dhcp.ServerConfig
+			if err := json.Unmarshal([]byte(config), &cfg); err != nil {
+				return fmt.Errorf("decode dhcp server config: %w", err)
+			}
+			node := s.topo.Nodes[c.Name]
+			node.DHCPServer = &DHCPServer{
+				Interface: cfg.Interface,
+				PoolStart: cfg.PoolStart,
+				PoolEnd:   cfg.PoolEnd,
+				Router:    cfg.Router,
+				DNS:       cfg.DNS,
+				LeaseTime: cfg.LeaseTime,
+			}
+			s.topo.Nodes[c.Name] = node
+		case "dns":
+			var cfg dns.ServerConfig
+			if err := json.Unmarshal([]byte(config), &cfg); err != nil {
+				return fmt.Errorf("decode dns server config: %w", err)
+			}
+			opts := &DNSOptions{Node: c.Name, Forward: cfg.Forward}
+			if cfg.Domain != defaultDNSDomain {
+				opts.Domain = cfg.Domain
+			}
+			s.topo.DNS = opts
+		}
+	}
+	return nil
+}
+
+// savedPortVLAN returns the recorded VLANs of a switch port
+func savedPortVLAN(c *domain.Container, ifName string) *VLAN {
+	for _, bridge := range c.Bridges {
+		for _, port := range bridge.Ports {
+			if port.Interface == ifName && port.VLAN != nil {
+				return &VLAN{Access: port.VLAN.Access, Trunk: port.VLAN.Trunk, Native: port.VLAN.Native}
+			}
+		}
+	}
+	return nil
+}
+
+func findBond(c *domain.Container, name string) *domain.Bond {
+	if c == nil {
+		return nil
+	}
+	for i := range c.Bonds {
+		if c.Bonds[i].Name == name {
+			return &c.Bonds[i]
+		}
+	}
+	return nil
+}
+
+func findTunnel(c *domain.Container, name string) *domain.Tunnel {
+	if c == nil {
+		return nil
+	}
+	for i := range c.Tunnels {
+		if c.Tunnels[i].Name == name {
+			return &c.Tunnels[i]
+		}
+	}
+	return nil
+}
+
+// pairKey identifies a bond or tunnel by both of its "<node>:<name>" ends
+func pairKey(a, b string) string {
+	if b < a {
+		a, b = b, a
+	}
+	return a + "|" + b
+}
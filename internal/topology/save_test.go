@@ -0,0 +1,51 @@
+package topology
+
+import (
+	"testing"
+
+	"gonett/internal/container/domain"
+)
+
+// TestFromContainersNATOwners checks that root namespace ends are matched to
+// the NAT node recording them, not to whichever NAT node comes first: every
+// NAT node shares the root namespace.
+func TestFromContainersNATOwners(t *testing.T) {
+	ns := func(name string) *domain.Namespace {
+		// A namespace that cannot be entered makes save use the records
+		return &domain.Namespace{Name: name, Path: "/nonexistent/" + name}
+	}
+	h1, h2 := ns("h1"), ns("h2")
+
+	links := []domain.Veth{
+		{Name: "nat1-eth1", PeerName: "h1-eth1", PortA: 1, PortB: 1, NamespaceB: h1, AddrsB: []string{"192.168.100.2/24"}},
+		{Name: "nat2-eth1", PeerName: "h2-eth1", PortA: 1, PortB: 1, NamespaceB: h2, AddrsB: []string{"192.168.200.2/24"}},
+		{Name: "h1-eth2", PeerName: "h2-eth2", PortA: 2, PortB: 2, NamespaceA: h1, NamespaceB: h2},
+	}
+	containers := []*domain.Container{
+		{Name: "nat1", Type: string(NodeNAT), Lab: "lab", Veths: []domain.Veth{links[0]}},
+		{Name: "nat2", Type: string(NodeNAT), Lab: "lab", Veths: []domain.Veth{links[1]}},
+		{Name: "h1", Type: string(NodeHost), Lab: "lab", Namespace: h1, Veths: []domain.Veth{links[0], links[2]}},
+		{Name: "h2", Type: string(NodeHost), Lab: "lab", Namespace: h2, Veths: []domain.Veth{links[1], links[2]}},
+		{Name: "other", Type: string(NodeNAT), Lab: "elsewhere"},
+	}
+
+	topo, _, err := FromContainers("lab", containers)
+	if err != nil {
+		t.Fatalf("FromContainers() = %v", err)
+	}
+
+	want := map[string]bool{"h1-nat1": true, "h2-nat2": true, "h1-h2": true}
+	if len(topo.Links) != len(want) {
+		t.Fatalf("saved %d links, want %d: %+v", len(topo.Links), len(want), topo.Links)
+	}
+	for _, link := range topo.Links {
+		a, b := link.NodeA, link.NodeB
+		if a > b {
+			a, b = b, a
+		}
+		if !want[a+"-"+b] {
+			t.Errorf("saved a link between %s and %s", link.NodeA, link.NodeB)
+		}
+		delete(want, a+"-"+b)
+	}
+}
@@ -5,29 +5,178 @@ type NodeType string
 const (
 	NodeHost   NodeType = "host"
 	NodeSwitch NodeType = "switch"
+	NodeNAT    NodeType = "nat" // Gateway in the root namespace masquerading lab traffic
 )
 
 type Node struct {
-	Name string
-	Type NodeType
+	Name       string              `yaml:"-"`
+	Type       NodeType            `yaml:"type"`
+	Forwarding bool                `yaml:"forwarding,omitempty"`  // Enable IPv4 and IPv6 forwarding (routers)
+	Switch     *SwitchOptions      `yaml:"switch,omitempty"`      // Bridge features for switch nodes
+	External   []ExternalInterface `yaml:"external,omitempty"`    // Outside interfaces attached to a switch's bridge
+	Sysctls    map[string]string   `yaml:"sysctls,omitempty"`     // Sysctls set inside the node's namespace, e.g. "net.ipv4.tcp_congestion_control"
+	DHCP       bool                `yaml:"dhcp,omitempty"`        // Address link ends without a static IPv4 address through DHCP
+	DHCPServer *DHCPServer         `yaml:"dhcp_server,omitempty"` // DHCPv4 server run inside the node
+	Mirrors    []Mirror            `yaml:"mirrors,omitempty"`     // Port mirrors on a switch's bridge
 }
 
+// Mirror copies the traffic of switch ports to a monitor port (SPAN). Ports
+// are named by interface, e.g. "s1-eth1".
+type Mirror struct {
+	Name      string   `yaml:"name"`
+	Sources   []string `yaml:"sources"`
+	Monitor   string   `yaml:"monitor"`
+	Direction string   `yaml:"direction,omitempty"` // ingress, egress or both (default)
+}
+
+// DHCPServer runs a DHCPv4 server on one of a host's link ends. The end
+// needs a static IPv4 address, whose prefix is handed out with the leases.
+type DHCPServer struct {
+	Interface string   `yaml:"interface,omitempty"` // Link end to serve (defaults to the node's first addressed port)
+	PoolStart string   `yaml:"pool_start"`
+	PoolEnd   string   `yaml:"pool_end"`
+	Router    string   `yaml:"router,omitempty"`     // Default gateway handed to clients
+	DNS       []string `yaml:"dns,omitempty"`        // Name servers handed to clients
+	LeaseTime int      `yaml:"lease_time,omitempty"` // Seconds told to clients (default one hour); leases stay bound while the server runs
+}
+
+// ExternalInterface attaches an interface that lives outside the lab (a
+// physical NIC, a dummy or a VM tap) to a switch. In "move" mode the
+// interface itself is moved into the switch and handed back on teardown;
+// "macvlan" creates a passthru child interface named IfName instead, which
+// takes over the parent's traffic while the parent stays in place. ipvlan
+// children share their parent's MAC, so they cannot be bridged and are
+// rejected.
+type ExternalInterface struct {
+	Name      string `yaml:"name"`                // Existing interface in the source namespace
+	Mode      string `yaml:"mode,omitempty"`      // move (default) or macvlan
+	IfName    string `yaml:"ifname,omitempty"`    // Name of the macvlan child (defaults to Name)
+	Namespace string `yaml:"namespace,omitempty"` // Source namespace path (defaults to the root namespace)
+}
+
+// SwitchOptions configures the bridge of a switch node. Times are in seconds
+// and zero keeps the kernel default.
+type SwitchOptions struct {
+	STP           bool  `yaml:"stp,omitempty"`            // Enable kernel STP so loops and rings do not storm
+	ForwardDelay  int   `yaml:"forward_delay,omitempty"`  // STP forward delay
+	VLANFiltering bool  `yaml:"vlan_filtering,omitempty"` // Required for per-port VLAN configuration
+	AgeingTime    int   `yaml:"ageing_time,omitempty"`    // MAC address ageing time
+	IGMPSnooping  *bool `yaml:"igmp_snooping,omitempty"`  // nil keeps the kernel default (enabled)
+}
+
+// VLAN configures a switch port as an access port (Access) or as a trunk
+// carrying tagged VLANs (Trunk) with an optional untagged Native VLAN
+type VLAN struct {
+	Access int   `yaml:"access,omitempty"`
+	Trunk  []int `yaml:"trunk,omitempty"`
+	Native int   `yaml:"native,omitempty"`
+}
+
+// LinkType selects how a link is realized between its two nodes
+type LinkType string
+
+const (
+	LinkVeth   LinkType = "veth"   // A single veth pair (default)
+	LinkBond   LinkType = "bond"   // Several veth pairs aggregated by a bond on each end
+	LinkTunnel LinkType = "tunnel" // VXLAN/GRE/IPIP devices over an existing underlay path
+)
+
 type Link struct {
-	NodeA string
-	NodeB string
-	IPA   string // IP address for NodeA end (CIDR format, e.g., "10.0.0.1/24")
-	IPB   string // IP address for NodeB end (CIDR format, e.g., "10.0.0.2/24")
+	Type    LinkType `yaml:"type,omitempty"`
+	NodeA   string   `yaml:"node_a"`
+	NodeB   string   `yaml:"node_b"`
+	IPA     string   `yaml:"ip_a,omitempty"`     // IP address for NodeA end (CIDR format, e.g., "10.0.0.1/24")
+	IPB     string   `yaml:"ip_b,omitempty"`     // IP address for NodeB end (CIDR format, e.g., "10.0.0.2/24")
+	IP6A    string   `yaml:"ip6_a,omitempty"`    // IPv6 address for NodeA end (CIDR format, e.g., "fd00::1/64")
+	IP6B    string   `yaml:"ip6_b,omitempty"`    // IPv6 address for NodeB end (CIDR format, e.g., "fd00::2/64")
+	PortA   int      `yaml:"port_a,omitempty"`   // Port number on NodeA (1-based, 0 picks the next free port)
+	PortB   int      `yaml:"port_b,omitempty"`   // Port number on NodeB (1-based, 0 picks the next free port)
+	IfNameA string   `yaml:"ifname_a,omitempty"` // Interface name on NodeA (defaults to "<node>-eth<port>")
+	IfNameB string   `yaml:"ifname_b,omitempty"` // Interface name on NodeB (defaults to "<node>-eth<port>")
+	VLANA   *VLAN    `yaml:"vlan_a,omitempty"`   // Port VLAN configuration when NodeA is a switch
+	VLANB   *VLAN    `yaml:"vlan_b,omitempty"`   // Port VLAN configuration when NodeB is a switch
+	MTU     int      `yaml:"mtu,omitempty"`      // MTU of both ends (0 keeps the kernel default)
+	Delay   string   `yaml:"delay,omitempty"`    // One-way delay added on both ends of a veth link, e.g. "2.5ms" (needs sch_netem)
+
+	SubInterfacesA []SubInterface `yaml:"subinterfaces_a,omitempty"` // 802.1Q sub-interfaces on NodeA's end (hosts only)
+	SubInterfacesB []SubInterface `yaml:"subinterfaces_b,omitempty"` // 802.1Q sub-interfaces on NodeB's end (hosts only)
+
+	Bond   *BondOptions   `yaml:"bond,omitempty"`   // Bond settings for LinkBond links
+	Tunnel *TunnelOptions `yaml:"tunnel,omitempty"` // Tunnel settings for LinkTunnel links
+}
+
+// BondOptions configures a bonded link. Each end gets a bond device named
+// like a regular link end and Members veth pairs named "<bond>-<n>".
+type BondOptions struct {
+	Members    int    `yaml:"members,omitempty"`     // Number of member veth pairs (default 2)
+	Mode       string `yaml:"mode,omitempty"`        // active-backup (default), 802.3ad, balance-xor, ...
+	HashPolicy string `yaml:"hash_policy,omitempty"` // Transmit hash policy, e.g. layer2, layer3+4
+}
+
+// TunnelOptions configures a tunnel link. LocalA and LocalB are underlay
+// addresses that must already be configured on NodeA and NodeB by other
+// links; tunnel links are therefore built after all other links.
+type TunnelOptions struct {
+	Kind    string `yaml:"kind"`               // vxlan, gre or ipip
+	LocalA  string `yaml:"local_a,omitempty"`  // Underlay address of NodeA (plain IP, no prefix)
+	LocalB  string `yaml:"local_b,omitempty"`  // Underlay address of NodeB (plain IP, no prefix)
+	VNI     int    `yaml:"vni,omitempty"`      // VXLAN network identifier
+	Key     uint32 `yaml:"key,omitempty"`      // GRE key (0 for none)
+	UDPPort int    `yaml:"udp_port,omitempty"` // VXLAN destination port (default 4789)
+	MTU     int    `yaml:"mtu,omitempty"`      // Tunnel MTU (default: underlay MTU minus encapsulation overhead)
+}
+
+// SubInterface is an 802.1Q sub-interface created on a host's link end,
+// named "<interface>.<vlan>"
+type SubInterface struct {
+	VLAN int    `yaml:"vlan"`
+	IP   string `yaml:"ip,omitempty"`  // CIDR format, optional
+	IP6  string `yaml:"ip6,omitempty"` // IPv6 CIDR format, optional
+}
+
+// Route is a static route installed on a node after its links are built.
+// Destination is a CIDR or "default"; the family follows the gateway.
+type Route struct {
+	Node        string `yaml:"node"`
+	Destination string `yaml:"destination"`
+	Gateway     string `yaml:"gateway,omitempty"`
+	Device      string `yaml:"device,omitempty"` // Optional outgoing interface
+}
+
+// IPv6Options controls duplicate address detection on every node. By
+// default addresses stay tentative for about a second after assignment.
+type IPv6Options struct {
+	DisableDAD bool `yaml:"disable_dad,omitempty"` // Skip DAD so addresses are usable immediately
+	WaitDAD    bool `yaml:"wait_dad,omitempty"`    // Block the build until DAD has completed on every node
+	DADTimeout int  `yaml:"dad_timeout,omitempty"` // Seconds to wait for DAD (default 5)
+}
+
+// DefaultLabName names the lab of a topology that has no name
+const DefaultLabName = "default"
+
+// DNSOptions runs a lab-wide DNS server answering A, AAAA and PTR queries
+// for node names, bare ("h2") and under Domain ("h2.lab"). Every host's
+// resolv.conf points at it.
+type DNSOptions struct {
+	Node    string   `yaml:"node,omitempty"`    // Host or NAT node running the server (defaults to the NAT node)
+	Domain  string   `yaml:"domain,omitempty"`  // Search domain (default "lab")
+	Forward []string `yaml:"forward,omitempty"` // Upstream resolvers for names outside the lab
 }
 
 type Topology struct {
-	Nodes map[string]Node
-	Links []Link
+	Name   string          `yaml:"name,omitempty"` // Lab name recorded on every node (default "default")
+	Nodes  map[string]Node `yaml:"nodes"`
+	Links  []Link          `yaml:"links"`
+	Routes []Route         `yaml:"routes,omitempty"`
+	IPv6   IPv6Options     `yaml:"ipv6,omitempty"`
+	DNS    *DNSOptions     `yaml:"dns,omitempty"`
 }
 
 func NewTopology() *Topology {
 	return &Topology{
-		Nodes: map[string]Node{},
-		Links: []Link{},
+		Nodes:  map[string]Node{},
+		Links:  []Link{},
+		Routes: []Route{},
 	}
 }
 
@@ -45,6 +194,96 @@ func (t *Topology) AddSwitch(name string) {
 	}
 }
 
+// AddSwitchWithOptions adds a switch whose bridge is created with the given features
+func (t *Topology) AddSwitchWithOptions(name string, opts SwitchOptions) {
+	t.Nodes[name] = Node{
+		Name:   name,
+		Type:   NodeSwitch,
+		Switch: &opts,
+	}
+}
+
+// AddRouter adds a host with IPv4 and IPv6 forwarding enabled
+func (t *Topology) AddRouter(name string) {
+	t.Nodes[name] = Node{
+		Name:       name,
+		Type:       NodeHost,
+		Forwarding: true,
+	}
+}
+
+// AddRoute adds a static route on a node; dst is a CIDR or "default"
+func (t *Topology) AddRoute(node, dst, gateway string) {
+	t.Routes = append(t.Routes, Route{
+		Node:        node,
+		Destination: dst,
+		Gateway:     gateway,
+	})
+}
+
+// SetSysctl sets a sysctl inside a node's namespace during build. Keys may
+// name interfaces created by the build (net.ipv4.conf.h1-eth1.rp_filter);
+// those are applied once the links exist.
+func (t *Topology) SetSysctl(node, key, value string) {
+	n := t.Nodes[node]
+	if n.Sysctls == nil {
+		n.Sysctls = make(map[string]string)
+	}
+	n.Sysctls[key] = value
+	t.Nodes[node] = n
+}
+
+// AddDHCPServer runs a DHCPv4 server inside a host once its links are built
+func (t *Topology) AddDHCPServer(node string, server DHCPServer) {
+	n := t.Nodes[node]
+	n.DHCPServer = &server
+	t.Nodes[node] = n
+}
+
+// AddMirror adds a port mirror to a switch
+func (t *Topology) AddMirror(switchName string, mirror Mirror) {
+	n := t.Nodes[switchName]
+	n.Mirrors = append(n.Mirrors, mirror)
+	t.Nodes[switchName] = n
+}
+
+// EnableDHCP makes a host obtain addresses for its link ends through DHCP
+func (t *Topology) EnableDHCP(node string) {
+	n := t.Nodes[node]
+	n.DHCP = true
+	t.Nodes[node] = n
+}
+
+// EnableDNS runs a lab DNS server once the topology is built
+func (t *Topology) EnableDNS(opts DNSOptions) {
+	t.DNS = &opts
+}
+
+// LabName returns the topology's lab name
+func (t *Topology) LabName() string {
+	if t.Name == "" {
+		return DefaultLabName
+	}
+	return t.Name
+}
+
+// AddExternalInterface attaches an interface from outside the lab to a switch
+func (t *Topology) AddExternalInterface(switchName string, ext ExternalInterface) {
+	node := t.Nodes[switchName]
+	node.External = append(node.External, ext)
+	t.Nodes[switchName] = node
+}
+
+// AddNAT adds a NAT node. Its single link end lives in the root namespace;
+// the address given for that end becomes the default gateway of every host
+// in the same subnet.
+func (t *Topology) AddNAT(name string) {
+	t.Nodes[name] = Node{
+		Name: name,
+		Type: NodeNAT,
+	}
+}
+
 func (t *Topology) AddLink(a, b string) {
 	t.Links = append(t.Links, Link{
 		NodeA: a,
@@ -62,3 +301,51 @@ func (t *Topology) AddLinkWithIPs(a, b, ipA, ipB string) {
 		IPB:   ipB,
 	})
 }
+
+// AddDualStackLink adds a link with IPv4 and IPv6 addresses on both ends
+func (t *Topology) AddDualStackLink(a, b, ipA, ipB, ip6A, ip6B string) {
+	t.Links = append(t.Links, Link{
+		NodeA: a,
+		NodeB: b,
+		IPA:   ipA,
+		IPB:   ipB,
+		IP6A:  ip6A,
+		IP6B:  ip6B,
+	})
+}
+
+func (t *Topology) AddLinkWithPorts(a, b string, portA, portB int) {
+	t.Links = append(t.Links, Link{
+		NodeA: a,
+		NodeB: b,
+		PortA: portA,
+		PortB: portB,
+	})
+}
+
+// AddLinkConfig adds a fully specified link
+func (t *Topology) AddLinkConfig(link Link) {
+	t.Links = append(t.Links, link)
+}
+
+// AddBondLink adds a bonded link of several veth pairs between two nodes
+func (t *Topology) AddBondLink(a, b string, opts BondOptions) {
+	t.Links = append(t.Links, Link{
+		Type:  LinkBond,
+		NodeA: a,
+		NodeB: b,
+		Bond:  &opts,
+	})
+}
+
+// AddTunnelLink adds a tunnel between two nodes over their underlay addresses
+func (t *Topology) AddTunnelLink(a, b, ipA, ipB string, opts TunnelOptions) {
+	t.Links = append(t.Links, Link{
+		Type:   LinkTunnel,
+		NodeA:  a,
+		NodeB:  b,
+		IPA:    ipA,
+		IPB:    ipB,
+		Tunnel: &opts,
+	})
+}
@@ -0,0 +1,257 @@
+package watch
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"gonett/internal/container/domain"
+
+	"github.com/vishvananda/netlink"
+)
+
+// Drift kinds
+const (
+	DriftNamespace = "namespace" // The node's namespace is gone
+	DriftLink      = "link"      // A veth end is gone
+	DriftBridge    = "bridge"    // A switch bridge is gone
+	DriftPort      = "port"      // A veth end left its bridge
+	DriftAddress   = "address"   // An address is gone from an interface
+	DriftRoute     = "route"     // A static route is gone
+	DriftMirror    = "mirror"    // A port mirror's filters are gone
+)
+
+// Drift is a difference between what the repository records for a node and
+// what the kernel has
+type Drift struct {
+	Node      string
+	Kind      string
+	Interface string
+	Detail    string
+
+	container *domain.Container
+	veth      *domain.Veth
+	bridge    *domain.Bridge
+	port      *domain.BridgePort
+	route     *domain.Route
+	mirror    *domain.Mirror
+}
+
+func (d Drift) String() string {
+	switch d.Kind {
+	case DriftNamespace:
+		return fmt.Sprintf("%s: namespace %s is missing", d.Node, d.Detail)
+	case DriftLink:
+		return fmt.Sprintf("%s: link %s is missing", d.Node, d.Interface)
+	case DriftBridge:
+		return fmt.Sprintf("%s: bridge %s is missing", d.Node, d.Interface)
+	case DriftPort:
+		return fmt.Sprintf("%s: %s is not attached to bridge %s", d.Node, d.Interface, d.Detail)
+	case DriftAddress:
+		return fmt.Sprintf("%s: address %s is missing on %s", d.Node, d.Detail, d.Interface)
+	case DriftRoute:
+		return fmt.Sprintf("%s: route %s is missing", d.Node, d.Detail)
+	case DriftMirror:
+		return fmt.Sprintf("%s: mirror %s on %s is not installed", d.Node, d.Detail, d.Interface)
+	}
+	return fmt.Sprintf("%s: %s %s %s", d.Node, d.Kind, d.Interface, d.Detail)
+}
+
+// kernelState is the live network state of a namespace
+type kernelState struct {
+	links  map[string]netlink.Link
+	addrs  map[string][]netlink.Addr // By interface name
+	routes []netlink.Route
+}
+
+func readState(ns *domain.Namespace) (*kernelState, error) {
+	state := &kernelState{
+		links: make(map[string]netlink.Link),
+		addrs: make(map[string][]netlink.Addr),
+	}
+
+	err := ns.Run(func() error {
+		links, err := netlink.LinkList()
+		if err != nil {
+			return fmt.Errorf("list links: %w", err)
+		}
+
+		names := make(map[int]string)
+		for _, link := range links {
+			state.links[link.Attrs().Name] = link
+			names[link.Attrs().Index] = link.Attrs().Name
+		}
+
+		addrs, err := netlink.AddrList(nil, netlink.FAMILY_ALL)
+		if err != nil {
+			return fmt.Errorf("list addresses: %w", err)
+		}
+		for _, addr := range addrs {
+			name := names[addr.LinkIndex]
+			state.addrs[name] = append(state.addrs[name], addr)
+		}
+
+		if state.routes, err = netlink.RouteList(nil, netlink.FAMILY_ALL); err != nil {
+			return fmt.Errorf("list routes: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// hasAddr reports whether an interface carries the address in CIDR format
+func (s *kernelState) hasAddr(ifName, cidr string) bool {
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return true // Nothing to compare against
+	}
+	ones, _ := ipNet.Mask.Size()
+
+	for _, addr := range s.addrs[ifName] {
+		addrOnes, _ := addr.Mask.Size()
+		if addr.IP.Equal(ip) && addrOnes == ones {
+			return true
+		}
+	}
+	return false
+}
+
+// hasRoute reports whether a recorded route is installed
+func (s *kernelState) hasRoute(route domain.Route) bool {
+	gw := net.ParseIP(route.Gateway)
+
+	var dst *net.IPNet
+	if route.Destination != "default" {
+		var err error
+		if _, dst, err = net.ParseCIDR(route.Destination); err != nil {
+			return true
+		}
+	}
+
+	for _, r := range s.routes {
+		if dst == nil {
+			// Default routes are listed without a destination or as /0
+			if r.Dst != nil {
+				if ones, _ := r.Dst.Mask.Size(); ones != 0 {
+					continue
+				}
+			}
+		} else if r.Dst == nil || r.Dst.String() != dst.String() {
+			continue
+		}
+
+		if gw != nil && !gw.Equal(r.Gw) {
+			continue
+		}
+		if route.Device != "" {
+			link, ok := s.links[route.Device]
+			if !ok || link.Attrs().Index != r.LinkIndex {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// namespaceExists reports whether a namespace is still mounted. The root
+// namespace (nil) always exists.
+func namespaceExists(ns *domain.Namespace) bool {
+	if ns == nil {
+		return true
+	}
+	_, err := os.Stat(ns.Path)
+	return err == nil
+}
+
+// Check compares a node's recorded veth ends, bridges, port mirrors,
+// addresses and static routes against the kernel. Links whose other end
+// belonged to a namespace that no longer exists are skipped: their peer
+// node was removed. Removing a node also drops the other nodes' copies of
+// its links, which covers peers in the root namespace.
+func Check(c *domain.Container) ([]Drift, error) {
+	if !namespaceExists(c.Namespace) {
+		return []Drift{{Node: c.Name, Kind: DriftNamespace, Detail: c.Namespace.Path, container: c}}, nil
+	}
+
+	state, err := readState(c.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", c.Name, err)
+	}
+
+	var drifts []Drift
+	add := func(d Drift) {
+		d.Node = c.Name
+		d.container = c
+		drifts = append(drifts, d)
+	}
+
+	for i := range c.Bridges {
+		bridge := &c.Bridges[i]
+		if _, ok := state.links[bridge.Name]; !ok {
+			add(Drift{Kind: DriftBridge, Interface: bridge.Name, bridge: bridge})
+			continue
+		}
+		for j := range bridge.Mirrors {
+			if m := &bridge.Mirrors[j]; !bridge.MirrorActive(*m) {
+				add(Drift{Kind: DriftMirror, Interface: bridge.Name, Detail: m.Name, bridge: bridge, mirror: m})
+			}
+		}
+	}
+
+	for i := range c.Veths {
+		veth := &c.Veths[i]
+
+		var ifName string
+		var addrs []string
+		var peerNS *domain.Namespace
+		switch {
+		case domain.SameNamespace(veth.NamespaceA, c.Namespace):
+			ifName, addrs, peerNS = veth.Name, veth.AddrsA, veth.NamespaceB
+		case domain.SameNamespace(veth.NamespaceB, c.Namespace):
+			ifName, addrs, peerNS = veth.PeerName, veth.AddrsB, veth.NamespaceA
+		default:
+			continue
+		}
+		if !namespaceExists(peerNS) {
+			continue
+		}
+
+		link, ok := state.links[ifName]
+		if !ok {
+			add(Drift{Kind: DriftLink, Interface: ifName, veth: veth})
+			continue
+		}
+
+		if bridge := c.BridgeWithPort(ifName); bridge != nil {
+			master, ok := state.links[bridge.Name]
+			if ok && link.Attrs().MasterIndex != master.Attrs().Index {
+				var port *domain.BridgePort
+				for j := range bridge.Ports {
+					if bridge.Ports[j].Interface == ifName {
+						port = &bridge.Ports[j]
+					}
+				}
+				add(Drift{Kind: DriftPort, Interface: ifName, Detail: bridge.Name, bridge: bridge, port: port})
+			}
+		}
+
+		for _, addr := range addrs {
+			if !state.hasAddr(ifName, addr) {
+				add(Drift{Kind: DriftAddress, Interface: ifName, Detail: addr, veth: veth})
+			}
+		}
+	}
+
+	for i := range c.Routes {
+		route := &c.Routes[i]
+		if !state.hasRoute(*route) {
+			add(Drift{Kind: DriftRoute, Interface: route.Device, Detail: route.String(), route: route})
+		}
+	}
+
+	return drifts, nil
+}
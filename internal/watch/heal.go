@@ -0,0 +1,160 @@
+package watch
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"gonett/internal/container/domain"
+)
+
+// healOrder repairs links before what lives on them
+var healOrder = map[string]int{
+	DriftLink:    0,
+	DriftPort:    1,
+	DriftAddress: 2,
+	DriftRoute:   3,
+	DriftMirror:  4,
+}
+
+// Healable reports whether Heal can repair a drift. Missing namespaces and
+// bridges are only reported: re-creating them means rebuilding the node.
+func (d Drift) Healable() bool {
+	_, ok := healOrder[d.Kind]
+	return ok
+}
+
+// Heal repairs drifts from the recorded state: it re-creates missing veth
+// links with their names, MACs and MTUs, re-attaches bridge ports,
+// re-assigns addresses and static routes and re-installs port mirrors.
+// Re-created links get their addresses and neighbors back at once; switch
+// ends show up as detached ports on the next check. It returns a line per
+// repair.
+func Heal(drifts []Drift) ([]string, []error) {
+	drifts = append([]Drift(nil), drifts...)
+	sort.SliceStable(drifts, func(i, j int) bool {
+		return healOrder[drifts[i].Kind] < healOrder[drifts[j].Kind]
+	})
+
+	var repaired []string
+	var errs []error
+	recreated := make(map[string]bool) // Links re-created, by A end
+
+	for _, d := range drifts {
+		if !d.Healable() {
+			continue
+		}
+
+		var err error
+		switch d.Kind {
+		case DriftLink:
+			key := linkKey(d.veth)
+			if recreated[key] {
+				continue
+			}
+			if err = recreateLink(d.veth); err == nil {
+				recreated[key] = true
+				repaired = append(repaired, fmt.Sprintf("re-created link %s <--> %s", d.veth.Name, d.veth.PeerName))
+			}
+		case DriftPort:
+			var vlan *domain.PortVLAN
+			if d.port != nil {
+				vlan = d.port.VLAN
+			}
+			bridge := *d.bridge // Attaching records the port again
+			if err = bridge.AttachInterfaceByName(d.Interface, vlan); err == nil {
+				repaired = append(repaired, fmt.Sprintf("%s: re-attached %s to %s", d.Node, d.Interface, d.bridge.Name))
+			}
+		case DriftAddress:
+			if recreated[linkKey(d.veth)] {
+				continue
+			}
+			veth := *d.veth // Assigning records the address again
+			if err = veth.AssignIP(d.Interface, d.Detail, d.container.Namespace); err == nil {
+				repaired = append(repaired, fmt.Sprintf("%s: re-assigned %s to %s", d.Node, d.Detail, d.Interface))
+			}
+		case DriftRoute:
+			if err = domain.AddRoute(d.container.Namespace, *d.route); err == nil {
+				repaired = append(repaired, fmt.Sprintf("%s: re-added route %s", d.Node, d.route))
+			}
+		case DriftMirror:
+			if err = d.bridge.RestoreMirror(d.mirror.Name); err == nil {
+				repaired = append(repaired, fmt.Sprintf("%s: re-installed mirror %s on %s", d.Node, d.mirror.Name, d.bridge.Name))
+			}
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", d, err))
+		}
+	}
+
+	return repaired, errs
+}
+
+// linkKey identifies a veth by its A end
+func linkKey(v *domain.Veth) string {
+	if v.NamespaceA == nil {
+		return v.Name
+	}
+	return v.NamespaceA.Path + "/" + v.Name
+}
+
+// recreateLink creates a veth pair again from its record with its delay and
+// brings both ends up with their addresses and static neighbors
+func recreateLink(v *domain.Veth) error {
+	end := func(name string, port int, ns *domain.Namespace, mac string, mtu int) domain.VethEnd {
+		e := domain.VethEnd{Name: name, Port: port, Namespace: ns, MTU: mtu}
+		if hw, err := net.ParseMAC(mac); err == nil {
+			e.MAC = hw
+		}
+		return e
+	}
+
+	veth, err := domain.CreateVethPair(
+		end(v.Name, v.PortA, v.NamespaceA, v.MACA, v.MTUA),
+		end(v.PeerName, v.PortB, v.NamespaceB, v.MACB, v.MTUB),
+	)
+	if err != nil {
+		return err
+	}
+	if delay, err := time.ParseDuration(v.Delay); err == nil {
+		if err := domain.SetLinkDelay(v.Name, delay, v.NamespaceA); err != nil {
+			return err
+		}
+		if err := domain.SetLinkDelay(v.PeerName, delay, v.NamespaceB); err != nil {
+			return err
+		}
+	}
+
+	ends := []struct {
+		name      string
+		ns        *domain.Namespace
+		addrs     []string
+		neighbors []domain.Neighbor
+	}{
+		{v.Name, v.NamespaceA, v.AddrsA, v.NeighborsA},
+		{v.PeerName, v.NamespaceB, v.AddrsB, v.NeighborsB},
+	}
+	for _, e := range ends {
+		if err := domain.SetLinkUp(e.name, e.ns); err != nil {
+			return err
+		}
+		for _, addr := range e.addrs {
+			if err := veth.AssignIP(e.name, addr, e.ns); err != nil {
+				return fmt.Errorf("assign %s to %s: %w", addr, e.name, err)
+			}
+		}
+		for _, n := range e.neighbors {
+			mac, err := net.ParseMAC(n.MAC)
+			if err != nil {
+				continue
+			}
+			if err := domain.AddNeighbor(e.name, net.ParseIP(n.IP), mac, e.ns); err != nil {
+				return fmt.Errorf("neighbor %s on %s: %w", n.IP, e.name, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,315 @@
+package watch
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"gonett/internal/container/domain"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+)
+
+// DefaultInterval is how often Watch re-checks every node without kernel
+// events, which catches namespaces deleted from outside
+const DefaultInterval = 5 * time.Second
+
+// settleDelay lets a burst of kernel events settle before checking
+const settleDelay = 200 * time.Millisecond
+
+// Options configures Watch
+type Options struct {
+	Load     func() ([]*domain.Container, error) // Reads the recorded nodes on every check
+	Select   func(*domain.Container) bool        // Nodes to watch (all when nil)
+	Heal     bool                                // Repair drifts from the recorded state
+	Verbose  bool                                // Log every kernel event
+	Interval time.Duration                       // Periodic check (DefaultInterval when zero)
+	Lock     sync.Locker                         // Held while checking and healing, if set
+	Out      io.Writer
+}
+
+// watcher tracks the namespaces it is subscribed to and the drifts it has
+// reported
+type watcher struct {
+	opts    Options
+	events  chan struct{}
+	subs    map[string]chan struct{} // Subscription stop channels by namespace path ("" for root)
+	drifts  map[string]string        // Node of each reported drift, by description
+	eventMu sync.Mutex
+}
+
+// Watch subscribes to link, address and route updates in the namespace of
+// every watched node and checks the nodes against their records whenever
+// the kernel reports a change, and every interval. New drifts, resolved
+// drifts and repairs are logged to opts.Out until stop is closed.
+func Watch(opts Options, stop <-chan struct{}) error {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+
+	w := &watcher{
+		opts:   opts,
+		events: make(chan struct{}, 1),
+		subs:   make(map[string]chan struct{}),
+		drifts: make(map[string]string),
+	}
+	defer w.unsubscribeAll()
+
+	if err := w.check(); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	var settle <-chan time.Time
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-w.events:
+			if settle == nil {
+				settle = time.After(settleDelay)
+			}
+		case <-settle:
+			settle = nil
+			if err := w.check(); err != nil {
+				w.logf("error: %v", err)
+			}
+		case <-ticker.C:
+			if err := w.check(); err != nil {
+				w.logf("error: %v", err)
+			}
+		}
+	}
+}
+
+func (w *watcher) logf(format string, args ...any) {
+	w.eventMu.Lock()
+	defer w.eventMu.Unlock()
+	fmt.Fprintf(w.opts.Out, "[%s] %s\n", time.Now().Format("15:04:05"), fmt.Sprintf(format, args...))
+}
+
+// check compares every watched node with its record, logs what changed
+// since the last check and heals when asked to
+func (w *watcher) check() error {
+	if w.opts.Lock != nil {
+		w.opts.Lock.Lock()
+		defer w.opts.Lock.Unlock()
+	}
+
+	all, err := w.opts.Load()
+	if err != nil {
+		return fmt.Errorf("load nodes: %w", err)
+	}
+
+	var containers []*domain.Container
+	for _, c := range all {
+		if w.opts.Select == nil || w.opts.Select(c) {
+			containers = append(containers, c)
+		}
+	}
+	sort.Slice(containers, func(i, j int) bool { return containers[i].Name < containers[j].Name })
+
+	w.subscribe(containers)
+
+	var drifts []Drift
+	for _, c := range containers {
+		found, err := Check(c)
+		if err != nil {
+			w.logf("error: %v", err)
+			continue
+		}
+		drifts = append(drifts, found...)
+	}
+
+	// Drifts of removed nodes disappear without being resolved
+	watched := make(map[string]bool)
+	for _, c := range containers {
+		watched[c.Name] = true
+	}
+
+	current := make(map[string]string)
+	for _, d := range drifts {
+		current[d.String()] = d.Node
+		if _, ok := w.drifts[d.String()]; !ok {
+			w.logf("drift: %s", d)
+		}
+	}
+	for msg, node := range w.drifts {
+		if _, ok := current[msg]; !ok && watched[node] {
+			w.logf("resolved: %s", msg)
+		}
+	}
+	w.drifts = current
+
+	if w.opts.Heal && len(drifts) > 0 {
+		repaired, errs := Heal(drifts)
+		for _, msg := range repaired {
+			w.logf("healed: %s", msg)
+		}
+		for _, err := range errs {
+			w.logf("heal failed: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// notify schedules a check after a kernel event
+func (w *watcher) notify() {
+	select {
+	case w.events <- struct{}{}:
+	default:
+	}
+}
+
+// subscribe starts subscriptions for namespaces of new nodes and stops the
+// ones of namespaces no node uses any more
+func (w *watcher) subscribe(containers []*domain.Container) {
+	wanted := make(map[string]*domain.Container)
+	for _, c := range containers {
+		if !namespaceExists(c.Namespace) {
+			continue
+		}
+		key := ""
+		if c.Namespace != nil {
+			key = c.Namespace.Path
+		}
+		if wanted[key] == nil {
+			wanted[key] = c
+		}
+	}
+
+	for key, done := range w.subs {
+		if wanted[key] == nil {
+			close(done)
+			delete(w.subs, key)
+		}
+	}
+
+	for key, c := range wanted {
+		if w.subs[key] != nil {
+			continue
+		}
+		done := make(chan struct{})
+		if err := w.subscribeNamespace(c, done); err != nil {
+			close(done)
+			w.logf("error: watch %s: %v", c.Name, err)
+			continue
+		}
+		w.subs[key] = done
+	}
+}
+
+func (w *watcher) unsubscribeAll() {
+	for key, done := range w.subs {
+		close(done)
+		delete(w.subs, key)
+	}
+}
+
+// subscribeNamespace subscribes to link, address and route updates in a
+// node's namespace. The netlink sockets stay bound to the namespace, so
+// events keep arriving after the thread leaves it.
+func (w *watcher) subscribeNamespace(c *domain.Container, done chan struct{}) error {
+	var handle *netns.NsHandle
+	if c.Namespace != nil {
+		h, err := netns.GetFromPath(c.Namespace.Path)
+		if err != nil {
+			return fmt.Errorf("open namespace: %w", err)
+		}
+		defer h.Close()
+		handle = &h
+	}
+
+	// Closing done interrupts the receive loops; those errors are expected
+	onError := func(err error) {
+		select {
+		case <-done:
+		default:
+			w.logf("error: watch %s: %v", c.Name, err)
+		}
+	}
+
+	links := make(chan netlink.LinkUpdate, 64)
+	if err := netlink.LinkSubscribeWithOptions(links, done, netlink.LinkSubscribeOptions{Namespace: handle, ErrorCallback: onError}); err != nil {
+		return fmt.Errorf("subscribe to links: %w", err)
+	}
+	addrs := make(chan netlink.AddrUpdate, 64)
+	if err := netlink.AddrSubscribeWithOptions(addrs, done, netlink.AddrSubscribeOptions{Namespace: handle, ErrorCallback: onError}); err != nil {
+		return fmt.Errorf("subscribe to addresses: %w", err)
+	}
+	routes := make(chan netlink.RouteUpdate, 64)
+	if err := netlink.RouteSubscribeWithOptions(routes, done, netlink.RouteSubscribeOptions{Namespace: handle, ErrorCallback: onError}); err != nil {
+		return fmt.Errorf("subscribe to routes: %w", err)
+	}
+
+	go func() {
+		for u := range links {
+			if w.opts.Verbose {
+				w.logf("event: %s: %s", c.Name, describeLink(u))
+			}
+			w.notify()
+		}
+	}()
+	go func() {
+		for u := range addrs {
+			if w.opts.Verbose {
+				w.logf("event: %s: %s", c.Name, describeAddr(u))
+			}
+			w.notify()
+		}
+	}()
+	go func() {
+		for u := range routes {
+			if w.opts.Verbose {
+				w.logf("event: %s: %s", c.Name, describeRoute(u))
+			}
+			w.notify()
+		}
+	}()
+
+	return nil
+}
+
+func describeLink(u netlink.LinkUpdate) string {
+	name := u.Attrs().Name
+	if u.Header.Type == unix.RTM_DELLINK {
+		return fmt.Sprintf("link %s deleted", name)
+	}
+	state := "down"
+	if u.Attrs().Flags&net.FlagUp != 0 {
+		state = "up"
+	}
+	return fmt.Sprintf("link %s %s", name, state)
+}
+
+func describeAddr(u netlink.AddrUpdate) string {
+	action := "removed from"
+	if u.NewAddr {
+		action = "added to"
+	}
+	return fmt.Sprintf("address %s %s interface %d", u.LinkAddress.String(), action, u.LinkIndex)
+}
+
+func describeRoute(u netlink.RouteUpdate) string {
+	action := "added"
+	if u.Type == unix.RTM_DELROUTE {
+		action = "deleted"
+	}
+
+	dst := "default"
+	if u.Dst != nil {
+		dst = u.Dst.String()
+	}
+	if u.Gw != nil {
+		dst += " via " + u.Gw.String()
+	}
+	return fmt.Sprintf("route %s %s", dst, action)
+}